@@ -18,6 +18,10 @@ const configPath = "configs"
 // @securityDefinitions.apikey AdminAuth
 // @in context
 // @name Admin authorization
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
 	app.Run(configPath)
 }
@@ -9,7 +9,9 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"shop_backend/internal/config"
@@ -19,7 +21,11 @@ import (
 	"shop_backend/internal/service"
 	"shop_backend/pkg/auth"
 	"shop_backend/pkg/hash"
+	"shop_backend/pkg/limiter"
 	"shop_backend/pkg/logger"
+	"shop_backend/pkg/mailer"
+	"shop_backend/pkg/oidc"
+	"shop_backend/pkg/payments"
 	"syscall"
 	"time"
 )
@@ -59,29 +65,80 @@ func Run(configPath string) {
 	}
 
 	// Hasher
-	hasher := hash.NewSHA1Hasher(cfg.Auth.PasswordSalt)
+	hasher := hash.NewArgon2Hasher(hash.Argon2Params{
+		Memory:      cfg.Auth.Argon2.Memory,
+		Iterations:  cfg.Auth.Argon2.Iterations,
+		Parallelism: cfg.Auth.Argon2.Parallelism,
+	}, hash.NewSHA1Hasher(cfg.Auth.PasswordSalt))
 
 	// Token manager
-	tokenManager, err := auth.NewManager(cfg.Auth.JWT.SigningKey)
+	tokenManager, err := newTokenManager(cfg.Auth.JWT)
 	if err != nil {
 		logger.Error("[AUTH] " + err.Error())
 		return
 	}
 
+	// Payment provider
+	paymentProvider, err := newPaymentProvider(cfg.Payments)
+	if err != nil {
+		logger.Error("[PAYMENTS] " + err.Error())
+		return
+	}
+
+	// Mailer
+	mail, err := newMailer(cfg.Mail)
+	if err != nil {
+		logger.Error("[MAIL] " + err.Error())
+		return
+	}
+
+	// Limiter store
+	limiterStore, err := newLimiterStore(cfg.Limiter)
+	if err != nil {
+		logger.Error("[LIMITER] " + err.Error())
+		return
+	}
+
+	// OAuth providers
+	oauthProviders, mockIssuers, err := newOAuthProviders(cfg.OAuth)
+	if err != nil {
+		logger.Error("[OAUTH] " + err.Error())
+		return
+	}
+
 	// Services and repositories
 	repos := repository.NewRepositories(db)
 	services := service.NewServices(service.ServicesDeps{
-		Repos:           repos,
-		Hasher:          hasher,
-		AccessTokenTTL:  cfg.Auth.AccessTokenTTL,
-		RefreshTokenTTL: cfg.Auth.RefreshTokenTTL,
-		TokenManager:    tokenManager,
+		Repos:            repos,
+		Hasher:           hasher,
+		AccessTokenTTL:   cfg.Auth.AccessTokenTTL,
+		RefreshTokenTTL:  cfg.Auth.RefreshTokenTTL,
+		PasswordResetTTL: cfg.Auth.PasswordResetTTL,
+		VerificationTTL:  cfg.Auth.VerificationTTL,
+		Mailer:           mail,
+		LinkBaseURL:      cfg.Mail.LinkBaseURL,
+		TotpIssuer:       cfg.Auth.TotpIssuer,
+		RequireAdmin2FA:  cfg.Auth.RequireAdmin2FA,
+		AuthCacheTTL:     cfg.Auth.CacheTTL,
+		MaxLoginFailures: cfg.Auth.Lockout.Attempts,
+		LockoutDuration:  cfg.Auth.Lockout.Duration,
+		OAuthProviders:   oauthProviders,
+		TokenManager:     tokenManager,
+		PaymentProvider:  paymentProvider,
+		Currency:         cfg.Payments.Currency,
+		ShippingPrice:    cfg.Orders.ShippingPrice,
 	})
 
-	handlers := delivery.NewHandler(services, cfg, tokenManager)
+	handlers := delivery.NewHandler(services, cfg, tokenManager, limiterStore)
+
+	router, err := handlers.Init(cfg)
+	if err != nil {
+		logger.Error("[HTTP] " + err.Error())
+		return
+	}
 
 	// HTTP server
-	srv := server.NewServer(cfg, handlers.Init(cfg))
+	srv := server.NewServer(cfg, router)
 
 	go func() {
 		if err := srv.Run(); !errors.Is(err, http.ErrServerClosed) {
@@ -103,7 +160,153 @@ func Run(configPath string) {
 		logger.Errorf("failed to stop server: %s", err.Error())
 	}
 
+	for _, issuer := range mockIssuers {
+		if err := issuer.Shutdown(ctx); err != nil {
+			logger.Errorf("failed to stop mock issuer: %s", err.Error())
+		}
+	}
+
 	if err := db.Close(); err != nil {
 		logger.Error(err.Error())
 	}
 }
+
+// newPaymentProvider returns nil provider when payments are disabled
+func newPaymentProvider(cfg config.PaymentsConfig) (payments.Provider, error) {
+	switch cfg.Provider {
+	case "":
+		logger.Info("[PAYMENTS] no payment provider configured, payments are disabled")
+		return nil, nil
+	case "fake":
+		logger.Warn("[PAYMENTS] fake provider lets anyone confirm payments, do not use it in production")
+		return payments.NewFakeProvider(cfg.WebhookSecret, cfg.FakeConfirmURL)
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", cfg.Provider)
+	}
+}
+
+// newOAuthProviders creates OpenID Connect providers by name and starts local
+// mock issuers of providers marked as mock
+func newOAuthProviders(cfg config.OAuthConfig) (map[string]*oidc.Provider, []*http.Server, error) {
+	providers := make(map[string]*oidc.Provider, len(cfg.Providers))
+	var mockIssuers []*http.Server
+	for name, providerCfg := range cfg.Providers {
+		provider, err := oidc.NewProvider(oidc.Config{
+			Issuer:       providerCfg.Issuer,
+			ClientId:     providerCfg.ClientId,
+			ClientSecret: providerCfg.ClientSecret,
+			RedirectURL:  providerCfg.RedirectURL,
+			Scopes:       providerCfg.Scopes,
+		}, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("provider %q: %w", name, err)
+		}
+		providers[name] = provider
+
+		if providerCfg.Mock {
+			logger.Warnf("[OAUTH] provider %q is served by mock issuer signing in anyone, do not use it in production", name)
+			srv, err := startMockIssuer(providerCfg)
+			if err != nil {
+				return nil, nil, fmt.Errorf("provider %q: %w", name, err)
+			}
+			mockIssuers = append(mockIssuers, srv)
+		}
+	}
+
+	return providers, mockIssuers, nil
+}
+
+// startMockIssuer serves mock issuer at issuer address, which has to be
+// loopback one so that mock cannot be reached outside development machine
+func startMockIssuer(cfg config.OAuthProviderConfig) (*http.Server, error) {
+	issuerURL, err := url.Parse(cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	if !isLoopback(issuerURL.Hostname()) {
+		return nil, fmt.Errorf("mock issuer must be on loopback address, got %q", issuerURL.Host)
+	}
+	issuer, err := oidc.NewMockIssuer(cfg.Issuer, cfg.ClientId, cfg.ClientSecret, "")
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", issuerURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: issuer}
+	go func() {
+		if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("error occurred while running mock issuer: %s\n", err.Error())
+		}
+	}()
+
+	return srv, nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+func newLimiterStore(cfg config.LimiterConfig) (limiter.Store, error) {
+	switch cfg.Store {
+	case "memory", "":
+		return limiter.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown limiter store %q", cfg.Store)
+	}
+}
+
+func newMailer(cfg config.MailConfig) (mailer.Mailer, error) {
+	switch cfg.Provider {
+	case "file":
+		return mailer.NewFileMailer(cfg.FilePath, cfg.From)
+	case "smtp":
+		return mailer.NewSMTPMailer(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From)
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q", cfg.Provider)
+	}
+}
+
+func newTokenManager(cfg config.JWTConfig) (*auth.Manager, error) {
+	if len(cfg.Keys) == 0 {
+		logger.Warn("[AUTH] no JWT keys configured, ephemeral key is generated and tokens will not survive restart")
+		key, err := auth.GenerateKey("ephemeral")
+		if err != nil {
+			return nil, err
+		}
+
+		return auth.NewManager(key.Id, []auth.Key{key})
+	}
+
+	keys := make([]auth.Key, 0, len(cfg.Keys))
+	for _, keyCfg := range cfg.Keys {
+		var key auth.Key
+		if keyCfg.PrivateKeyFile != "" {
+			data, err := os.ReadFile(keyCfg.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if key, err = auth.ParsePrivateKey(keyCfg.Id, data); err != nil {
+				return nil, err
+			}
+		} else {
+			data, err := os.ReadFile(keyCfg.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if key, err = auth.ParsePublicKey(keyCfg.Id, data); err != nil {
+				return nil, err
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	return auth.NewManager(cfg.SigningKeyId, keys)
+}
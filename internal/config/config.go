@@ -3,14 +3,20 @@ package config
 import (
 	"github.com/spf13/viper"
 	"os"
+	"strings"
 	"time"
 )
 
 type (
 	Config struct {
-		HTTP  HTTPConfig
-		PGSQL PGSQLConfig
-		Auth  AuthConfig
+		HTTP     HTTPConfig
+		PGSQL    PGSQLConfig
+		Auth     AuthConfig
+		Payments PaymentsConfig
+		Orders   OrdersConfig
+		Mail     MailConfig
+		Limiter  LimiterConfig
+		OAuth    OAuthConfig
 	}
 
 	HTTPConfig struct {
@@ -19,6 +25,9 @@ type (
 		ReadTimeout        time.Duration `mapstructure:"readTimeout"`
 		WriteTimeout       time.Duration `mapstructure:"writeTimeout"`
 		MaxHeaderMegabytes int           `mapstructure:"maxHeaderBytes"`
+		// TrustedProxies are addresses or CIDRs of proxies whose forwarded
+		// headers give client address, none are trusted by default
+		TrustedProxies []string `mapstructure:"trustedProxies"`
 	}
 
 	PGSQLConfig struct {
@@ -31,14 +40,128 @@ type (
 	}
 
 	AuthConfig struct {
-		PasswordSalt    string
-		JWT             JWTConfig
-		AccessTokenTTL  time.Duration `mapstructure:"accessTokenTTL"`
-		RefreshTokenTTL time.Duration `mapstructure:"refreshTokenTTL"`
+		PasswordSalt     string
+		Argon2           Argon2Config  `mapstructure:"argon2"`
+		JWT              JWTConfig     `mapstructure:"jwt"`
+		AccessTokenTTL   time.Duration `mapstructure:"accessTokenTTL"`
+		RefreshTokenTTL  time.Duration `mapstructure:"refreshTokenTTL"`
+		PasswordResetTTL time.Duration `mapstructure:"passwordResetTTL"`
+		VerificationTTL  time.Duration `mapstructure:"verificationTTL"`
+		TotpIssuer       string        `mapstructure:"totpIssuer"`
+		RequireAdmin2FA  bool          `mapstructure:"requireAdmin2FA"`
+		// CacheTTL is how long token versions, sessions and permissions of roles are cached in memory
+		CacheTTL     time.Duration      `mapstructure:"cacheTTL"`
+		Lockout      LockoutConfig      `mapstructure:"lockout"`
+		SignInLimits SignInLimitsConfig `mapstructure:"signInLimits"`
+	}
+
+	// LockoutConfig locks account for Duration after Attempts consecutive failed sign ins
+	LockoutConfig struct {
+		Attempts int           `mapstructure:"attempts"`
+		Duration time.Duration `mapstructure:"duration"`
+	}
+
+	// SignInLimitsConfig limits sign in attempts by client address and by login
+	SignInLimitsConfig struct {
+		IP    LimitConfig `mapstructure:"ip"`
+		Login LimitConfig `mapstructure:"login"`
+	}
+
+	// LimitConfig allows Limit hits per Window, zero Limit disables it. Delay
+	// set makes each hit postpone the next one, doubling up to MaxDelay
+	LimitConfig struct {
+		Limit    int           `mapstructure:"limit"`
+		Window   time.Duration `mapstructure:"window"`
+		Delay    time.Duration `mapstructure:"delay"`
+		MaxDelay time.Duration `mapstructure:"maxDelay"`
+	}
+
+	Argon2Config struct {
+		Memory      uint32 `mapstructure:"memory"`
+		Iterations  uint32 `mapstructure:"iterations"`
+		Parallelism uint8  `mapstructure:"parallelism"`
 	}
 
 	JWTConfig struct {
-		SigningKey string
+		// SigningKeyId is id of key new access tokens are signed with
+		SigningKeyId string         `mapstructure:"signingKeyId"`
+		Keys         []JWTKeyConfig `mapstructure:"keys"`
+	}
+
+	// JWTKeyConfig points to PEM encoded RSA or Ed25519 key. Keys kept only
+	// for verification of tokens signed before rotation need public key only
+	JWTKeyConfig struct {
+		Id             string `mapstructure:"id"`
+		PrivateKeyFile string `mapstructure:"privateKeyFile"`
+		PublicKeyFile  string `mapstructure:"publicKeyFile"`
+	}
+
+	PaymentsConfig struct {
+		Provider       string `mapstructure:"provider"`
+		Currency       string `mapstructure:"currency"`
+		FakeConfirmURL string `mapstructure:"fakeConfirmUrl"`
+		WebhookSecret  string
+	}
+
+	OrdersConfig struct {
+		ShippingPrice float64 `mapstructure:"shippingPrice"`
+	}
+
+	MailConfig struct {
+		Provider string `mapstructure:"provider"`
+		From     string `mapstructure:"from"`
+		// FilePath of file provider, empty path means stdout
+		FilePath string     `mapstructure:"filePath"`
+		SMTP     SMTPConfig `mapstructure:"smtp"`
+		// LinkBaseURL is frontend address used in links sent by email
+		LinkBaseURL string `mapstructure:"linkBaseUrl"`
+	}
+
+	LimiterConfig struct {
+		// Store keeps counters of limiters, only memory store is available
+		Store string `mapstructure:"store"`
+		// Default rate limits apply to route groups missing in Groups
+		Default RateLimitTiers            `mapstructure:"default"`
+		Groups  map[string]RateLimitTiers `mapstructure:"groups"`
+	}
+
+	// RateLimitTiers limits anonymous clients by address, users and admins by user id
+	RateLimitTiers struct {
+		Anonymous RateLimitConfig `mapstructure:"anonymous"`
+		User      RateLimitConfig `mapstructure:"user"`
+		Admin     RateLimitConfig `mapstructure:"admin"`
+	}
+
+	// RateLimitConfig allows Limit requests per Period on average and bursts
+	// of up to Burst requests, zero Burst means Limit. Zero Limit disables limit
+	RateLimitConfig struct {
+		Limit  int           `mapstructure:"limit"`
+		Period time.Duration `mapstructure:"period"`
+		Burst  int           `mapstructure:"burst"`
+	}
+
+	// OAuthConfig lists OpenID Connect providers users can sign in with by name
+	OAuthConfig struct {
+		Providers map[string]OAuthProviderConfig `mapstructure:"providers"`
+	}
+
+	OAuthProviderConfig struct {
+		Issuer   string `mapstructure:"issuer"`
+		ClientId string `mapstructure:"clientId"`
+		// ClientSecret is read from OAUTH_<NAME>_CLIENT_SECRET, public clients have none
+		ClientSecret string
+		// RedirectURL is frontend page receiving code and state from provider
+		RedirectURL string   `mapstructure:"redirectUrl"`
+		Scopes      []string `mapstructure:"scopes"`
+		// Mock starts local mock issuer listening at Issuer address, for development only
+		Mock bool `mapstructure:"mock"`
+	}
+
+	SMTPConfig struct {
+		Host     string `mapstructure:"host"`
+		Port     int    `mapstructure:"port"`
+		Username string
+		Password string
 	}
 )
 
@@ -69,11 +192,21 @@ func setEnv(cfg *Config) {
 		cfg.PGSQL.Port = val
 	}
 
-	// JWT
-	cfg.Auth.JWT.SigningKey = os.Getenv("JWT_SIGNING_KEY")
-
-	// Password salt
+	// Password salt of legacy SHA1 hashes
 	cfg.Auth.PasswordSalt = os.Getenv("PASS_SALT")
+
+	// Payments
+	cfg.Payments.WebhookSecret = os.Getenv("PAYMENTS_WEBHOOK_SECRET")
+
+	// SMTP credentials
+	cfg.Mail.SMTP.Username = os.Getenv("SMTP_USERNAME")
+	cfg.Mail.SMTP.Password = os.Getenv("SMTP_PASSWORD")
+
+	// OAuth client secrets
+	for name, provider := range cfg.OAuth.Providers {
+		provider.ClientSecret = os.Getenv("OAUTH_" + strings.ToUpper(name) + "_CLIENT_SECRET")
+		cfg.OAuth.Providers[name] = provider
+	}
 }
 
 func unmarshal(cfg *Config) error {
@@ -88,6 +221,26 @@ func unmarshal(cfg *Config) error {
 	if err := viper.UnmarshalKey("auth", &cfg.Auth); err != nil {
 		return err
 	}
+
+	if err := viper.UnmarshalKey("payments", &cfg.Payments); err != nil {
+		return err
+	}
+
+	if err := viper.UnmarshalKey("orders", &cfg.Orders); err != nil {
+		return err
+	}
+
+	if err := viper.UnmarshalKey("mail", &cfg.Mail); err != nil {
+		return err
+	}
+
+	if err := viper.UnmarshalKey("limiter", &cfg.Limiter); err != nil {
+		return err
+	}
+
+	if err := viper.UnmarshalKey("oauth", &cfg.OAuth); err != nil {
+		return err
+	}
 	return nil
 }
 
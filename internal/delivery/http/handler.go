@@ -4,43 +4,66 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
+	"net/http"
 	_ "shop_backend/docs"
 	"shop_backend/internal/config"
 	v1 "shop_backend/internal/delivery/http/v1"
 	"shop_backend/internal/service"
 	"shop_backend/pkg/auth"
+	"shop_backend/pkg/limiter"
 )
 
 type Handler struct {
 	services     *service.Services
 	cfg          *config.Config
 	tokenManager auth.TokenManager
+	limiterStore limiter.Store
 }
 
-func NewHandler(services *service.Services, cfg *config.Config, tokenManager auth.TokenManager) *Handler {
+func NewHandler(services *service.Services, cfg *config.Config, tokenManager auth.TokenManager, limiterStore limiter.Store) *Handler {
 	return &Handler{
 		services:     services,
 		cfg:          cfg,
 		tokenManager: tokenManager,
+		limiterStore: limiterStore,
 	}
 }
 
-func (h *Handler) Init(cfg *config.Config) *gin.Engine {
+func (h *Handler) Init(cfg *config.Config) (*gin.Engine, error) {
 	r := gin.Default()
 
+	// Client address limits sign ins and requests, so X-Forwarded-For is
+	// honored only when it is set by own proxy
+	if err := r.SetTrustedProxies(cfg.HTTP.TrustedProxies); err != nil {
+		return nil, err
+	}
+
 	r.Use(corsMiddleware)
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	r.GET("/.well-known/jwks.json", h.jwks)
 
 	h.InitApi(r)
 
-	return r
+	return r, nil
 }
 
 func (h *Handler) InitApi(r *gin.Engine) {
-	handlerV1 := v1.NewHandler(h.services, h.cfg, h.tokenManager)
+	handlerV1 := v1.NewHandler(h.services, h.cfg, h.tokenManager, h.limiterStore)
 	api := r.Group("/")
 	{
 		handlerV1.Init(api)
 	}
 }
+
+// @Summary JSON Web Key Set
+// @Tags auth
+// @Description public keys access tokens are signed with, token kid header selects key
+// @Produce json
+// @Success 200 {object} auth.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *Handler) jwks(ctx *gin.Context) {
+	// Keys change only on deploy, short caching lets verifiers pick up rotation
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.tokenManager.JWKS())
+}
@@ -0,0 +1,158 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+	"shop_backend/pkg/auth"
+	"strconv"
+	"time"
+)
+
+func (h *Handler) InitApiKeysRoutes(api *gin.RouterGroup) {
+	apiKeys := api.Group("/api-keys", h.rateLimit("security"), h.userIdentity, h.requirePermission(models.PermissionUsersManage))
+	{
+		apiKeys.GET("/", h.getAllApiKeys)
+		apiKeys.POST("/", h.audit(models.AuditEntityApiKey, "create", h.auditApiKey), h.createApiKey)
+		apiKeys.POST("/:id/rotate", h.audit(models.AuditEntityApiKey, "rotate", h.auditApiKey), h.rotateApiKey)
+		apiKeys.DELETE("/:id", h.audit(models.AuditEntityApiKey, "revoke", h.auditApiKey), h.revokeApiKey)
+	}
+}
+
+type apiKeyInput struct {
+	Name      string              `json:"name" binding:"required,max=100"`
+	Scopes    []models.Permission `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time          `json:"expiresAt"`
+}
+
+// @Summary Create API key
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags api-keys-actions
+// @Description create key for integrations, scopes are limited to catalog:write, images:write, orders:manage
+// @Description and coupons:manage held by creator. Key is returned only once, send it in X-API-Key header
+// @Accept json
+// @Produce json
+// @Param input body apiKeyInput true "input body"
+// @Success 201 {object} models.NewApiKey
+// @Failure 400,403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api-keys/ [post]
+func (h *Handler) createApiKey(ctx *gin.Context) {
+	var body apiKeyInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	apiKey, err := h.services.ApiKeys.Create(ctx.Request.Context(), ctx.MustGet(claimsCtx).(auth.Claims), models.ApiKey{
+		Name:      body.Name,
+		Scopes:    body.Scopes,
+		CreatedBy: &userId,
+		ExpiresAt: body.ExpiresAt,
+	})
+	if err != nil {
+		h.abortWithApiKeyError(ctx, err)
+		return
+	}
+
+	setAuditEntity(ctx, apiKey.Id)
+	ctx.JSON(http.StatusCreated, apiKey)
+}
+
+// @Summary Get all API keys
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags api-keys-actions
+// @Description get all keys including revoked and expired ones, key itself is never returned
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.ApiKey
+// @Failure 500 {object} ErrorResponse
+// @Router /api-keys/ [get]
+func (h *Handler) getAllApiKeys(ctx *gin.Context) {
+	apiKeys, err := h.services.ApiKeys.GetAll(ctx.Request.Context())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, apiKeys)
+}
+
+// @Summary Rotate API key
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags api-keys-actions
+// @Description replace key keeping its name and scopes, the old key stops working at once
+// @Accept json
+// @Produce json
+// @Param id path int true "api key id"
+// @Success 200 {object} models.NewApiKey
+// @Failure 400,403,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api-keys/{id}/rotate [post]
+func (h *Handler) rotateApiKey(ctx *gin.Context) {
+	strKeyId := ctx.Param("id")
+	keyId, err := strconv.Atoi(strKeyId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	apiKey, err := h.services.ApiKeys.Rotate(ctx.Request.Context(), ctx.MustGet(claimsCtx).(auth.Claims), keyId)
+	if err != nil {
+		h.abortWithApiKeyError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, apiKey)
+}
+
+// @Summary Revoke API key
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags api-keys-actions
+// @Description revoke key, it is kept in list with revocation time
+// @Accept json
+// @Produce json
+// @Param id path int true "api key id"
+// @Success 200 ""
+// @Failure 400,403,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api-keys/{id} [delete]
+func (h *Handler) revokeApiKey(ctx *gin.Context) {
+	strKeyId := ctx.Param("id")
+	keyId, err := strconv.Atoi(strKeyId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.ApiKeys.Revoke(ctx.Request.Context(), ctx.MustGet(claimsCtx).(auth.Claims), keyId); err != nil {
+		h.abortWithApiKeyError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (h *Handler) abortWithApiKeyError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrWrongScope):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrForbidden), errors.Is(err, models.ErrTwoFactorRequired):
+		ctx.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrApiKeyNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
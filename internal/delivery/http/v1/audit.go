@@ -0,0 +1,281 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+	"shop_backend/pkg/logger"
+	"strconv"
+	"time"
+)
+
+const (
+	auditEntityCtx = "auditEntityId"
+
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+func (h *Handler) InitAuditRoutes(api *gin.RouterGroup) {
+	audit := api.Group("/audit-log", h.rateLimit("security"), h.userIdentity, h.requirePermission(models.PermissionAuditRead))
+	{
+		audit.GET("/", h.getAuditLog)
+	}
+}
+
+// auditLoader returns current state of entity, it is stored as JSON in audit log
+type auditLoader func(ctx context.Context, entityId int) (interface{}, error)
+
+// audit records change of entity made by the next handlers. Entity id is taken
+// from path, handlers creating entities report it with setAuditEntity. Nothing
+// is recorded if request fails. Response is held back until audit log is
+// written, change which cannot be recorded fails the request, so it is never
+// reported as done without trace
+func (h *Handler) audit(entityType, action string, load auditLoader) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		entityId, err := strconv.Atoi(ctx.Param("id"))
+		hasEntity := err == nil
+
+		var before json.RawMessage
+		if hasEntity {
+			before = auditState(ctx, load, entityId)
+		}
+
+		writer := &auditWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		ctx.Next()
+		ctx.Writer = writer.ResponseWriter
+
+		if ctx.IsAborted() || ctx.Writer.Status() >= http.StatusBadRequest {
+			writer.flush()
+			return
+		}
+
+		if id, ok := ctx.Get(auditEntityCtx); ok {
+			entityId, hasEntity = id.(int), true
+		}
+
+		entry := models.AuditEntry{
+			Action:     action,
+			EntityType: entityType,
+			Before:     before,
+			Ip:         ctx.ClientIP(),
+		}
+		if hasEntity {
+			entry.EntityId = &entityId
+			entry.After = auditState(ctx, load, entityId)
+		}
+
+		if apiKey, ok := ctx.Get(apiKeyCtx); ok {
+			keyId := apiKey.(models.ApiKey).Id
+			entry.ApiKeyId = &keyId
+		} else if userId, err := getIdByContext(ctx, userCtx); err == nil {
+			entry.ActorId = &userId
+		}
+
+		if err := h.services.Audit.Record(ctx.Request.Context(), entry); err != nil {
+			logger.Errorf("failed to record %s %s to audit log: %s", action, entityType, err.Error())
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		writer.flush()
+	}
+}
+
+// auditWriter keeps response of audited handlers in memory, so it can be
+// replaced by error if audit log cannot be written
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *auditWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// WriteHeaderNow only keeps status, it is sent by flush
+func (w *auditWriter) WriteHeaderNow() {}
+
+// Flush is ignored, nothing is sent before audit log is written
+func (w *auditWriter) Flush() {}
+
+// flush sends held back response
+func (w *auditWriter) flush() {
+	w.ResponseWriter.WriteHeaderNow()
+	if w.body.Len() == 0 {
+		return
+	}
+
+	if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+		logger.Errorf("failed to write response: %s", err.Error())
+	}
+}
+
+// setAuditEntity reports id of created entity to audit middleware
+func setAuditEntity(ctx *gin.Context, entityId int) {
+	ctx.Set(auditEntityCtx, entityId)
+}
+
+// auditState loads entity as JSON. Entity which cannot be loaded, as deleted
+// one, has no state
+func auditState(ctx *gin.Context, load auditLoader, entityId int) json.RawMessage {
+	if load == nil {
+		return nil
+	}
+
+	state, err := load(ctx.Request.Context(), entityId)
+	if err != nil {
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		logger.Errorf("failed to encode audit state: %s", err.Error())
+		return nil
+	}
+
+	return data
+}
+
+func (h *Handler) auditItem(_ context.Context, itemId int) (interface{}, error) {
+	return h.services.Items.GetById(itemId)
+}
+
+func (h *Handler) auditColor(_ context.Context, colorId int) (interface{}, error) {
+	return h.services.Colors.GetById(colorId)
+}
+
+func (h *Handler) auditCategory(_ context.Context, categoryId int) (interface{}, error) {
+	return h.services.Categories.GetById(categoryId)
+}
+
+func (h *Handler) auditCoupon(ctx context.Context, couponId int) (interface{}, error) {
+	return h.services.Coupons.GetById(ctx, couponId)
+}
+
+func (h *Handler) auditOrder(ctx context.Context, orderId int) (interface{}, error) {
+	return h.services.Orders.Get(ctx, orderId)
+}
+
+func (h *Handler) auditRole(ctx context.Context, roleId int) (interface{}, error) {
+	return h.services.Roles.GetById(ctx, roleId)
+}
+
+func (h *Handler) auditUserRoles(ctx context.Context, userId int) (interface{}, error) {
+	roles, err := h.services.Roles.GetUserRoles(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+
+	return map[string][]string{"roles": names}, nil
+}
+
+func (h *Handler) auditApiKey(ctx context.Context, keyId int) (interface{}, error) {
+	return h.services.ApiKeys.GetById(ctx, keyId)
+}
+
+func (h *Handler) auditImage(_ context.Context, imageId int) (interface{}, error) {
+	return h.services.Images.GetById(imageId)
+}
+
+func (h *Handler) auditLockout(ctx context.Context, userId int) (interface{}, error) {
+	return h.services.LoginAttempts.GetLockout(ctx, userId)
+}
+
+// @Summary Get audit log
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags audit-actions
+// @Description get administrative changes matching filters, the latest first
+// @Accept json
+// @Produce json
+// @Param actorId query int false "user id"
+// @Param apiKeyId query int false "api key id"
+// @Param action query string false "action, e.g. create, update, delete"
+// @Param entityType query string false "item, color, category, image, coupon, order, user, role or api_key"
+// @Param entityId query int false "entity id"
+// @Param from query string false "RFC 3339 time, inclusive"
+// @Param to query string false "RFC 3339 time, exclusive"
+// @Param limit query int false "page size, 50 by default, at most 500"
+// @Param offset query int false "number of entries to skip"
+// @Success 200 {array} models.AuditEntry
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit-log/ [get]
+func (h *Handler) getAuditLog(ctx *gin.Context) {
+	filter := models.AuditFilter{
+		Action:     ctx.Query("action"),
+		EntityType: ctx.Query("entityType"),
+		Limit:      defaultAuditLimit,
+	}
+
+	for param, target := range map[string]**int{
+		"actorId":  &filter.ActorId,
+		"apiKeyId": &filter.ApiKeyId,
+		"entityId": &filter.EntityId,
+	} {
+		if value := ctx.Query(param); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong " + param})
+				return
+			}
+			*target = &id
+		}
+	}
+
+	for param, target := range map[string]**time.Time{
+		"from": &filter.From,
+		"to":   &filter.To,
+	} {
+		if value := ctx.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong " + param})
+				return
+			}
+			// Column has no time zone and ignores offset, times are written in UTC
+			t = t.UTC()
+			*target = &t
+		}
+	}
+
+	if value := ctx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong limit"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if value := ctx.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong offset"})
+			return
+		}
+		filter.Offset = offset
+	}
+
+	entries, err := h.services.Audit.GetAll(ctx.Request.Context(), filter)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,294 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+	"strconv"
+)
+
+func (h *Handler) InitCartsRoutes(api *gin.RouterGroup) {
+	cart := api.Group("/cart", h.rateLimit("cart"), h.cartIdentity)
+	{
+		cart.GET("/", h.getCart)
+		cart.POST("/", h.addCartItem)
+		cart.DELETE("/", h.clearCart)
+		cart.POST("/coupon", h.applyCartCoupon)
+		cart.DELETE("/coupon", h.removeCartCoupon)
+		cart.PUT("/:id", h.updateCartItem)
+		cart.DELETE("/:id", h.deleteCartItem)
+	}
+}
+
+// @Summary Get cart
+// @Security UsersAuth
+// @Tags cart-actions
+// @Description get current user or guest cart with computed totals
+// @Accept json
+// @Produce json
+// @Param X-Cart-Token header string false "guest cart token"
+// @Success 200 {object} models.Cart
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/ [get]
+func (h *Handler) getCart(ctx *gin.Context) {
+	owner, err := getCartOwner(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	cart, err := h.services.Carts.Get(ctx.Request.Context(), owner)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, cart)
+}
+
+type addCartItemInput struct {
+	ItemId    int  `json:"itemId" binding:"required"`
+	ColorId   int  `json:"colorId" binding:"required"`
+	VariantId *int `json:"variantId"`
+	Quantity  int  `json:"quantity" binding:"required"`
+}
+
+// @Summary Add item to cart
+// @Security UsersAuth
+// @Tags cart-actions
+// @Description add item with chosen color and optional variant to cart, guest cart is created if there is no one
+// @Accept json
+// @Produce json
+// @Param X-Cart-Token header string false "guest cart token"
+// @Param input body addCartItemInput true "input body"
+// @Success 200 {object} models.Cart
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/ [post]
+func (h *Handler) addCartItem(ctx *gin.Context) {
+	var body addCartItemInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	owner, err := getCartOwner(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	token, err := h.services.Carts.AddItem(ctx.Request.Context(), owner, body.ItemId, body.ColorId, body.VariantId, body.Quantity)
+	if err != nil {
+		if errors.Is(err, models.ErrWrongQuantity) || errors.Is(err, models.ErrItemColorNotFound) ||
+			errors.Is(err, models.ErrItemVariantNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Remember new guest cart
+	if owner.IsGuest() && token != owner.Token {
+		ctx.SetCookie(cartTokenCookie, token, 2592000, "/", "localhost", false, true)
+		ctx.Set(cartTokenCtx, token)
+	}
+
+	h.getCart(ctx)
+}
+
+type updateCartItemInput struct {
+	Quantity int `json:"quantity" binding:"required"`
+}
+
+// @Summary Update cart item quantity
+// @Security UsersAuth
+// @Tags cart-actions
+// @Description change quantity of cart line
+// @Accept json
+// @Produce json
+// @Param X-Cart-Token header string false "guest cart token"
+// @Param id path int true "cart line id"
+// @Param input body updateCartItemInput true "input body"
+// @Success 200 {object} models.Cart
+// @Failure 400,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/{id} [put]
+func (h *Handler) updateCartItem(ctx *gin.Context) {
+	strLineId := ctx.Param("id")
+	lineId, err := strconv.Atoi(strLineId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var body updateCartItemInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	owner, err := getCartOwner(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Carts.UpdateQuantity(ctx.Request.Context(), owner, lineId, body.Quantity); err != nil {
+		switch {
+		case errors.Is(err, models.ErrWrongQuantity):
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrCartItemNotFound):
+			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	h.getCart(ctx)
+}
+
+// @Summary Delete cart item
+// @Security UsersAuth
+// @Tags cart-actions
+// @Description remove line from cart
+// @Accept json
+// @Produce json
+// @Param X-Cart-Token header string false "guest cart token"
+// @Param id path int true "cart line id"
+// @Success 200 {object} models.Cart
+// @Failure 400,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/{id} [delete]
+func (h *Handler) deleteCartItem(ctx *gin.Context) {
+	strLineId := ctx.Param("id")
+	lineId, err := strconv.Atoi(strLineId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	owner, err := getCartOwner(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Carts.DeleteItem(ctx.Request.Context(), owner, lineId); err != nil {
+		if errors.Is(err, models.ErrCartItemNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.getCart(ctx)
+}
+
+// @Summary Clear cart
+// @Security UsersAuth
+// @Tags cart-actions
+// @Description remove all lines from cart
+// @Accept json
+// @Produce json
+// @Param X-Cart-Token header string false "guest cart token"
+// @Success 200 ""
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/ [delete]
+func (h *Handler) clearCart(ctx *gin.Context) {
+	owner, err := getCartOwner(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Carts.Clear(ctx.Request.Context(), owner); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+type applyCouponInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// @Summary Apply coupon to cart
+// @Security UsersAuth
+// @Tags cart-actions
+// @Description apply discount code to cart, discount is shown per cart line
+// @Accept json
+// @Produce json
+// @Param X-Cart-Token header string false "guest cart token"
+// @Param input body applyCouponInput true "input body"
+// @Success 200 {object} models.Cart
+// @Failure 400,404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/coupon [post]
+func (h *Handler) applyCartCoupon(ctx *gin.Context) {
+	var body applyCouponInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	owner, err := getCartOwner(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Carts.ApplyCoupon(ctx.Request.Context(), owner, body.Code); err != nil {
+		h.abortWithCouponError(ctx, err)
+		return
+	}
+
+	h.getCart(ctx)
+}
+
+// @Summary Remove coupon from cart
+// @Security UsersAuth
+// @Tags cart-actions
+// @Description remove applied discount code from cart
+// @Accept json
+// @Produce json
+// @Param X-Cart-Token header string false "guest cart token"
+// @Success 200 {object} models.Cart
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/coupon [delete]
+func (h *Handler) removeCartCoupon(ctx *gin.Context) {
+	owner, err := getCartOwner(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Carts.RemoveCoupon(ctx.Request.Context(), owner); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.getCart(ctx)
+}
+
+// abortWithCouponError responds with reason why coupon cannot be used
+func (h *Handler) abortWithCouponError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrCouponNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrEmptyCart):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrCouponInactive), errors.Is(err, models.ErrCouponExhausted),
+		errors.Is(err, models.ErrCouponMinTotal), errors.Is(err, models.ErrCouponNotEligible):
+		ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
@@ -10,19 +10,27 @@ import (
 )
 
 func (h *Handler) InitCategoriesRoutes(api *gin.RouterGroup) {
-	categories := api.Group("/categories")
+	categories := api.Group("/categories", h.rateLimit("catalog"))
 	{
-		admins := categories.Group("/", h.userIdentity, h.adminIdentify)
+		admins := categories.Group("/", h.identity, h.requirePermission(models.PermissionCatalogWrite))
 		{
-			admins.POST("/create", h.createCategory)
-			admins.DELETE("/:id", h.deleteCategory)
-			admins.PUT("/:id", h.updateCategory)
+			admins.POST("/create", h.audit(models.AuditEntityCategory, "create", h.auditCategory), h.createCategory)
+			admins.DELETE("/:id", h.audit(models.AuditEntityCategory, "delete", h.auditCategory), h.deleteCategory)
+			admins.PUT("/:id", h.audit(models.AuditEntityCategory, "update", h.auditCategory), h.updateCategory)
+			admins.PUT("/:id/move", h.audit(models.AuditEntityCategory, "move", h.auditCategory), h.moveCategory)
 		}
 		categories.GET("/", h.getAllCategories)
 		categories.GET("/:id", h.getCategoryById)
 	}
 }
 
+type createCategoryInput struct {
+	Name     string `json:"name" binding:"required"`
+	Slug     string `json:"slug"`
+	ParentId *int   `json:"parentId"`
+	Position int    `json:"position"`
+}
+
 type CreateCategoryResult struct {
 	CategoryId int `json:"categoryId"`
 }
@@ -30,41 +38,53 @@ type CreateCategoryResult struct {
 // @Summary Create a new category
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags categories-actions
-// @Description create a new category
+// @Description create a new category, root category is created without parent id. Slug is made from name if it is empty
 // @Accept json
 // @Produce json
-// @Param input body models.Category true "input body"
+// @Param input body createCategoryInput true "input body"
 // @Success 200 {object} CreateCategoryResult
-// @Failure 400 {object} ErrorResponse
+// @Failure 400,409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /categories/create [post]
 func (h *Handler) createCategory(ctx *gin.Context) {
-	var category models.Category
-	if err := ctx.BindJSON(&category); err != nil {
+	var body createCategoryInput
+	if err := ctx.BindJSON(&body); err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	categoryId, err := h.services.Categories.Create(category.Name)
+	if body.ParentId != nil {
+		if exist, err := h.services.Categories.Exist(*body.ParentId); err != nil || !exist {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong parent category id"})
+			return
+		}
+	}
+
+	categoryId, err := h.services.Categories.Create(body.Name, body.Slug, body.ParentId, body.Position)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		h.abortWithCategoryError(ctx, err)
 		return
 	}
 
+	setAuditEntity(ctx, categoryId)
 	ctx.JSON(http.StatusOK, CreateCategoryResult{CategoryId: categoryId})
 }
 
 // @Summary Delete category
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags categories-actions
-// @Description delete category by id
+// @Description delete category by id. Its children move one level up, its items move to moveTo category
+// @Description or to the parent category. Root category with items cannot be deleted without moveTo
 // @Accept json
 // @Produce json
 // @Param id path int true "category id"
+// @Param moveTo query int false "category id to move items to"
 // @Success 200 ""
-// @Failure 400 {object} ErrorResponse
+// @Failure 400,404,409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /categories/{id} [delete]
 func (h *Handler) deleteCategory(ctx *gin.Context) {
@@ -75,8 +95,22 @@ func (h *Handler) deleteCategory(ctx *gin.Context) {
 		return
 	}
 
-	if err := h.services.Categories.Delete(categoryId); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	var moveTo *int
+	if value := ctx.Query("moveTo"); value != "" {
+		moveToId, err := strconv.Atoi(value)
+		if err != nil || moveToId == categoryId {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong moveTo category id"})
+			return
+		}
+		if exist, err := h.services.Categories.Exist(moveToId); err != nil || !exist {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong moveTo category id"})
+			return
+		}
+		moveTo = &moveToId
+	}
+
+	if err := h.services.Categories.Delete(categoryId, moveTo); err != nil {
+		h.abortWithCategoryError(ctx, err)
 		return
 	}
 
@@ -85,6 +119,7 @@ func (h *Handler) deleteCategory(ctx *gin.Context) {
 
 type updateCategoryInput struct {
 	Name string `json:"name" binding:"required"`
+	Slug string `json:"slug"`
 }
 
 func (u *updateCategoryInput) isValid() error {
@@ -98,14 +133,15 @@ func (u *updateCategoryInput) isValid() error {
 // @Summary Update category
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags categories-actions
-// @Description update category by id
+// @Description update category name and slug by id, slug is made from name if it is empty
 // @Accept json
 // @Produce json
 // @Param id path int true "category id"
 // @Param input body updateCategoryInput true "name info"
 // @Success 200 ""
-// @Failure 400,404 {object} ErrorResponse
+// @Failure 400,404,409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /categories/{id} [put]
 func (h *Handler) updateCategory(ctx *gin.Context) {
@@ -136,8 +172,8 @@ func (h *Handler) updateCategory(ctx *gin.Context) {
 		return
 	}
 
-	if err := h.services.Categories.Update(categoryId, body.Name); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	if err := h.services.Categories.Update(categoryId, body.Name, body.Slug); err != nil {
+		h.abortWithCategoryError(ctx, err)
 		return
 	}
 
@@ -146,9 +182,10 @@ func (h *Handler) updateCategory(ctx *gin.Context) {
 
 // @Summary Get category by id
 // @Tags categories-actions
-// @Description get category by id
+// @Description get category by id with breadcrumbs from the root category and direct children
 // @Accept json
 // @Produce json
+// @Param id path int true "category id"
 // @Success 200 {object} models.Category
 // @Failure 400,404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -180,14 +217,27 @@ func (h *Handler) getCategoryById(ctx *gin.Context) {
 
 // @Summary Get all categories
 // @Tags categories-actions
-// @Description get all categories
+// @Description get all categories as flat list or as tree of root categories with nested children
 // @Accept json
 // @Produce json
+// @Param tree query bool false "return categories tree"
 // @Success 200 {array} models.Category
+// @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /categories/ [get]
 func (h *Handler) getAllCategories(ctx *gin.Context) {
-	categories, err := h.services.Categories.GetAll()
+	tree, err := strconv.ParseBool(ctx.DefaultQuery("tree", "false"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong tree"})
+		return
+	}
+
+	var categories []models.Category
+	if tree {
+		categories, err = h.services.Categories.GetTree()
+	} else {
+		categories, err = h.services.Categories.GetAll()
+	}
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
@@ -195,3 +245,66 @@ func (h *Handler) getAllCategories(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, categories)
 }
+
+type moveCategoryInput struct {
+	ParentId *int `json:"parentId"`
+	Position int  `json:"position"`
+}
+
+// @Summary Move category
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags categories-actions
+// @Description move category with its subtree under another parent, empty parent id makes category root
+// @Accept json
+// @Produce json
+// @Param id path int true "category id"
+// @Param input body moveCategoryInput true "new parent and position"
+// @Success 200 ""
+// @Failure 400,404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /categories/{id}/move [put]
+func (h *Handler) moveCategory(ctx *gin.Context) {
+	strCategoryId := ctx.Param("id")
+	categoryId, err := strconv.Atoi(strCategoryId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var body moveCategoryInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if body.ParentId != nil {
+		if exist, err := h.services.Categories.Exist(*body.ParentId); err != nil || !exist {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong parent category id"})
+			return
+		}
+	}
+
+	if err := h.services.Categories.Move(categoryId, body.ParentId, body.Position); err != nil {
+		h.abortWithCategoryError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (h *Handler) abortWithCategoryError(ctx *gin.Context, err error) {
+	var uniqueErr models.ErrUniqueValue
+	switch {
+	case errors.Is(err, models.ErrWrongSlug):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrCategoryNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrCategoryCycle), errors.Is(err, models.ErrCategoryHasItems),
+		errors.Is(err, models.ErrCategoryHasCoupons), errors.As(err, &uniqueErr):
+		ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
@@ -4,19 +4,20 @@ import (
 	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"shop_backend/internal/models"
 	"strconv"
 )
 
 func (h *Handler) InitColorsRoutes(api *gin.RouterGroup) {
-	colors := api.Group("/colors")
+	colors := api.Group("/colors", h.rateLimit("catalog"))
 	{
-		admins := colors.Group("/", h.userIdentity, h.adminIdentify)
+		admins := colors.Group("/", h.identity, h.requirePermission(models.PermissionCatalogWrite))
 		{
-			admins.POST("/all/:id", h.addColorToItems)
-			admins.DELETE("/all/:id", h.deleteColorFromItems)
-			admins.POST("/create", h.createColor)
-			admins.PUT("/:id", h.updateColor)
-			admins.DELETE("/:id", h.deleteColor)
+			admins.POST("/all/:id", h.audit(models.AuditEntityColor, "add_to_items", h.auditColor), h.addColorToItems)
+			admins.DELETE("/all/:id", h.audit(models.AuditEntityColor, "delete_from_items", h.auditColor), h.deleteColorFromItems)
+			admins.POST("/create", h.audit(models.AuditEntityColor, "create", h.auditColor), h.createColor)
+			admins.PUT("/:id", h.audit(models.AuditEntityColor, "update", h.auditColor), h.updateColor)
+			admins.DELETE("/:id", h.audit(models.AuditEntityColor, "delete", h.auditColor), h.deleteColor)
 		}
 
 		colors.GET("/", h.getAllColors)
@@ -34,6 +35,7 @@ type createColor struct {
 // @Summary Create a new color
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags colors-actions
 // @Description create a new color
 // @Accept json
@@ -56,6 +58,7 @@ func (h *Handler) createColor(ctx *gin.Context) {
 		return
 	}
 
+	setAuditEntity(ctx, colorId)
 	ctx.JSON(http.StatusOK, CreateColorResult{ColorId: colorId})
 }
 
@@ -68,6 +71,7 @@ type updateColorInput struct {
 // @Summary Update color
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags colors-actions
 // @Description update color
 // @Accept json
@@ -111,6 +115,7 @@ func (h *Handler) updateColor(ctx *gin.Context) {
 // @Summary Delete colors
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags colors-actions
 // @Description delete color by id
 // @Accept json
@@ -139,6 +144,7 @@ func (h *Handler) deleteColor(ctx *gin.Context) {
 // @Summary Delete color from all items
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags colors-actions
 // @Description delete color by id from all items
 // @Accept json
@@ -167,6 +173,7 @@ func (h *Handler) deleteColorFromItems(ctx *gin.Context) {
 // @Summary Add color to all items
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags colors-actions
 // @Description Add color by id to all items
 // @Accept json
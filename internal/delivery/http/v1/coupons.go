@@ -0,0 +1,246 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+	"strconv"
+	"time"
+)
+
+func (h *Handler) InitCouponsRoutes(api *gin.RouterGroup) {
+	coupons := api.Group("/coupons", h.rateLimit("coupons"), h.identity, h.requirePermission(models.PermissionCouponsManage))
+	{
+		coupons.GET("/", h.getAllCoupons)
+		coupons.POST("/", h.audit(models.AuditEntityCoupon, "create", h.auditCoupon), h.createCoupon)
+		coupons.GET("/:id", h.getCouponById)
+		coupons.PUT("/:id", h.audit(models.AuditEntityCoupon, "update", h.auditCoupon), h.updateCoupon)
+		coupons.DELETE("/:id", h.audit(models.AuditEntityCoupon, "delete", h.auditCoupon), h.deleteCoupon)
+	}
+}
+
+type couponInput struct {
+	Code         string            `json:"code" binding:"required"`
+	Kind         models.CouponKind `json:"kind" binding:"required"`
+	Value        float64           `json:"value"`
+	MinTotal     float64           `json:"minTotal"`
+	StartsAt     *time.Time        `json:"startsAt"`
+	ExpiresAt    *time.Time        `json:"expiresAt"`
+	UsageLimit   *int              `json:"usageLimit"`
+	PerUserLimit *int              `json:"perUserLimit"`
+	Categories   []int             `json:"categories"`
+	Tags         []string          `json:"tags"`
+}
+
+func (i couponInput) toCoupon(id int) models.Coupon {
+	return models.Coupon{
+		Id:           id,
+		Code:         i.Code,
+		Kind:         i.Kind,
+		Value:        i.Value,
+		MinTotal:     i.MinTotal,
+		StartsAt:     i.StartsAt,
+		ExpiresAt:    i.ExpiresAt,
+		UsageLimit:   i.UsageLimit,
+		PerUserLimit: i.PerUserLimit,
+		Categories:   i.Categories,
+		Tags:         i.Tags,
+	}
+}
+
+// validateCategories checks that coupon restrictions point to existing categories
+func (h *Handler) validateCategories(categories []int) error {
+	for _, categoryId := range categories {
+		if exist, err := h.services.Categories.Exist(categoryId); err != nil || !exist {
+			return fmt.Errorf("wrong category[%d] id", categoryId)
+		}
+	}
+
+	return nil
+}
+
+type CreateCouponResult struct {
+	CouponId int `json:"couponId"`
+}
+
+// @Summary Create coupon
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags coupons-actions
+// @Description create discount code, kind is one of percent, fixed, free_shipping
+// @Accept json
+// @Produce json
+// @Param input body couponInput true "input body"
+// @Success 201 {object} CreateCouponResult
+// @Failure 400,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /coupons/ [post]
+func (h *Handler) createCoupon(ctx *gin.Context) {
+	var body couponInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.validateCategories(body.Categories); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	couponId, err := h.services.Coupons.Create(ctx.Request.Context(), body.toCoupon(0))
+	if err != nil {
+		h.abortWithCouponTermsError(ctx, err)
+		return
+	}
+
+	setAuditEntity(ctx, couponId)
+	ctx.JSON(http.StatusCreated, CreateCouponResult{CouponId: couponId})
+}
+
+// @Summary Get all coupons
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags coupons-actions
+// @Description get all coupons with their usage
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.Coupon
+// @Failure 500 {object} ErrorResponse
+// @Router /coupons/ [get]
+func (h *Handler) getAllCoupons(ctx *gin.Context) {
+	coupons, err := h.services.Coupons.GetAll(ctx.Request.Context())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, coupons)
+}
+
+// @Summary Get coupon by id
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags coupons-actions
+// @Description get coupon by id
+// @Accept json
+// @Produce json
+// @Param id path int true "coupon id"
+// @Success 200 {object} models.Coupon
+// @Failure 400,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /coupons/{id} [get]
+func (h *Handler) getCouponById(ctx *gin.Context) {
+	strCouponId := ctx.Param("id")
+	couponId, err := strconv.Atoi(strCouponId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	coupon, err := h.services.Coupons.GetById(ctx.Request.Context(), couponId)
+	if err != nil {
+		if errors.Is(err, models.ErrCouponNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, coupon)
+}
+
+// @Summary Update coupon
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags coupons-actions
+// @Description replace coupon terms and restrictions, usage counter is kept
+// @Accept json
+// @Produce json
+// @Param id path int true "coupon id"
+// @Param input body couponInput true "input body"
+// @Success 200 ""
+// @Failure 400,404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /coupons/{id} [put]
+func (h *Handler) updateCoupon(ctx *gin.Context) {
+	strCouponId := ctx.Param("id")
+	couponId, err := strconv.Atoi(strCouponId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var body couponInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.validateCategories(body.Categories); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Coupons.Update(ctx.Request.Context(), body.toCoupon(couponId)); err != nil {
+		h.abortWithCouponTermsError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// @Summary Delete coupon
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags coupons-actions
+// @Description delete coupon, orders keep its code and discount
+// @Accept json
+// @Produce json
+// @Param id path int true "coupon id"
+// @Success 200 ""
+// @Failure 400,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /coupons/{id} [delete]
+func (h *Handler) deleteCoupon(ctx *gin.Context) {
+	strCouponId := ctx.Param("id")
+	couponId, err := strconv.Atoi(strCouponId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Coupons.Delete(ctx.Request.Context(), couponId); err != nil {
+		if errors.Is(err, models.ErrCouponNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (h *Handler) abortWithCouponTermsError(ctx *gin.Context, err error) {
+	var uniqueErr models.ErrUniqueValue
+	switch {
+	case errors.Is(err, models.ErrCouponTerms), errors.Is(err, models.ErrCouponKind):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrCouponNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.As(err, &uniqueErr):
+		ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
@@ -0,0 +1,75 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+)
+
+type userConfirmEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// @Summary User confirm email
+// @Tags users-auth
+// @Description verify email by token from verification email, pending email replaces current one
+// @Accept  json
+// @Produce  json
+// @Param input body userConfirmEmailInput true "verification token"
+// @Success 200 ""
+// @Failure 400,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/email/confirm [post]
+func (h *Handler) userConfirmEmail(ctx *gin.Context) {
+	var body userConfirmEmailInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Users.ConfirmEmail(ctx.Request.Context(), body.Token); err != nil {
+		var uniqueErr models.ErrUniqueValue
+		switch {
+		case errors.Is(err, models.ErrInvalidToken):
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case errors.As(err, &uniqueErr):
+			ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// @Summary User resend verification
+// @Security UsersAuth
+// @Tags users-auth
+// @Description send new verification link to pending or not yet verified email of current user
+// @Accept  json
+// @Produce  json
+// @Success 200 ""
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/email/resend [post]
+func (h *Handler) userResendVerification(ctx *gin.Context) {
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Users.ResendVerification(ctx.Request.Context(), userId); err != nil {
+		if errors.Is(err, models.ErrEmailVerified) {
+			ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
@@ -5,19 +5,29 @@ import (
 	"shop_backend/internal/config"
 	"shop_backend/internal/service"
 	"shop_backend/pkg/auth"
+	"shop_backend/pkg/limiter"
 )
 
 type Handler struct {
 	services     *service.Services
 	cfg          *config.Config
 	tokenManager auth.TokenManager
+	limiterStore limiter.Store
+
+	signInIPLimiter    *limiter.Limiter
+	signInLoginLimiter *limiter.Limiter
 }
 
-func NewHandler(services *service.Services, cfg *config.Config, tokenManager auth.TokenManager) *Handler {
+func NewHandler(services *service.Services, cfg *config.Config, tokenManager auth.TokenManager, limiterStore limiter.Store) *Handler {
+	limits := cfg.Auth.SignInLimits
+
 	return &Handler{
-		services:     services,
-		cfg:          cfg,
-		tokenManager: tokenManager,
+		services:           services,
+		cfg:                cfg,
+		tokenManager:       tokenManager,
+		limiterStore:       limiterStore,
+		signInIPLimiter:    limiter.New(limiterStore, limits.IP.Limit, limits.IP.Window).WithDelay(limits.IP.Delay, limits.IP.MaxDelay),
+		signInLoginLimiter: limiter.New(limiterStore, limits.Login.Limit, limits.Login.Window).WithDelay(limits.Login.Delay, limits.Login.MaxDelay),
 	}
 }
 
@@ -29,5 +39,13 @@ func (h *Handler) Init(api *gin.RouterGroup) {
 		h.InitColorsRoutes(v1)
 		h.InitCategoriesRoutes(v1)
 		h.InitImagesRoutes(v1)
+		h.InitCartsRoutes(v1)
+		h.InitOrdersRoutes(v1)
+		h.InitPaymentsRoutes(v1)
+		h.InitCouponsRoutes(v1)
+		h.InitRolesRoutes(v1)
+		h.InitLoginAttemptsRoutes(v1)
+		h.InitApiKeysRoutes(v1)
+		h.InitAuditRoutes(v1)
 	}
 }
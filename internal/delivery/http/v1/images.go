@@ -3,17 +3,18 @@ package v1
 import (
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"shop_backend/internal/models"
 	"strconv"
 )
 
 func (h *Handler) InitImagesRoutes(api *gin.RouterGroup) {
-	images := api.Group("/images")
+	images := api.Group("/images", h.rateLimit("catalog"))
 	{
-		admins := images.Group("/", h.userIdentity, h.adminIdentify)
+		admins := images.Group("/", h.identity, h.requirePermission(models.PermissionImagesWrite))
 		{
-			admins.POST("/", h.uploadFile)
+			admins.POST("/", h.audit(models.AuditEntityImage, "create", h.auditImage), h.uploadFile)
 			admins.GET("/", h.getAllImages)
-			admins.DELETE("/:id", h.deleteImage)
+			admins.DELETE("/:id", h.audit(models.AuditEntityImage, "delete", h.auditImage), h.deleteImage)
 		}
 
 	}
@@ -22,6 +23,7 @@ func (h *Handler) InitImagesRoutes(api *gin.RouterGroup) {
 // @Summary Upload image
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags images-actions
 // @Description upload image
 // @Accept json
@@ -44,12 +46,14 @@ func (h *Handler) uploadFile(ctx *gin.Context) {
 		return
 	}
 
+	setAuditEntity(ctx, id)
 	ctx.JSON(http.StatusOK, UploadFileResponse{Id: id})
 }
 
 // @Summary Get all images
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags images-actions
 // @Description get all images
 // @Accept json
@@ -74,6 +78,7 @@ func (h *Handler) getAllImages(ctx *gin.Context) {
 // @Summary Delete image
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags images-actions
 // @Description delete image by id
 // @Accept json
@@ -1,23 +1,30 @@
 package v1
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"shop_backend/internal/models"
 	"strconv"
+	"strings"
 )
 
 func (h *Handler) InitItemsRoutes(api *gin.RouterGroup) {
-	items := api.Group("/items")
+	items := api.Group("/items", h.rateLimit("catalog"))
 	{
-		admins := items.Group("/", h.userIdentity, h.adminIdentify)
+		admins := items.Group("/", h.identity, h.requirePermission(models.PermissionCatalogWrite))
 		{
-			admins.POST("/create", h.createItem)
-			admins.PUT("/:id", h.updateItems)
-			admins.DELETE("/:id", h.deleteItem)
+			admins.POST("/create", h.audit(models.AuditEntityItem, "create", h.auditItem), h.createItem)
+			admins.PUT("/:id", h.audit(models.AuditEntityItem, "update", h.auditItem), h.updateItems)
+			admins.DELETE("/:id", h.audit(models.AuditEntityItem, "delete", h.auditItem), h.deleteItem)
+			admins.POST("/:id/stock", h.audit(models.AuditEntityItem, "adjust_stock", h.auditItem), h.adjustItemStock)
+			admins.GET("/:id/stock", h.getItemStockMovements)
 		}
 
+		items.GET("/", h.listItems)
 		items.GET("/new", h.getNewItems)
+		items.GET("/search", h.searchItems)
 		items.GET("/:id", h.getItemById)
 		items.GET("/sku/:sku", h.getItemBySku)
 		items.GET("/category/:id", h.getItemsByCategory)
@@ -27,26 +34,71 @@ func (h *Handler) InitItemsRoutes(api *gin.RouterGroup) {
 }
 
 type createItemInput struct {
-	Name        string   `json:"name" binding:"required"`
-	Description string   `json:"description" binding:"required"`
-	CategoryId  int      `json:"categoryId" binding:"required"`
-	Tags        []string `json:"tags"`
-	ColorsId    []int    `json:"colors" binding:"required"`
-	Price       float64  `json:"price" binding:"required"`
-	Sku         string   `json:"sku" binding:"required"`
-	ImagesId    []int    `json:"images" binding:"required"`
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description" binding:"required"`
+	CategoryId  int            `json:"categoryId" binding:"required"`
+	Tags        []string       `json:"tags"`
+	ColorsId    []int          `json:"colors" binding:"required"`
+	Price       float64        `json:"price" binding:"required"`
+	Sku         string         `json:"sku" binding:"required"`
+	ImagesId    []int          `json:"images" binding:"required"`
+	Variants    []variantInput `json:"variants"`
+}
+
+type variantInput struct {
+	Sku      string            `json:"sku" binding:"required"`
+	Price    *float64          `json:"price"`
+	Stock    *int              `json:"stock"`
+	Options  map[string]string `json:"options" binding:"required"`
+	ImagesId []int             `json:"images"`
+}
+
+func toVariants(inputs []variantInput) []models.Variant {
+	variants := make([]models.Variant, 0, len(inputs))
+	for _, input := range inputs {
+		variant := models.Variant{
+			Sku:     input.Sku,
+			Price:   input.Price,
+			Stock:   input.Stock,
+			Options: input.Options,
+		}
+		for _, imageId := range input.ImagesId {
+			variant.Images = append(variant.Images, models.Image{Id: imageId})
+		}
+		variants = append(variants, variant)
+	}
+
+	return variants
+}
+
+// validateVariants checks that variant images exist and stock is not negative
+func (h *Handler) validateVariants(variants []variantInput) error {
+	for _, variant := range variants {
+		if variant.Stock != nil && *variant.Stock < 0 {
+			return fmt.Errorf("wrong variant %s stock", variant.Sku)
+		}
+
+		for _, imageId := range variant.ImagesId {
+			if exist, err := h.services.Images.Exist(imageId); err != nil || !exist {
+				return fmt.Errorf("wrong image[%d] id", imageId)
+			}
+		}
+	}
+
+	return nil
 }
 
 // @Summary Create a new item
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags items-actions
 // @Description create a new item
 // @Accept json
 // @Produce json
 // @Param input body createItemInput true "input body"
 // @Success 200 {object} models.Item
-// @Failure 400 {object} ErrorResponse
+// @Failure 400,409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /items/create [post]
 func (h *Handler) createItem(ctx *gin.Context) {
@@ -85,6 +137,12 @@ func (h *Handler) createItem(ctx *gin.Context) {
 		}
 	}
 
+	// Check variants
+	if err := h.validateVariants(body.Variants); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// Create item
 	itemId, err := h.services.Items.Create(body.Name, body.Description, body.CategoryId, body.Sku, body.Price)
 	if err != nil {
@@ -115,16 +173,22 @@ func (h *Handler) createItem(ctx *gin.Context) {
 		return
 	}
 
-	// Return created item
-	item, _ := h.services.Items.GetById(itemId)
+	// Save variants if more than zero
+	if len(body.Variants) > 0 {
+		if err := h.services.Items.SetVariants(itemId, toVariants(body.Variants)); err != nil {
+			h.abortWithVariantsError(ctx, err)
+			return
+		}
+	}
+
+	setAuditEntity(ctx, itemId)
 
-	// Get category and set
-	category, err := h.services.Categories.GetById(item.Category.Id)
+	// Return created item
+	item, err := h.services.Items.GetById(itemId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	item.Category = category
 
 	ctx.JSON(http.StatusOK, item)
 }
@@ -144,17 +208,176 @@ func (h *Handler) getNewItems(ctx *gin.Context) {
 		return
 	}
 
-	for i := range items {
-		category, err := h.services.Categories.GetById(items[i].Category.Id)
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	ctx.JSON(http.StatusOK, items)
+}
+
+// @Summary List items
+// @Tags items-actions
+// @Description filtered and sorted item listing with cursor pagination and facet counts.
+// @Description Tags and colors can be repeated or comma separated, item matches if it has any of them
+// @Accept json
+// @Produce json
+// @Param category query int false "category id"
+// @Param descendants query bool false "include items of subcategories"
+// @Param tags query []string false "tag names"
+// @Param colors query []int false "color ids"
+// @Param minPrice query number false "min price"
+// @Param maxPrice query number false "max price"
+// @Param inStock query bool false "only items in stock"
+// @Param sort query string false "newest (default), price_asc, price_desc, name"
+// @Param cursor query string false "nextCursor of previous page"
+// @Param limit query int false "page size, 20 by default"
+// @Success 200 {object} models.ItemsPage
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /items/ [get]
+func (h *Handler) listItems(ctx *gin.Context) {
+	query, err := parseItemsQuery(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	page, err := h.services.Items.List(query)
+	if err != nil {
+		if errors.Is(err, models.ErrWrongItemsSort) || errors.Is(err, models.ErrInvalidCursor) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 
-		items[i].Category = category
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
 	}
 
-	ctx.JSON(http.StatusOK, items)
+	ctx.JSON(http.StatusOK, page)
+}
+
+func parseItemsQuery(ctx *gin.Context) (models.ItemsQuery, error) {
+	query := models.ItemsQuery{
+		Sort: models.ItemsSort(ctx.Query("sort")),
+	}
+
+	if value := ctx.Query("category"); value != "" {
+		categoryId, err := strconv.Atoi(value)
+		if err != nil {
+			return models.ItemsQuery{}, errors.New("wrong category id")
+		}
+		query.Filter.CategoryId = &categoryId
+	}
+
+	if value := ctx.Query("descendants"); value != "" {
+		descendants, err := strconv.ParseBool(value)
+		if err != nil {
+			return models.ItemsQuery{}, errors.New("wrong descendants")
+		}
+		query.Filter.Descendants = descendants
+	}
+
+	query.Filter.Tags = queryList(ctx, "tags")
+
+	for _, value := range queryList(ctx, "colors") {
+		colorId, err := strconv.Atoi(value)
+		if err != nil {
+			return models.ItemsQuery{}, fmt.Errorf("wrong color[%s] id", value)
+		}
+		query.Filter.ColorsId = append(query.Filter.ColorsId, colorId)
+	}
+
+	if value := ctx.Query("minPrice"); value != "" {
+		minPrice, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return models.ItemsQuery{}, errors.New("wrong minPrice")
+		}
+		query.Filter.MinPrice = &minPrice
+	}
+
+	if value := ctx.Query("maxPrice"); value != "" {
+		maxPrice, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return models.ItemsQuery{}, errors.New("wrong maxPrice")
+		}
+		query.Filter.MaxPrice = &maxPrice
+	}
+
+	if value := ctx.Query("inStock"); value != "" {
+		inStock, err := strconv.ParseBool(value)
+		if err != nil {
+			return models.ItemsQuery{}, errors.New("wrong inStock")
+		}
+		query.Filter.InStock = inStock
+	}
+
+	if value := ctx.Query("cursor"); value != "" {
+		cursor, err := models.DecodeItemsCursor(value)
+		if err != nil {
+			return models.ItemsQuery{}, err
+		}
+		query.Cursor = &cursor
+	}
+
+	if value := ctx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return models.ItemsQuery{}, errors.New("wrong limit")
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+// queryList collects values of repeated and comma separated query parameter
+func queryList(ctx *gin.Context, key string) []string {
+	var values []string
+	for _, param := range ctx.QueryArray(key) {
+		for _, value := range strings.Split(param, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+
+	return values
+}
+
+// @Summary Search items
+// @Tags items-actions
+// @Description full-text search over item name, description, tags and category name.
+// @Description Words are matched by prefix, highlight is HTML escaped with matches wrapped into <mark></mark>
+// @Accept json
+// @Produce json
+// @Param q query string true "search text"
+// @Param limit query int false "max results, 20 by default"
+// @Param offset query int false "results to skip"
+// @Success 200 {array} models.SearchResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /items/search [get]
+func (h *Handler) searchItems(ctx *gin.Context) {
+	text := strings.TrimSpace(ctx.Query("q"))
+	if text == "" {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "empty search query"})
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "0"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong limit"})
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong offset"})
+		return
+	}
+
+	results, err := h.services.Items.Search(text, limit, offset)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, results)
 }
 
 // @Summary Get item by ID
@@ -180,23 +403,16 @@ func (h *Handler) getItemById(ctx *gin.Context) {
 		return
 	}
 
-	category, err := h.services.Categories.GetById(item.Category.Id)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
-		return
-	}
-
-	item.Category = category
-
 	ctx.JSON(http.StatusOK, item)
 }
 
 // @Summary Get items with category
 // @Tags items-actions
-// @Description get all items with provided category id
+// @Description get all items with provided category id, with descendants items of subcategories are included
 // @Accept json
 // @Produce json
 // @Param id path int true "category id"
+// @Param descendants query bool false "include items of subcategories"
 // @Success 200 {array} models.Item
 // @Failure 400 {object} ErrorResponse
 // @Router /items/category/{id} [get]
@@ -208,22 +424,18 @@ func (h *Handler) getItemsByCategory(ctx *gin.Context) {
 		return
 	}
 
-	items, err := h.services.Items.GetByCategory(categoryId)
+	descendants, err := strconv.ParseBool(ctx.DefaultQuery("descendants", "false"))
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong descendants"})
 		return
 	}
 
-	category, err := h.services.Categories.GetById(categoryId)
+	items, err := h.services.Items.GetByCategory(categoryId, descendants)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	for i := range items {
-		items[i].Category = category
-	}
-
 	ctx.JSON(http.StatusOK, items)
 }
 
@@ -248,21 +460,12 @@ func (h *Handler) getItemsByTag(ctx *gin.Context) {
 		return
 	}
 
-	for i := range items {
-		category, err := h.services.Categories.GetById(items[i].Category.Id)
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-			return
-		}
-		items[i].Category = category
-	}
-
 	ctx.JSON(http.StatusOK, items)
 }
 
 // @Summary Get item by SKU
 // @Tags items-actions
-// @Description get item by sku
+// @Description get item by item or variant sku, selected variant is returned in variant field
 // @Accept json
 // @Produce json
 // @Param sku path string true "item sku"
@@ -282,20 +485,13 @@ func (h *Handler) getItemBySku(ctx *gin.Context) {
 		return
 	}
 
-	category, err := h.services.Categories.GetById(item.Category.Id)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
-		return
-	}
-
-	item.Category = category
-
 	ctx.JSON(http.StatusOK, item)
 }
 
 // @Summary Delete item
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags items-actions
 // @Description delete item by id
 // @Accept json
@@ -322,19 +518,21 @@ func (h *Handler) deleteItem(ctx *gin.Context) {
 }
 
 type updateItemInput struct {
-	Name        string   `json:"name" binding:"required"`
-	Description string   `json:"description" binding:"required"`
-	CategoryId  int      `json:"categoryId" binding:"required"`
-	Tags        []string `json:"tags"`
-	ColorsId    []int    `json:"colors" binding:"required"`
-	Price       float64  `json:"price" binding:"required"`
-	Sku         string   `json:"sku" binding:"required"`
-	ImagesId    []int    `json:"images" binding:"required"`
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description" binding:"required"`
+	CategoryId  int            `json:"categoryId" binding:"required"`
+	Tags        []string       `json:"tags"`
+	ColorsId    []int          `json:"colors" binding:"required"`
+	Price       float64        `json:"price" binding:"required"`
+	Sku         string         `json:"sku" binding:"required"`
+	ImagesId    []int          `json:"images" binding:"required"`
+	Variants    []variantInput `json:"variants"`
 }
 
 // @Summary Update item
 // @Security UsersAuth
 // @Security AdminAuth
+// @Security ApiKeyAuth
 // @Tags items-actions
 // @Description update item
 // @Accept json
@@ -342,7 +540,7 @@ type updateItemInput struct {
 // @Param id path string true "item id"
 // @Param input body updateItemInput true "item body"
 // @Success 200 {object} models.Item
-// @Failure 400 {object} ErrorResponse
+// @Failure 400,409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /items/{id} [put]
 func (h *Handler) updateItems(ctx *gin.Context) {
@@ -393,6 +591,12 @@ func (h *Handler) updateItems(ctx *gin.Context) {
 		}
 	}
 
+	// Check variants
+	if err := h.validateVariants(body.Variants); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// Update item
 	if err := h.services.Items.Update(itemId, body.Name, body.Description,
 		body.CategoryId, body.Tags, body.ColorsId, body.Price, body.Sku, body.ImagesId); err != nil {
@@ -400,16 +604,116 @@ func (h *Handler) updateItems(ctx *gin.Context) {
 		return
 	}
 
-	// Return created item
-	item, _ := h.services.Items.GetById(itemId)
+	// Replace variants only if they were provided
+	if body.Variants != nil {
+		if err := h.services.Items.SetVariants(itemId, toVariants(body.Variants)); err != nil {
+			h.abortWithVariantsError(ctx, err)
+			return
+		}
+	}
 
-	// Get category and set
-	category, err := h.services.Categories.GetById(item.Category.Id)
+	// Return created item
+	item, err := h.services.Items.GetById(itemId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	item.Category = category
 
 	ctx.JSON(http.StatusOK, item)
 }
+
+func (h *Handler) abortWithVariantsError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrVariantOptions):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrSkuTaken):
+		ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
+
+type adjustItemStockInput struct {
+	ColorId int    `json:"colorId" binding:"required"`
+	Delta   int    `json:"delta" binding:"required"`
+	Reason  string `json:"reason" binding:"required"`
+}
+
+// @Summary Adjust item stock
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags items-actions
+// @Description change stock of item color by delta with reason
+// @Accept json
+// @Produce json
+// @Param id path int true "item id"
+// @Param input body adjustItemStockInput true "stock info"
+// @Success 200 {object} models.Item
+// @Failure 400,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /items/{id}/stock [post]
+func (h *Handler) adjustItemStock(ctx *gin.Context) {
+	strItemId := ctx.Param("id")
+	itemId, err := strconv.Atoi(strItemId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var body adjustItemStockInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userId, err := getActorId(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Items.AdjustStock(itemId, body.ColorId, body.Delta, body.Reason, userId); err != nil {
+		switch {
+		case errors.Is(err, models.ErrItemColorNotFound):
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrNegativeStock):
+			ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	h.getItemById(ctx)
+}
+
+// @Summary Get item stock movements
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags items-actions
+// @Description get history of item stock changes
+// @Accept json
+// @Produce json
+// @Param id path int true "item id"
+// @Success 200 {array} models.StockMovement
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /items/{id}/stock [get]
+func (h *Handler) getItemStockMovements(ctx *gin.Context) {
+	strItemId := ctx.Param("id")
+	itemId, err := strconv.Atoi(strItemId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	movements, err := h.services.Items.GetStockMovements(itemId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, movements)
+}
@@ -0,0 +1,177 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+	"strconv"
+)
+
+const (
+	defaultLoginAttemptsLimit = 50
+	maxLoginAttemptsLimit     = 500
+)
+
+func (h *Handler) InitLoginAttemptsRoutes(api *gin.RouterGroup) {
+	admins := api.Group("/", h.rateLimit("security"), h.userIdentity, h.requirePermission(models.PermissionUsersManage))
+	{
+		admins.GET("/login-attempts", h.getLoginAttempts)
+		admins.GET("/lockouts", h.getLockouts)
+		admins.DELETE("/lockouts/:id", h.audit(models.AuditEntityUser, "unlock", h.auditLockout), h.deleteLockout)
+	}
+}
+
+type userUnlockInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// @Summary User unlock account
+// @Tags users-auth
+// @Description lift lockout after failed sign ins by token from unlock email
+// @Accept  json
+// @Produce  json
+// @Param input body userUnlockInput true "unlock token"
+// @Success 200 ""
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/unlock [post]
+func (h *Handler) userUnlock(ctx *gin.Context) {
+	var body userUnlockInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Users.UnlockAccount(ctx.Request.Context(), body.Token); err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// @Summary Get login attempts
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags login-attempts-actions
+// @Description get sign in attempts, the latest first
+// @Accept json
+// @Produce json
+// @Param userId query int false "user id"
+// @Param ip query string false "client address"
+// @Param success query bool false "only successful or only failed attempts"
+// @Param limit query int false "page size, 50 by default"
+// @Param offset query int false "number of attempts to skip"
+// @Success 200 {array} models.LoginAttempt
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /login-attempts [get]
+func (h *Handler) getLoginAttempts(ctx *gin.Context) {
+	filter := models.LoginAttemptsFilter{
+		Ip:    ctx.Query("ip"),
+		Limit: defaultLoginAttemptsLimit,
+	}
+
+	if value := ctx.Query("userId"); value != "" {
+		userId, err := strconv.Atoi(value)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong userId"})
+			return
+		}
+		filter.UserId = &userId
+	}
+
+	if value := ctx.Query("success"); value != "" {
+		success, err := strconv.ParseBool(value)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong success"})
+			return
+		}
+		filter.Success = &success
+	}
+
+	if value := ctx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxLoginAttemptsLimit {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong limit"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if value := ctx.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "wrong offset"})
+			return
+		}
+		filter.Offset = offset
+	}
+
+	attempts, err := h.services.LoginAttempts.GetAll(ctx.Request.Context(), filter)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, attempts)
+}
+
+// @Summary Get lockouts
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags login-attempts-actions
+// @Description get accounts locked after too many failed sign ins
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.Lockout
+// @Failure 500 {object} ErrorResponse
+// @Router /lockouts [get]
+func (h *Handler) getLockouts(ctx *gin.Context) {
+	lockouts, err := h.services.LoginAttempts.GetLockouts(ctx.Request.Context())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, lockouts)
+}
+
+// @Summary Delete lockout
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags login-attempts-actions
+// @Description unlock account and reset its failed sign ins
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 ""
+// @Failure 400,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /lockouts/{id} [delete]
+func (h *Handler) deleteLockout(ctx *gin.Context) {
+	strUserId := ctx.Param("id")
+	userId, err := strconv.Atoi(strUserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.LoginAttempts.Unlock(ctx.Request.Context(), userId); err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
@@ -1,62 +1,252 @@
 package v1
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"github.com/gin-gonic/gin"
+	"io"
 	"net/http"
 	"shop_backend/internal/models"
+	"shop_backend/pkg/auth"
+	"shop_backend/pkg/limiter"
+	"shop_backend/pkg/logger"
 	"strconv"
 	"strings"
 )
 
 const (
 	authorizationHeader = "Authorization"
+	cartTokenHeader     = "X-Cart-Token"
+	cartTokenCookie     = "cart_token"
+	apiKeyHeader        = "X-API-Key"
 
-	userCtx = "userId"
+	userCtx      = "userId"
+	sessionCtx   = "sessionId"
+	claimsCtx    = "claims"
+	apiKeyCtx    = "apiKey"
+	cartTokenCtx = "cartToken"
+	challengeCtx = "twoFactorChallenge"
 )
 
+// userIdentity authenticates user by access token. Claims of token are
+// trusted, only token version and session are checked to honour revocations
 func (h *Handler) userIdentity(ctx *gin.Context) {
-	id, err := h.parseAuthHeader(ctx)
+	claims, err := h.parseAuthHeader(ctx)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	ctx.Set(userCtx, id)
+	if err := h.services.Users.CheckToken(ctx.Request.Context(), claims); err != nil {
+		if errors.Is(err, models.ErrTokenRevoked) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Set(userCtx, strconv.Itoa(claims.UserId))
+	ctx.Set(sessionCtx, strconv.Itoa(claims.SessionId))
+	ctx.Set(claimsCtx, claims)
 }
 
-func (h *Handler) adminIdentify(ctx *gin.Context) {
-	id, err := getIdByContext(ctx, userCtx)
+// identity authenticates integration by API key or user by access token.
+// Routes behind it may depend on permissions only, not on user
+func (h *Handler) identity(ctx *gin.Context) {
+	key := ctx.GetHeader(apiKeyHeader)
+	if key == "" {
+		h.userIdentity(ctx)
+		return
+	}
+
+	// Rate limiter may have authenticated the key already
+	if _, ok := ctx.Get(apiKeyCtx); ok {
+		return
+	}
+
+	apiKey, err := h.services.ApiKeys.Authenticate(ctx.Request.Context(), key, ctx.ClientIP())
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, err.Error())
+		if errors.Is(err, models.ErrInvalidApiKey) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Set(apiKeyCtx, apiKey)
+}
+
+// cartIdentity authenticates user if authorization header is provided,
+// otherwise identifies guest cart by cart token from header or cookie
+func (h *Handler) cartIdentity(ctx *gin.Context) {
+	if ctx.GetHeader(authorizationHeader) != "" {
+		h.userIdentity(ctx)
+		return
+	}
+
+	ctx.Set(cartTokenCtx, getCartToken(ctx))
+}
+
+// requirePermission allows request only if authenticated user has permission
+// through any of roles from their access token, or API key has it in scopes
+func (h *Handler) requirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if apiKey, ok := ctx.Get(apiKeyCtx); ok {
+			if !models.HasPermission(apiKey.(models.ApiKey).Scopes, permission) {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: models.ErrForbidden.Error()})
+			}
+			return
+		}
+
+		claims, ok := ctx.Get(claimsCtx)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, claimsCtx+" not found")
+			return
+		}
+
+		if err := h.services.Roles.Authorize(ctx.Request.Context(), claims.(auth.Claims), permission); err != nil {
+			if errors.Is(err, models.ErrForbidden) || errors.Is(err, models.ErrTwoFactorRequired) {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+}
+
+// signInLimit limits sign in attempts by client address and by login. Only
+// failed attempts count against login, each of them delays the next one.
+// Attempt is reserved before handler runs and given back unless it failed
+func (h *Handler) signInLimit(ctx *gin.Context) {
+	ipKey := "sign-in:ip:" + ctx.ClientIP()
+	if !h.reserve(ctx, h.signInIPLimiter, ipKey) {
+		return
+	}
+
+	var input struct {
+		Login string `json:"login"`
+	}
+	if !peekJSON(ctx, &input) || input.Login == "" {
+		return
+	}
+
+	loginKey := "sign-in:login:" + strings.ToLower(input.Login)
+	if !h.reserve(ctx, h.signInLoginLimiter, loginKey) {
 		return
 	}
 
-	user, err := h.services.Users.GetMe(ctx.Request.Context(), id)
+	ctx.Next()
+
+	// Wrong credentials respond with not found. Correct password of account
+	// with two-factor authentication is not failure, but failures are reset
+	// only after second factor succeeds
+	var err error
+	switch status := ctx.Writer.Status(); {
+	case status == http.StatusOK && !ctx.GetBool(challengeCtx):
+		err = h.signInLoginLimiter.Reset(ctx.Request.Context(), loginKey)
+	case status != http.StatusNotFound:
+		err = h.signInLoginLimiter.Release(ctx.Request.Context(), loginKey)
+	}
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, err.Error())
+		logger.Errorf("failed to count sign in of %q: %s", input.Login, err.Error())
+	}
+}
+
+// twoFactorLimit limits second step of sign in by client address and by
+// login of challenged user, wrong one-time codes count like wrong passwords
+func (h *Handler) twoFactorLimit(ctx *gin.Context) {
+	ipKey := "sign-in:ip:" + ctx.ClientIP()
+	if !h.reserve(ctx, h.signInIPLimiter, ipKey) {
 		return
 	}
 
-	if user.Admin != true {
-		ctx.AbortWithStatus(http.StatusForbidden)
+	var input struct {
+		ChallengeToken string `json:"challengeToken"`
+	}
+	if !peekJSON(ctx, &input) || input.ChallengeToken == "" {
 		return
 	}
+
+	login, err := h.services.Users.ChallengeLogin(ctx.Request.Context(), input.ChallengeToken)
+	if errors.Is(err, models.ErrInvalidToken) {
+		// Handler rejects unknown challenge itself
+		return
+	} else if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	loginKey := "sign-in:login:" + strings.ToLower(login)
+	if !h.reserve(ctx, h.signInLoginLimiter, loginKey) {
+		return
+	}
+
+	ctx.Next()
+
+	// Wrong one-time code responds with unauthorized
+	switch ctx.Writer.Status() {
+	case http.StatusOK:
+		err = h.signInLoginLimiter.Reset(ctx.Request.Context(), loginKey)
+	case http.StatusUnauthorized:
+	default:
+		err = h.signInLoginLimiter.Release(ctx.Request.Context(), loginKey)
+	}
+	if err != nil {
+		logger.Errorf("failed to count sign in of %q: %s", login, err.Error())
+	}
+}
+
+// peekJSON decodes request body into v and restores it for the handler to
+// bind. Malformed body is left for the handler to reject, false is returned
+func peekJSON(ctx *gin.Context, v interface{}) bool {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return false
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	return json.Unmarshal(body, v) == nil
+}
+
+// reserve counts hit of key or aborts request with 429 and Retry-After header
+// if limiter does not allow key now
+func (h *Handler) reserve(ctx *gin.Context, l *limiter.Limiter, key string) bool {
+	wait, err := l.Reserve(ctx.Request.Context(), key)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return false
+	}
+
+	if wait > 0 {
+		ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{Error: models.ErrTooManyRequests.Error()})
+		return false
+	}
+
+	return true
 }
 
-func (h *Handler) parseAuthHeader(ctx *gin.Context) (string, error) {
+func (h *Handler) parseAuthHeader(ctx *gin.Context) (auth.Claims, error) {
 	header := ctx.GetHeader(authorizationHeader)
 	if header == "" {
-		return "", models.ErrEmptyAuthHeader
+		return auth.Claims{}, models.ErrEmptyAuthHeader
 	}
 
 	headerParts := strings.Split(header, " ")
 	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-		return "", models.ErrInvalidAuthHeader
+		return auth.Claims{}, models.ErrInvalidAuthHeader
 	}
 
 	if len(headerParts[1]) == 0 {
-		return "", errors.New("token is empty")
+		return auth.Claims{}, errors.New("token is empty")
 	}
 
 	return h.tokenManager.Parse(headerParts[1])
@@ -80,3 +270,52 @@ func getIdByContext(ctx *gin.Context, context string) (int, error) {
 
 	return id, nil
 }
+
+// getActorId returns id of authenticated user, nil if request is made with API key
+func getActorId(ctx *gin.Context) (*int, error) {
+	if _, ok := ctx.Get(apiKeyCtx); ok {
+		return nil, nil
+	}
+
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &userId, nil
+}
+
+// getDevice describes client of request for session metadata
+func getDevice(ctx *gin.Context) models.Device {
+	userAgent := ctx.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	return models.Device{
+		UserAgent: userAgent,
+		Ip:        ctx.ClientIP(),
+	}
+}
+
+func getCartToken(ctx *gin.Context) string {
+	if token := ctx.GetHeader(cartTokenHeader); token != "" {
+		return token
+	}
+
+	token, _ := ctx.Cookie(cartTokenCookie)
+	return token
+}
+
+func getCartOwner(ctx *gin.Context) (models.CartOwner, error) {
+	if _, ok := ctx.Get(userCtx); ok {
+		userId, err := getIdByContext(ctx, userCtx)
+		if err != nil {
+			return models.CartOwner{}, err
+		}
+
+		return models.CartOwner{UserId: userId}, nil
+	}
+
+	return models.CartOwner{Token: ctx.GetString(cartTokenCtx)}, nil
+}
@@ -0,0 +1,101 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+	"shop_backend/pkg/oidc"
+)
+
+// oauthStateCookie binds sign in with provider to browser which started it
+const oauthStateCookie = "oauth_state"
+
+// @Summary User OAuth sign in
+// @Tags users-auth
+// @Description redirect to sign in page of OpenID Connect provider. Provider redirects back to frontend
+// @Description with code and state, which are posted to callback. Sets state cookie checked by callback
+// @Param provider path string true "provider name"
+// @Param loginHint query string false "email suggested to provider"
+// @Success 302 ""
+// @Failure 404 {object} ErrorResponse
+// @Failure 500,502 {object} ErrorResponse
+// @Router /users/oauth/{provider} [get]
+func (h *Handler) userOAuth(ctx *gin.Context) {
+	url, state, err := h.services.Users.OAuthURL(ctx.Request.Context(), ctx.Param("provider"), ctx.Query("loginHint"))
+	if err != nil {
+		h.abortWithOAuthError(ctx, err)
+		return
+	}
+
+	ctx.SetCookie(oauthStateCookie, state, 600, "/", "localhost", false, true)
+	ctx.Redirect(http.StatusFound, url)
+}
+
+type userOAuthCallbackInput struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// @Summary User OAuth callback
+// @Tags users-auth
+// @Description complete sign in with code and state received from provider. Identity is linked to account
+// @Description with the same verified email or new account is created. Sets refresh token cookie
+// @Accept  json
+// @Produce  json
+// @Param provider path string true "provider name"
+// @Param X-Cart-Token header string false "guest cart token to merge"
+// @Param input body userOAuthCallbackInput true "code and state"
+// @Success 200 {object} models.Tokens
+// @Failure 400,401,404,409 {object} ErrorResponse
+// @Failure 500,502 {object} ErrorResponse
+// @Router /users/oauth/{provider}/callback [post]
+func (h *Handler) userOAuthCallback(ctx *gin.Context) {
+	var body userOAuthCallbackInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Missing cookie is rejected by service like mismatched one
+	browserState, _ := ctx.Cookie(oauthStateCookie)
+	// State is single use
+	ctx.SetCookie(oauthStateCookie, "", -1, "/", "localhost", false, true)
+
+	tokens, err := h.services.Users.SignInOAuth(ctx.Request.Context(), ctx.Param("provider"), body.Code, body.State, browserState, getCartToken(ctx), getDevice(ctx))
+	if err != nil {
+		h.abortWithOAuthError(ctx, err)
+		return
+	}
+
+	// Sign in has to be completed with one-time code
+	if tokens.ChallengeToken != "" {
+		ctx.JSON(http.StatusOK, tokens)
+		return
+	}
+
+	ctx.SetCookie("refresh_token", tokens.RefreshToken, 2592000, "/", "localhost", false, true)
+	// Guest cart has been merged into user cart
+	ctx.SetCookie(cartTokenCookie, "", -1, "/", "localhost", false, true)
+
+	// Hide refresh token
+	tokens.RefreshToken = ""
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *Handler) abortWithOAuthError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrProviderNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrInvalidToken), errors.Is(err, models.ErrProviderEmail):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, oidc.ErrExchange), errors.Is(err, oidc.ErrInvalidToken):
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrIdentityNotLinked):
+		ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, oidc.ErrDiscovery):
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, ErrorResponse{Error: err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
@@ -0,0 +1,244 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+	"strconv"
+)
+
+func (h *Handler) InitOrdersRoutes(api *gin.RouterGroup) {
+	orders := api.Group("/orders", h.rateLimit("orders"))
+	{
+		admins := orders.Group("/admin", h.identity, h.requirePermission(models.PermissionOrdersManage))
+		{
+			admins.GET("/", h.getAllOrders)
+			admins.GET("/:id", h.getOrderByIdAdmin)
+			admins.PUT("/:id/status", h.audit(models.AuditEntityOrder, "update_status", h.auditOrder), h.updateOrderStatus)
+		}
+
+		users := orders.Group("/", h.userIdentity)
+		{
+			users.POST("/", h.createOrder)
+			users.GET("/", h.getUserOrders)
+			users.GET("/:id", h.getOrderById)
+		}
+	}
+}
+
+// @Summary Create order
+// @Security UsersAuth
+// @Tags orders-actions
+// @Description create order from current user cart
+// @Accept json
+// @Produce json
+// @Success 201 {object} models.Order
+// @Failure 400,403,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/ [post]
+func (h *Handler) createOrder(ctx *gin.Context) {
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	order, err := h.services.Orders.Create(ctx.Request.Context(), userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmptyCart), errors.Is(err, models.ErrAddressNotFound):
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrOutOfStock), errors.Is(err, models.ErrCartChanged):
+			ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrEmailNotVerified):
+			ctx.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		default:
+			h.abortWithCouponError(ctx, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, order)
+}
+
+// @Summary Get user orders
+// @Security UsersAuth
+// @Tags orders-actions
+// @Description get all orders of current user
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.Order
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/ [get]
+func (h *Handler) getUserOrders(ctx *gin.Context) {
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	orders, err := h.services.Orders.GetByUser(ctx.Request.Context(), userId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, orders)
+}
+
+// @Summary Get user order by id
+// @Security UsersAuth
+// @Tags orders-actions
+// @Description get order of current user by id
+// @Accept json
+// @Produce json
+// @Param id path int true "order id"
+// @Success 200 {object} models.Order
+// @Failure 400,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id} [get]
+func (h *Handler) getOrderById(ctx *gin.Context) {
+	strOrderId := ctx.Param("id")
+	orderId, err := strconv.Atoi(strOrderId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	order, err := h.services.Orders.GetById(ctx.Request.Context(), userId, orderId)
+	if err != nil {
+		if errors.Is(err, models.ErrOrderNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+// @Summary Get all orders
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags orders-actions
+// @Description get all orders, optionally filtered by status
+// @Accept json
+// @Produce json
+// @Param status query string false "order status"
+// @Success 200 {array} models.Order
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/admin/ [get]
+func (h *Handler) getAllOrders(ctx *gin.Context) {
+	status := models.OrderStatus(ctx.Query("status"))
+
+	orders, err := h.services.Orders.GetAll(ctx.Request.Context(), status)
+	if err != nil {
+		if errors.Is(err, models.ErrWrongOrderStatus) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, orders)
+}
+
+// @Summary Get order by id
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags orders-actions
+// @Description get any order by id
+// @Accept json
+// @Produce json
+// @Param id path int true "order id"
+// @Success 200 {object} models.Order
+// @Failure 400,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/admin/{id} [get]
+func (h *Handler) getOrderByIdAdmin(ctx *gin.Context) {
+	strOrderId := ctx.Param("id")
+	orderId, err := strconv.Atoi(strOrderId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	order, err := h.services.Orders.Get(ctx.Request.Context(), orderId)
+	if err != nil {
+		if errors.Is(err, models.ErrOrderNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+type updateOrderStatusInput struct {
+	Status models.OrderStatus `json:"status" binding:"required"`
+}
+
+// @Summary Update order status
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags orders-actions
+// @Description move order to the next status, refunded one is set by refunding order payment
+// @Accept json
+// @Produce json
+// @Param id path int true "order id"
+// @Param input body updateOrderStatusInput true "status info"
+// @Success 200 {object} models.Order
+// @Failure 400,404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/admin/{id}/status [put]
+func (h *Handler) updateOrderStatus(ctx *gin.Context) {
+	strOrderId := ctx.Param("id")
+	orderId, err := strconv.Atoi(strOrderId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var body updateOrderStatusInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Orders.UpdateStatus(ctx.Request.Context(), orderId, body.Status); err != nil {
+		var transitionErr models.ErrOrderTransition
+		switch {
+		case errors.As(err, &transitionErr):
+			ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrWrongOrderStatus), errors.Is(err, models.ErrRefundViaPayment):
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrOrderNotFound):
+			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrOrderStatusChange):
+			ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	h.getOrderByIdAdmin(ctx)
+}
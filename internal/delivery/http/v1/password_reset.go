@@ -0,0 +1,87 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+)
+
+type userForgotPasswordInput struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// @Summary User forgot password
+// @Tags users-auth
+// @Description email password reset link, response does not tell whether email is registered
+// @Accept  json
+// @Produce  json
+// @Param input body userForgotPasswordInput true "account email"
+// @Success 200 ""
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/password/forgot [post]
+func (h *Handler) userForgotPassword(ctx *gin.Context) {
+	var body userForgotPasswordInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Users.ForgotPassword(ctx.Request.Context(), body.Email); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+type userResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (u *userResetPasswordInput) isValidPassword() error {
+	if len(u.Password) < 6 || len(u.Password) > 16 {
+		return errors.New("wrong password length")
+	}
+
+	return nil
+}
+
+// @Summary User reset password
+// @Tags users-auth
+// @Description set new password by token from reset email, all sessions of user are ended
+// @Accept  json
+// @Produce  json
+// @Param input body userResetPasswordInput true "reset token and new password"
+// @Success 200 ""
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/password/reset [post]
+func (h *Handler) userResetPassword(ctx *gin.Context) {
+	var body userResetPasswordInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := body.isValidPassword(); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Users.ResetPassword(ctx.Request.Context(), body.Token, body.Password); err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
+
+	ctx.Status(http.StatusOK)
+}
@@ -0,0 +1,206 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"shop_backend/internal/models"
+	"shop_backend/pkg/payments"
+	"strconv"
+)
+
+const paymentSignatureHeader = "X-Payment-Signature"
+
+func (h *Handler) InitPaymentsRoutes(api *gin.RouterGroup) {
+	// Payments are disabled
+	if h.cfg.Payments.Provider == "" {
+		return
+	}
+
+	payment := api.Group("/payments")
+	{
+		payment.POST("/webhook", h.paymentWebhook)
+
+		// Sandbox provider confirmation page
+		if h.cfg.Payments.Provider == "fake" {
+			payment.POST("/fake/:id/confirm", h.confirmFakePayment)
+		}
+
+		admins := payment.Group("/admin", h.rateLimit("payments"), h.identity, h.requirePermission(models.PermissionOrdersManage))
+		{
+			admins.GET("/orders/:id", h.getOrderPayments)
+			admins.POST("/orders/:id/refund", h.audit(models.AuditEntityOrder, "refund", h.auditOrder), h.refundOrderPayment)
+		}
+
+		authenticated := payment.Group("/", h.rateLimit("payments"), h.userIdentity)
+		{
+			authenticated.POST("/orders/:id", h.createPayment)
+		}
+	}
+}
+
+// @Summary Create payment
+// @Security UsersAuth
+// @Tags payments-actions
+// @Description start payment of current user pending order
+// @Accept json
+// @Produce json
+// @Param id path int true "order id"
+// @Success 201 {object} models.Payment
+// @Failure 400,404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /payments/orders/{id} [post]
+func (h *Handler) createPayment(ctx *gin.Context) {
+	strOrderId := ctx.Param("id")
+	orderId, err := strconv.Atoi(strOrderId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	payment, err := h.services.Payments.Create(ctx.Request.Context(), userId, orderId)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrOrderNotFound):
+			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrOrderNotPayable), errors.Is(err, models.ErrPaymentExists):
+			ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, payment)
+}
+
+// @Summary Payment provider webhook
+// @Tags payments-actions
+// @Description receive payment status change from provider
+// @Accept json
+// @Produce json
+// @Param X-Payment-Signature header string true "payload signature"
+// @Success 200 ""
+// @Failure 400,401,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /payments/webhook [post]
+func (h *Handler) paymentWebhook(ctx *gin.Context) {
+	payload, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err = h.services.Payments.HandleWebhook(ctx.Request.Context(), payload, ctx.GetHeader(paymentSignatureHeader))
+	if err != nil {
+		h.abortWithPaymentError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// @Summary Confirm sandbox payment
+// @Tags payments-actions
+// @Description simulate customer completing payment with sandbox provider
+// @Accept json
+// @Produce json
+// @Param id path string true "payment intent id"
+// @Param result query string false "fail to decline payment"
+// @Success 200 ""
+// @Failure 404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /payments/fake/{id}/confirm [post]
+func (h *Handler) confirmFakePayment(ctx *gin.Context) {
+	intentId := ctx.Param("id")
+	succeed := ctx.Query("result") != "fail"
+
+	if err := h.services.Payments.Simulate(ctx.Request.Context(), intentId, succeed); err != nil {
+		h.abortWithPaymentError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// @Summary Get order payments
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags payments-actions
+// @Description get all payments of order
+// @Accept json
+// @Produce json
+// @Param id path int true "order id"
+// @Success 200 {array} models.Payment
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /payments/admin/orders/{id} [get]
+func (h *Handler) getOrderPayments(ctx *gin.Context) {
+	strOrderId := ctx.Param("id")
+	orderId, err := strconv.Atoi(strOrderId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	orderPayments, err := h.services.Payments.GetByOrder(ctx.Request.Context(), orderId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, orderPayments)
+}
+
+// @Summary Refund order payment
+// @Security UsersAuth
+// @Security AdminAuth
+// @Security ApiKeyAuth
+// @Tags payments-actions
+// @Description refund succeeded payment of order and move order to refunded status
+// @Accept json
+// @Produce json
+// @Param id path int true "order id"
+// @Success 200 ""
+// @Failure 400,404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /payments/admin/orders/{id}/refund [post]
+func (h *Handler) refundOrderPayment(ctx *gin.Context) {
+	strOrderId := ctx.Param("id")
+	orderId, err := strconv.Atoi(strOrderId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Payments.Refund(ctx.Request.Context(), orderId); err != nil {
+		h.abortWithPaymentError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (h *Handler) abortWithPaymentError(ctx *gin.Context, err error) {
+	var transitionErr models.ErrOrderTransition
+	switch {
+	case errors.Is(err, payments.ErrInvalidSignature):
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrPaymentNotFound), errors.Is(err, models.ErrOrderNotFound),
+		errors.Is(err, payments.ErrIntentNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, payments.ErrWrongStatus), errors.Is(err, models.ErrPaymentStatus),
+		errors.As(err, &transitionErr):
+		ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
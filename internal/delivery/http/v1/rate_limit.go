@@ -0,0 +1,113 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+	"shop_backend/internal/config"
+	"shop_backend/internal/models"
+	"shop_backend/pkg/auth"
+	"shop_backend/pkg/limiter"
+	"strconv"
+	"time"
+)
+
+type rateLimitTier string
+
+const (
+	anonymousTier rateLimitTier = "anonymous"
+	userTier      rateLimitTier = "user"
+	adminTier     rateLimitTier = "admin"
+)
+
+// rateLimit limits requests to route group by token bucket of client. Limits
+// of group are read from config once, when routes are registered
+func (h *Handler) rateLimit(group string) gin.HandlerFunc {
+	tiers, ok := h.cfg.Limiter.Groups[group]
+	if !ok {
+		tiers = h.cfg.Limiter.Default
+	}
+
+	buckets := map[rateLimitTier]*limiter.TokenBucket{
+		anonymousTier: h.newTokenBucket(tiers.Anonymous, h.cfg.Limiter.Default.Anonymous),
+		userTier:      h.newTokenBucket(tiers.User, h.cfg.Limiter.Default.User),
+		adminTier:     h.newTokenBucket(tiers.Admin, h.cfg.Limiter.Default.Admin),
+	}
+
+	return func(ctx *gin.Context) {
+		tier, key := h.rateLimitClient(ctx)
+		bucket := buckets[tier]
+		if bucket == nil {
+			return
+		}
+
+		state, err := bucket.Take(ctx.Request.Context(), "rate:"+group+":"+key)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.Header("RateLimit-Limit", strconv.Itoa(state.Capacity))
+		ctx.Header("RateLimit-Remaining", strconv.Itoa(state.Remaining))
+		ctx.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(state.ResetAfter)))
+
+		if !state.Allowed() {
+			ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(state.RetryAfter)))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{Error: models.ErrTooManyRequests.Error()})
+			return
+		}
+	}
+}
+
+// newTokenBucket returns nil if limit is disabled. Tier missing in group
+// config falls back to default tier
+func (h *Handler) newTokenBucket(cfg, fallback config.RateLimitConfig) *limiter.TokenBucket {
+	if cfg.Limit == 0 {
+		cfg = fallback
+	}
+	if cfg.Limit <= 0 || cfg.Period <= 0 {
+		return nil
+	}
+
+	return limiter.NewTokenBucket(h.limiterStore, cfg.Limit, cfg.Period, cfg.Burst)
+}
+
+// rateLimitClient identifies client by API key, by user id of access token,
+// or by address if there are none. Token of public routes is parsed and
+// checked against revocations here, invalid or revoked token or key does not
+// fail request, it only leaves client anonymous
+func (h *Handler) rateLimitClient(ctx *gin.Context) (rateLimitTier, string) {
+	if key := ctx.GetHeader(apiKeyHeader); key != "" {
+		apiKey, err := h.services.ApiKeys.Authenticate(ctx.Request.Context(), key, ctx.ClientIP())
+		if err == nil {
+			// Saves identity middleware from authenticating the key again
+			ctx.Set(apiKeyCtx, apiKey)
+			return adminTier, "apikey:" + strconv.Itoa(apiKey.Id)
+		}
+	}
+
+	var claims auth.Claims
+	if value, ok := ctx.Get(claimsCtx); ok {
+		claims = value.(auth.Claims)
+	} else if ctx.GetHeader(authorizationHeader) != "" {
+		parsed, err := h.parseAuthHeader(ctx)
+		if err == nil && h.services.Users.CheckToken(ctx.Request.Context(), parsed) == nil {
+			claims = parsed
+		}
+	}
+
+	if claims.UserId == 0 {
+		return anonymousTier, "ip:" + ctx.ClientIP()
+	}
+
+	key := "user:" + strconv.Itoa(claims.UserId)
+	if len(claims.Roles) > 0 {
+		return adminTier, key
+	}
+
+	return userTier, key
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,281 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+	"shop_backend/pkg/auth"
+	"strconv"
+)
+
+func (h *Handler) InitRolesRoutes(api *gin.RouterGroup) {
+	roles := api.Group("/roles", h.rateLimit("roles"), h.userIdentity, h.requirePermission(models.PermissionUsersManage))
+	{
+		roles.GET("/", h.getAllRoles)
+		roles.POST("/", h.audit(models.AuditEntityRole, "create", h.auditRole), h.createRole)
+		roles.GET("/permissions", h.getPermissions)
+		roles.GET("/:id", h.getRoleById)
+		roles.PUT("/:id", h.audit(models.AuditEntityRole, "update", h.auditRole), h.updateRole)
+		roles.DELETE("/:id", h.audit(models.AuditEntityRole, "delete", h.auditRole), h.deleteRole)
+		roles.GET("/users/:id", h.getUserRoles)
+		roles.PUT("/users/:id", h.audit(models.AuditEntityUser, "set_roles", h.auditUserRoles), h.setUserRoles)
+	}
+}
+
+type roleInput struct {
+	Name        string              `json:"name" binding:"required,max=50"`
+	Description string              `json:"description" binding:"max=255"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+func (i roleInput) toRole(id int) models.Role {
+	return models.Role{
+		Id:          id,
+		Name:        i.Name,
+		Description: i.Description,
+		Permissions: i.Permissions,
+	}
+}
+
+type CreateRoleResult struct {
+	RoleId int `json:"roleId"`
+}
+
+// @Summary Create role
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags roles-actions
+// @Description create role with permissions, "*" grants all permissions
+// @Accept json
+// @Produce json
+// @Param input body roleInput true "input body"
+// @Success 201 {object} CreateRoleResult
+// @Failure 400,403,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /roles/ [post]
+func (h *Handler) createRole(ctx *gin.Context) {
+	var body roleInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	roleId, err := h.services.Roles.Create(ctx.Request.Context(), ctx.MustGet(claimsCtx).(auth.Claims), body.toRole(0))
+	if err != nil {
+		h.abortWithRoleError(ctx, err)
+		return
+	}
+
+	setAuditEntity(ctx, roleId)
+	ctx.JSON(http.StatusCreated, CreateRoleResult{RoleId: roleId})
+}
+
+// @Summary Get all roles
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags roles-actions
+// @Description get all roles with their permissions
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.Role
+// @Failure 500 {object} ErrorResponse
+// @Router /roles/ [get]
+func (h *Handler) getAllRoles(ctx *gin.Context) {
+	roles, err := h.services.Roles.GetAll(ctx.Request.Context())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, roles)
+}
+
+// @Summary Get permissions
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags roles-actions
+// @Description get all permissions which can be granted to roles
+// @Accept json
+// @Produce json
+// @Success 200 {array} string
+// @Router /roles/permissions [get]
+func (h *Handler) getPermissions(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, models.Permissions)
+}
+
+// @Summary Get role by id
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags roles-actions
+// @Description get role by id
+// @Accept json
+// @Produce json
+// @Param id path int true "role id"
+// @Success 200 {object} models.Role
+// @Failure 400,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /roles/{id} [get]
+func (h *Handler) getRoleById(ctx *gin.Context) {
+	strRoleId := ctx.Param("id")
+	roleId, err := strconv.Atoi(strRoleId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	role, err := h.services.Roles.GetById(ctx.Request.Context(), roleId)
+	if err != nil {
+		h.abortWithRoleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, role)
+}
+
+// @Summary Update role
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags roles-actions
+// @Description update role replacing its permissions
+// @Accept json
+// @Produce json
+// @Param id path int true "role id"
+// @Param input body roleInput true "input body"
+// @Success 200 ""
+// @Failure 400,403,404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /roles/{id} [put]
+func (h *Handler) updateRole(ctx *gin.Context) {
+	strRoleId := ctx.Param("id")
+	roleId, err := strconv.Atoi(strRoleId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var body roleInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Roles.Update(ctx.Request.Context(), ctx.MustGet(claimsCtx).(auth.Claims), body.toRole(roleId)); err != nil {
+		h.abortWithRoleError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// @Summary Delete role
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags roles-actions
+// @Description delete role, users lose its permissions
+// @Accept json
+// @Produce json
+// @Param id path int true "role id"
+// @Success 200 ""
+// @Failure 400,403,404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /roles/{id} [delete]
+func (h *Handler) deleteRole(ctx *gin.Context) {
+	strRoleId := ctx.Param("id")
+	roleId, err := strconv.Atoi(strRoleId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Roles.Delete(ctx.Request.Context(), ctx.MustGet(claimsCtx).(auth.Claims), roleId); err != nil {
+		h.abortWithRoleError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// @Summary Get user roles
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags roles-actions
+// @Description get roles assigned to user
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {array} models.Role
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /roles/users/{id} [get]
+func (h *Handler) getUserRoles(ctx *gin.Context) {
+	strUserId := ctx.Param("id")
+	userId, err := strconv.Atoi(strUserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	roles, err := h.services.Roles.GetUserRoles(ctx.Request.Context(), userId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, roles)
+}
+
+type userRolesInput struct {
+	RolesId []int `json:"rolesId"`
+}
+
+// @Summary Set user roles
+// @Security UsersAuth
+// @Security AdminAuth
+// @Tags roles-actions
+// @Description replace roles of user, empty list revokes all roles
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Param input body userRolesInput true "input body"
+// @Success 200 ""
+// @Failure 400,403,404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /roles/users/{id} [put]
+func (h *Handler) setUserRoles(ctx *gin.Context) {
+	strUserId := ctx.Param("id")
+	userId, err := strconv.Atoi(strUserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var body userRolesInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Roles.SetUserRoles(ctx.Request.Context(), ctx.MustGet(claimsCtx).(auth.Claims), userId, body.RolesId); err != nil {
+		h.abortWithRoleError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (h *Handler) abortWithRoleError(ctx *gin.Context, err error) {
+	var uniqueErr models.ErrUniqueValue
+	switch {
+	case errors.Is(err, models.ErrWrongPermission):
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrForbidden), errors.Is(err, models.ErrTwoFactorRequired):
+		ctx.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrRoleNotFound), errors.Is(err, models.ErrUserNotFound):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrRoleProtected), errors.Is(err, models.ErrLastSuperuser), errors.As(err, &uniqueErr):
+		ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
@@ -0,0 +1,110 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+	"strconv"
+)
+
+// @Summary Get user sessions
+// @Security UsersAuth
+// @Tags users-sessions
+// @Description get active sessions of current user, session of authentication header is marked as current
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.Session
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/sessions [get]
+func (h *Handler) userGetSessions(ctx *gin.Context) {
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sessionId, err := getIdByContext(ctx, sessionCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sessions, err := h.services.Users.GetSessions(ctx.Request.Context(), userId, sessionId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, sessions)
+}
+
+// @Summary Revoke user session
+// @Security UsersAuth
+// @Tags users-sessions
+// @Description revoke session of current user, its refresh and access tokens stop working
+// @Accept  json
+// @Produce  json
+// @Param id path int true "session id"
+// @Success 200 ""
+// @Failure 400,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/sessions/{id} [delete]
+func (h *Handler) userRevokeSession(ctx *gin.Context) {
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	strSessionId := ctx.Param("id")
+	sessionId, err := strconv.Atoi(strSessionId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Users.RevokeSession(ctx.Request.Context(), userId, sessionId); err != nil {
+		if errors.Is(err, models.ErrSessionNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// @Summary Revoke other user sessions
+// @Security UsersAuth
+// @Tags users-sessions
+// @Description revoke all sessions of current user except session of authentication header
+// @Accept  json
+// @Produce  json
+// @Success 200 ""
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/sessions [delete]
+func (h *Handler) userRevokeOtherSessions(ctx *gin.Context) {
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sessionId, err := getIdByContext(ctx, sessionCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Users.RevokeOtherSessions(ctx.Request.Context(), userId, sessionId); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
@@ -0,0 +1,166 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"shop_backend/internal/models"
+)
+
+type userSignInTwoFactorInput struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// @Summary User SignIn second step
+// @Tags users-2fa
+// @Description complete sign in with code from authenticator app or recovery code
+// @Accept  json
+// @Produce  json
+// @Param X-Cart-Token header string false "guest cart token to merge"
+// @Param input body userSignInTwoFactorInput true "challenge token and one-time code"
+// @Success 200 {object} models.Tokens
+// @Failure 400,401,403,429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/sign-in/2fa [post]
+func (h *Handler) userSignInTwoFactor(ctx *gin.Context) {
+	var body userSignInTwoFactorInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	tokens, err := h.services.Users.SignInTwoFactor(ctx.Request.Context(), body.ChallengeToken, body.Code, getCartToken(ctx), getDevice(ctx))
+	if err != nil {
+		h.abortWithTwoFactorError(ctx, err)
+		return
+	}
+
+	ctx.SetCookie("refresh_token", tokens.RefreshToken, 2592000, "/", "localhost", false, true)
+	// Guest cart has been merged into user cart
+	ctx.SetCookie(cartTokenCookie, "", -1, "/", "localhost", false, true)
+
+	// Hide refresh token
+	tokens.RefreshToken = ""
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// @Summary Enroll two-factor authentication
+// @Security UsersAuth
+// @Tags users-2fa
+// @Description generate TOTP secret and provisioning URI for QR code, enrollment must be confirmed by enable
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} models.TwoFactorEnrollment
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/2fa/enroll [post]
+func (h *Handler) userEnrollTwoFactor(ctx *gin.Context) {
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	enrollment, err := h.services.Users.EnrollTwoFactor(ctx.Request.Context(), userId)
+	if err != nil {
+		h.abortWithTwoFactorError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollment)
+}
+
+type userEnableTwoFactorInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// @Summary Enable two-factor authentication
+// @Security UsersAuth
+// @Tags users-2fa
+// @Description confirm enrollment with code from authenticator app, recovery codes are returned only once
+// @Accept  json
+// @Produce  json
+// @Param input body userEnableTwoFactorInput true "one-time code"
+// @Success 200 {object} recoveryCodesResponse
+// @Failure 400,401,404,409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/2fa/enable [post]
+func (h *Handler) userEnableTwoFactor(ctx *gin.Context) {
+	var body userEnableTwoFactorInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	codes, err := h.services.Users.EnableTwoFactor(ctx.Request.Context(), userId, body.Code)
+	if err != nil {
+		h.abortWithTwoFactorError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+type userDisableTwoFactorInput struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"`
+}
+
+// @Summary Disable two-factor authentication
+// @Security UsersAuth
+// @Tags users-2fa
+// @Description turn off two-factor authentication with password and one-time or recovery code
+// @Accept  json
+// @Produce  json
+// @Param input body userDisableTwoFactorInput true "password and one-time code"
+// @Success 200 ""
+// @Failure 400,401,404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/2fa/disable [post]
+func (h *Handler) userDisableTwoFactor(ctx *gin.Context) {
+	var body userDisableTwoFactorInput
+	if err := ctx.BindJSON(&body); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userId, err := getIdByContext(ctx, userCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Users.DisableTwoFactor(ctx.Request.Context(), userId, body.Password, body.Code); err != nil {
+		h.abortWithTwoFactorError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (h *Handler) abortWithTwoFactorError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidToken), errors.Is(err, models.ErrInvalidOneTimeCode),
+		errors.Is(err, models.ErrWrongPassword):
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrAccountLocked):
+		ctx.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrTwoFactorNotEnrolled):
+		ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrTwoFactorEnabled):
+		ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
@@ -12,19 +12,33 @@ import (
 )
 
 func (h *Handler) InitUsersRoutes(api *gin.RouterGroup) {
-	users := api.Group("/users")
+	users := api.Group("/users", h.rateLimit("users"))
 	{
 		users.POST("/sign-up", h.userSignUp)
-		users.POST("/sign-in", h.userSignIn)
+		users.POST("/sign-in", h.signInLimit, h.userSignIn)
+		users.POST("/sign-in/2fa", h.twoFactorLimit, h.userSignInTwoFactor)
 		users.POST("/refresh", h.userRefresh)
+		users.POST("/password/forgot", h.userForgotPassword)
+		users.POST("/password/reset", h.userResetPassword)
+		users.POST("/email/confirm", h.userConfirmEmail)
+		users.POST("/unlock", h.userUnlock)
+		users.GET("/oauth/:provider", h.userOAuth)
+		users.POST("/oauth/:provider/callback", h.userOAuthCallback)
 
 		authenticated := users.Group("/", h.userIdentity)
 		{
 			authenticated.POST("/logout", h.userLogout)
+			authenticated.GET("/sessions", h.userGetSessions)
+			authenticated.DELETE("/sessions", h.userRevokeOtherSessions)
+			authenticated.DELETE("/sessions/:id", h.userRevokeSession)
 			authenticated.GET("/me", h.userGetMe)
 			authenticated.DELETE("/me", h.userDeleteMe)
 
 			authenticated.PUT("/email", h.userUpdateEmail)
+			authenticated.POST("/email/resend", h.userResendVerification)
+			authenticated.POST("/2fa/enroll", h.userEnrollTwoFactor)
+			authenticated.POST("/2fa/enable", h.userEnableTwoFactor)
+			authenticated.POST("/2fa/disable", h.userDisableTwoFactor)
 			authenticated.PUT("/password", h.userUpdatePassword)
 			authenticated.PUT("/info", h.userUpdateInfo)
 			authenticated.PUT("/address", h.userUpdateAddress)
@@ -78,6 +92,7 @@ func (u *userSignUpInput) isValidPassword() error {
 // @Description create user account
 // @Accept  json
 // @Produce  json
+// @Param X-Cart-Token header string false "guest cart token to merge"
 // @Param input body userSignUpInput true "sign up info"
 // @Success 201 {object} models.User
 // @Failure 400 {object} ErrorResponse
@@ -105,12 +120,15 @@ func (h *Handler) userSignUp(ctx *gin.Context) {
 		return
 	}
 
-	user, err := h.services.Users.SignUp(ctx.Request.Context(), body.Email, body.Login, body.Password)
+	user, err := h.services.Users.SignUp(ctx.Request.Context(), body.Email, body.Login, body.Password, getCartToken(ctx))
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	// Guest cart has been merged into user cart
+	ctx.SetCookie(cartTokenCookie, "", -1, "/", "localhost", false, true)
+
 	ctx.JSON(http.StatusCreated, user)
 }
 
@@ -132,9 +150,10 @@ func (u *userSignInInput) loginIsEmail() bool {
 // @Description login into user account
 // @Accept  json
 // @Produce  json
+// @Param X-Cart-Token header string false "guest cart token to merge"
 // @Param input body userSignInInput true "sign in info"
-// @Success 200 {object} models.Tokens
-// @Failure 400 {object} ErrorResponse
+// @Success 200 {object} models.Tokens "access token, or challenge token if two-factor authentication is enabled"
+// @Failure 400,403,404,429 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /users/sign-in [post]
 func (h *Handler) userSignIn(ctx *gin.Context) {
@@ -151,18 +170,31 @@ func (h *Handler) userSignIn(ctx *gin.Context) {
 		findBy = "login"
 	}
 
-	tokens, err := h.services.Users.SignIn(ctx.Request.Context(), findBy, body.Login, body.Password)
+	tokens, err := h.services.Users.SignIn(ctx.Request.Context(), findBy, body.Login, body.Password, getCartToken(ctx), getDevice(ctx))
 	if err != nil {
 		if errors.Is(err, models.ErrUserNotFound) {
 			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
 			return
 		}
+		if errors.Is(err, models.ErrAccountLocked) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+			return
+		}
 
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	// Sign in has to be completed with one-time code
+	if tokens.ChallengeToken != "" {
+		ctx.Set(challengeCtx, true)
+		ctx.JSON(http.StatusOK, tokens)
+		return
+	}
+
 	ctx.SetCookie("refresh_token", tokens.RefreshToken, 2592000, "/", "localhost", false, true)
+	// Guest cart has been merged into user cart
+	ctx.SetCookie(cartTokenCookie, "", -1, "/", "localhost", false, true)
 
 	// Hide refresh token
 	tokens.RefreshToken = ""
@@ -175,7 +207,7 @@ func (h *Handler) userSignIn(ctx *gin.Context) {
 // @Accept  json
 // @Produce  json
 // @Success 200 {object} models.Tokens
-// @Failure 400,404,401 {object} ErrorResponse
+// @Failure 400,401 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /users/refresh [post]
 func (h *Handler) userRefresh(ctx *gin.Context) {
@@ -185,10 +217,11 @@ func (h *Handler) userRefresh(ctx *gin.Context) {
 		return
 	}
 
-	tokens, err := h.services.Users.RefreshTokens(ctx.Request.Context(), refreshToken)
+	tokens, err := h.services.Users.RefreshTokens(ctx.Request.Context(), refreshToken, getDevice(ctx))
 	if err != nil {
-		if errors.Is(err, models.ErrUserNotFound) {
-			ctx.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		if errors.Is(err, models.ErrSessionNotFound) || errors.Is(err, models.ErrRefreshTokenReused) {
+			ctx.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
 			return
 		}
 
@@ -237,10 +270,11 @@ func (h *Handler) userGetMe(ctx *gin.Context) {
 // @Summary Logout current user
 // @Security UsersAuth
 // @Tags users-auth
-// @Description logout current user by authentication header
+// @Description end session of authentication header, other sessions of user stay active
 // @Accept  json
 // @Produce  json
 // @Success 200 ""
+// @Failure 401 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /users/logout [post]
 func (h *Handler) userLogout(ctx *gin.Context) {
@@ -250,7 +284,13 @@ func (h *Handler) userLogout(ctx *gin.Context) {
 		return
 	}
 
-	if err := h.services.Users.Logout(ctx.Request.Context(), userId); err != nil {
+	sessionId, err := getIdByContext(ctx, sessionCtx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.services.Users.Logout(ctx.Request.Context(), userId, sessionId); err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
@@ -280,7 +320,7 @@ func (u *userUpdateEmailInput) isValidEmail() error {
 // @Summary User update email
 // @Security UsersAuth
 // @Tags users-auth
-// @Description update current user email
+// @Description set pending email of current user, it replaces current email after confirmation
 // @Accept  json
 // @Produce  json
 // @Param input body userUpdateEmailInput true "email info"
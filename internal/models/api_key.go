@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// ApiKeyPrefix starts every API key, so leaked keys are easy to recognise
+const ApiKeyPrefix = "shop_"
+
+// ApiKeyScopes lists permissions which can be granted to API keys. Keys
+// cannot manage users, roles or other keys
+var ApiKeyScopes = []Permission{
+	PermissionCatalogWrite,
+	PermissionImagesWrite,
+	PermissionOrdersManage,
+	PermissionCouponsManage,
+}
+
+func (p Permission) IsApiKeyScope() bool {
+	for _, scope := range ApiKeyScopes {
+		if p == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ApiKey struct {
+	Id   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	// Prefix is the beginning of key shown to tell keys apart
+	Prefix     string       `json:"prefix" db:"prefix"`
+	KeyHash    string       `json:"-" db:"key_hash"`
+	Scopes     []Permission `json:"scopes"`
+	CreatedBy  *int         `json:"createdBy" db:"created_by"`
+	CreatedAt  time.Time    `json:"createdAt" db:"created_at"`
+	ExpiresAt  *time.Time   `json:"expiresAt" db:"expires_at"`
+	LastUsedAt *time.Time   `json:"lastUsedAt" db:"last_used_at"`
+	LastUsedIp string       `json:"lastUsedIp" db:"last_used_ip"`
+	RevokedAt  *time.Time   `json:"revokedAt" db:"revoked_at"`
+}
+
+// NewApiKey is created or rotated key, Key is shown only once
+type NewApiKey struct {
+	ApiKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Entities recorded in audit log
+const (
+	AuditEntityItem     = "item"
+	AuditEntityColor    = "color"
+	AuditEntityCategory = "category"
+	AuditEntityImage    = "image"
+	AuditEntityCoupon   = "coupon"
+	AuditEntityOrder    = "order"
+	AuditEntityUser     = "user"
+	AuditEntityRole     = "role"
+	AuditEntityApiKey   = "api_key"
+)
+
+// AuditEntry is administrative change. Actor is either user or API key,
+// Diff holds changed fields of entity as {"field": {"from": ..., "to": ...}}
+type AuditEntry struct {
+	Id         int             `json:"id" db:"id"`
+	ActorId    *int            `json:"actorId" db:"actor_id"`
+	ApiKeyId   *int            `json:"apiKeyId" db:"api_key_id"`
+	Action     string          `json:"action" db:"action"`
+	EntityType string          `json:"entityType" db:"entity_type"`
+	EntityId   *int            `json:"entityId" db:"entity_id"`
+	Before     json.RawMessage `json:"before" db:"before"`
+	After      json.RawMessage `json:"after" db:"after"`
+	Diff       json.RawMessage `json:"diff" db:"diff"`
+	Ip         string          `json:"ip" db:"ip"`
+	CreatedAt  time.Time       `json:"createdAt" db:"created_at"`
+}
+
+type AuditFilter struct {
+	ActorId    *int
+	ApiKeyId   *int
+	Action     string
+	EntityType string
+	EntityId   *int
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
@@ -0,0 +1,41 @@
+package models
+
+const MaxCartItemQuantity = 99
+
+// CartOwner identifies cart either by authenticated user or by guest cart token
+type CartOwner struct {
+	UserId int
+	Token  string
+}
+
+func (o CartOwner) IsGuest() bool {
+	return o.UserId == 0
+}
+
+type Cart struct {
+	Id          int            `json:"id,omitempty" db:"id"`
+	Token       string         `json:"token,omitempty" db:"token"`
+	Items       []CartItem     `json:"items"`
+	Coupon      *AppliedCoupon `json:"coupon,omitempty"`
+	CouponError string         `json:"couponError,omitempty"`
+	Subtotal    float64        `json:"subtotal"`
+	Discount    float64        `json:"discount"`
+	Shipping    float64        `json:"shipping"`
+	Total       float64        `json:"total"`
+}
+
+type CartItem struct {
+	Id        int     `json:"id" db:"id"`
+	ItemId    int     `json:"itemId" db:"item_id"`
+	Name      string  `json:"name" db:"name"`
+	VariantId *int    `json:"variantId,omitempty" db:"variant_id"`
+	Sku       string  `json:"sku" db:"sku"`
+	Price     float64 `json:"price" db:"price"`
+	Color     Color   `json:"color"`
+	Quantity  int     `json:"quantity" db:"quantity"`
+	Total     float64 `json:"total"`
+	Discount  float64 `json:"discount"`
+
+	CategoryId int      `json:"-" db:"category_id"`
+	Tags       []string `json:"-"`
+}
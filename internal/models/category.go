@@ -1,6 +1,11 @@
 package models
 
 type Category struct {
-	Id   int    `json:"id,omitempty" db:"id"`
-	Name string `json:"name" binding:"required" db:"name"`
+	Id          int        `json:"id,omitempty" db:"id"`
+	Name        string     `json:"name" binding:"required" db:"name"`
+	ParentId    *int       `json:"parentId,omitempty" db:"parent_id"`
+	Slug        string     `json:"slug,omitempty" db:"slug"`
+	Position    int        `json:"position" db:"position"`
+	Breadcrumbs []Category `json:"breadcrumbs,omitempty"`
+	Children    []Category `json:"children,omitempty"`
 }
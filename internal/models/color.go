@@ -5,4 +5,5 @@ type Color struct {
 	Name  string  `json:"name" binding:"required" db:"name"`
 	Hex   string  `json:"hex" binding:"required" db:"hex"`
 	Price float64 `json:"price" binding:"required" db:"price"`
+	Stock *int    `json:"stock,omitempty" db:"stock"`
 }
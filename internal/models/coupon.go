@@ -0,0 +1,92 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+type CouponKind string
+
+const (
+	CouponKindPercent      CouponKind = "percent"
+	CouponKindFixed        CouponKind = "fixed"
+	CouponKindFreeShipping CouponKind = "free_shipping"
+)
+
+func (k CouponKind) IsValid() bool {
+	switch k {
+	case CouponKindPercent, CouponKindFixed, CouponKindFreeShipping:
+		return true
+	}
+
+	return false
+}
+
+type Coupon struct {
+	Id           int        `json:"id" db:"id"`
+	Code         string     `json:"code" db:"code"`
+	Kind         CouponKind `json:"kind" db:"kind"`
+	Value        float64    `json:"value" db:"value"`
+	MinTotal     float64    `json:"minTotal" db:"min_total"`
+	StartsAt     *time.Time `json:"startsAt,omitempty" db:"starts_at"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty" db:"expires_at"`
+	UsageLimit   *int       `json:"usageLimit,omitempty" db:"usage_limit"`
+	PerUserLimit *int       `json:"perUserLimit,omitempty" db:"per_user_limit"`
+	Used         int        `json:"used" db:"used"`
+	Categories   []int      `json:"categories"`
+	Tags         []string   `json:"tags"`
+	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
+
+	// CategoriesSubtree are ids of Categories and all their descendants
+	CategoriesSubtree []int `json:"-"`
+}
+
+// IsActive reports whether t is inside of coupon validity window
+func (c Coupon) IsActive(t time.Time) bool {
+	if c.StartsAt != nil && t.Before(*c.StartsAt) {
+		return false
+	}
+	if c.ExpiresAt != nil && !t.Before(*c.ExpiresAt) {
+		return false
+	}
+
+	return true
+}
+
+// AppliesTo reports whether item of category with tags is eligible for discount.
+// Items of descendants of coupon categories are eligible too. Coupon without
+// category and tag restrictions applies to every item
+func (c Coupon) AppliesTo(categoryId int, tags []string) bool {
+	if len(c.Categories) == 0 && len(c.Tags) == 0 {
+		return true
+	}
+
+	for _, ids := range [][]int{c.Categories, c.CategoriesSubtree} {
+		for _, id := range ids {
+			if id == categoryId {
+				return true
+			}
+		}
+	}
+	for _, couponTag := range c.Tags {
+		for _, tag := range tags {
+			if strings.EqualFold(couponTag, tag) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// NormalizeCouponCode makes coupon codes case-insensitive
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// AppliedCoupon is public part of coupon shown in cart
+type AppliedCoupon struct {
+	Code  string     `json:"code"`
+	Kind  CouponKind `json:"kind"`
+	Value float64    `json:"value"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+func TestCouponAppliesTo(t *testing.T) {
+	// Clothing (1) > Men (2) > Jackets (3), Shoes (4) is unrelated
+	clothing := Coupon{Categories: []int{1}, CategoriesSubtree: []int{1, 2, 3}}
+
+	tests := []struct {
+		name       string
+		coupon     Coupon
+		categoryId int
+		tags       []string
+		want       bool
+	}{
+		{name: "unrestricted", coupon: Coupon{}, categoryId: 4, want: true},
+		{name: "coupon category", coupon: clothing, categoryId: 1, want: true},
+		{name: "child category", coupon: clothing, categoryId: 2, want: true},
+		{name: "grandchild category", coupon: clothing, categoryId: 3, want: true},
+		{name: "other category", coupon: clothing, categoryId: 4, want: false},
+		{name: "subtree not loaded", coupon: Coupon{Categories: []int{1}}, categoryId: 1, want: true},
+		{name: "tag ignoring case", coupon: Coupon{Tags: []string{"Sale"}}, categoryId: 4, tags: []string{"new", "sale"}, want: true},
+		{name: "missing tag", coupon: Coupon{Tags: []string{"sale"}}, categoryId: 4, tags: []string{"new"}, want: false},
+		{name: "tag outside of categories", coupon: Coupon{Categories: []int{1}, CategoriesSubtree: []int{1, 2, 3}, Tags: []string{"sale"}},
+			categoryId: 4, tags: []string{"sale"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.coupon.AppliesTo(tt.categoryId, tt.tags); got != tt.want {
+				t.Fatalf("AppliesTo(%d, %v) = %v, want %v", tt.categoryId, tt.tags, got, tt.want)
+			}
+		})
+	}
+}
@@ -6,11 +6,70 @@ import (
 )
 
 var (
-	ErrEmptyAuthHeader   = errors.New("empty auth header")
-	ErrInvalidAuthHeader = errors.New("invalid auth header")
-	ErrUserNotFound      = errors.New("user not found")
-	ErrAddressNotFound   = errors.New("address not found")
-	ErrOldPassword       = errors.New("wrong old password")
+	ErrEmptyAuthHeader      = errors.New("empty auth header")
+	ErrInvalidAuthHeader    = errors.New("invalid auth header")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrAddressNotFound      = errors.New("address not found")
+	ErrOldPassword          = errors.New("wrong old password")
+	ErrWrongPassword        = errors.New("wrong password")
+	ErrCartNotFound         = errors.New("cart not found")
+	ErrCartItemNotFound     = errors.New("cart item not found")
+	ErrItemColorNotFound    = errors.New("item is not available in this color")
+	ErrItemVariantNotFound  = errors.New("item has no such variant")
+	ErrWrongQuantity        = errors.New("wrong quantity")
+	ErrEmptyCart            = errors.New("cart is empty")
+	ErrCartChanged          = errors.New("cart has been changed concurrently, review it and try again")
+	ErrOrderNotFound        = errors.New("order not found")
+	ErrWrongOrderStatus     = errors.New("wrong order status")
+	ErrOrderStatusChange    = errors.New("order status has been changed concurrently")
+	ErrRefundViaPayment     = errors.New("order is refunded by refunding its payment")
+	ErrOutOfStock           = errors.New("out of stock")
+	ErrNegativeStock        = errors.New("stock cannot be negative")
+	ErrSkuTaken             = errors.New("sku is already taken")
+	ErrVariantOptions       = errors.New("variants must define the same options with unique values")
+	ErrPaymentNotFound      = errors.New("payment not found")
+	ErrOrderNotPayable      = errors.New("order is not awaiting payment")
+	ErrPaymentStatus        = errors.New("payment status has been changed concurrently")
+	ErrCannotSimulate       = errors.New("payment provider does not support simulation")
+	ErrPaymentExists        = errors.New("order already has payment in progress or paid")
+	ErrCouponNotFound       = errors.New("coupon not found")
+	ErrCouponInactive       = errors.New("coupon is not active")
+	ErrCouponExhausted      = errors.New("coupon usage limit is reached")
+	ErrCouponMinTotal       = errors.New("cart total is below coupon minimum")
+	ErrCouponNotEligible    = errors.New("coupon does not apply to any cart item")
+	ErrCouponKind           = errors.New("wrong coupon kind")
+	ErrCouponTerms          = errors.New("wrong coupon terms")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+	ErrWrongItemsSort       = errors.New("wrong items sort")
+	ErrCategoryNotFound     = errors.New("category not found")
+	ErrCategoryCycle        = errors.New("category cannot be moved into its own subtree")
+	ErrCategoryHasItems     = errors.New("category has items, choose category to move them to")
+	ErrCategoryHasCoupons   = errors.New("category is the only one coupon is limited to, change coupon first")
+	ErrWrongSlug            = errors.New("slug must contain latin letters or digits")
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrInvalidToken         = errors.New("token is invalid or expired")
+	ErrEmailVerified        = errors.New("email is already verified")
+	ErrEmailNotVerified     = errors.New("email is not verified")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not enrolled")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorRequired    = errors.New("two-factor authentication is required")
+	ErrInvalidOneTimeCode   = errors.New("invalid one-time code")
+	ErrForbidden            = errors.New("permission denied")
+	ErrTokenRevoked         = errors.New("token has been revoked")
+	ErrApiKeyNotFound       = errors.New("api key not found")
+	ErrInvalidApiKey        = errors.New("invalid api key")
+	ErrWrongScope           = errors.New("permission cannot be granted to api key")
+	ErrTooManyRequests      = errors.New("too many requests, try again later")
+	ErrAccountLocked        = errors.New("account is locked after too many failed sign ins, check email to unlock")
+	ErrRoleNotFound         = errors.New("role not found")
+	ErrWrongPermission      = errors.New("unknown permission")
+	ErrRoleProtected        = errors.New("role granting all permissions cannot be deleted or lose them")
+	ErrLastSuperuser        = errors.New("at least one user must keep all permissions")
+	ErrRefreshTokenReused   = errors.New("refresh token has already been used, session is revoked")
+	ErrProviderNotFound     = errors.New("identity provider not found")
+	ErrIdentityNotFound     = errors.New("identity not found")
+	ErrProviderEmail        = errors.New("identity provider did not return verified email")
+	ErrIdentityNotLinked    = errors.New("account with this email has unverified email, sign in with password and verify it first")
 )
 
 type ErrUniqueValue struct {
@@ -26,3 +85,19 @@ func NewErrUniqueValue(field string) ErrUniqueValue {
 		Field: field,
 	}
 }
+
+type ErrOrderTransition struct {
+	From OrderStatus
+	To   OrderStatus
+}
+
+func (e ErrOrderTransition) Error() string {
+	return fmt.Sprintf("order status cannot be changed from %s to %s", e.From, e.To)
+}
+
+func NewErrOrderTransition(from, to OrderStatus) ErrOrderTransition {
+	return ErrOrderTransition{
+		From: from,
+		To:   to,
+	}
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// UserIdentity links account of external identity provider to user
+type UserIdentity struct {
+	Id       int    `json:"id" db:"id"`
+	UserId   int    `json:"userId" db:"user_id"`
+	Provider string `json:"provider" db:"provider"`
+	// Subject is id of user at provider, it never changes unlike email
+	Subject   string    `json:"subject" db:"subject"`
+	Email     string    `json:"email" db:"email"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// OAuthState is pending sign in with identity provider, kept until callback
+type OAuthState struct {
+	StateHash    string    `db:"state_hash"`
+	Provider     string    `db:"provider"`
+	CodeVerifier string    `db:"code_verifier"`
+	Nonce        string    `db:"nonce"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
@@ -10,7 +10,10 @@ type Item struct {
 	Images      []Image   `json:"images,omitempty"`
 	Tags        []Tag     `json:"tags,omitempty"`
 	Colors      []Color   `json:"colors,omitempty"`
+	Variants    []Variant `json:"variants,omitempty"`
+	Variant     *Variant  `json:"variant,omitempty"`
 	Price       float64   `json:"price" db:"price"`
 	Sku         string    `json:"sku" db:"sku"`
+	InStock     bool      `json:"inStock"`
 	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
 }
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	ListingDefaultLimit = 20
+	ListingMaxLimit     = 100
+)
+
+// PriceBuckets are upper bounds of price facet buckets, the last bucket has no upper bound
+var PriceBuckets = []float64{25, 50, 100, 200, 500}
+
+type ItemsSort string
+
+const (
+	ItemsSortNewest    ItemsSort = "newest"
+	ItemsSortPriceAsc  ItemsSort = "price_asc"
+	ItemsSortPriceDesc ItemsSort = "price_desc"
+	ItemsSortName      ItemsSort = "name"
+)
+
+func (s ItemsSort) IsValid() bool {
+	switch s {
+	case ItemsSortNewest, ItemsSortPriceAsc, ItemsSortPriceDesc, ItemsSortName:
+		return true
+	}
+
+	return false
+}
+
+// ItemsFilter narrows item listing. Tags and colors match if item has any of them,
+// different filters are combined. Descendants extends category filter to its subtree
+type ItemsFilter struct {
+	CategoryId  *int
+	Descendants bool
+	Tags        []string
+	ColorsId    []int
+	MinPrice    *float64
+	MaxPrice    *float64
+	InStock     bool
+}
+
+type ItemsQuery struct {
+	Filter ItemsFilter
+	Sort   ItemsSort
+	Cursor *ItemsCursor
+	Limit  int
+}
+
+// ItemsCursor points to the last item of listing page, Value is the sort
+// key of that item
+type ItemsCursor struct {
+	Sort  ItemsSort `json:"s"`
+	Value string    `json:"v"`
+	Id    int       `json:"i"`
+}
+
+func (c ItemsCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeItemsCursor(cursor string) (ItemsCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ItemsCursor{}, ErrInvalidCursor
+	}
+
+	var c ItemsCursor
+	if err := json.Unmarshal(data, &c); err != nil || !c.Sort.IsValid() || c.Id < 1 {
+		return ItemsCursor{}, ErrInvalidCursor
+	}
+
+	// Value is compared with sort column, so it must have its type
+	switch c.Sort {
+	case ItemsSortPriceAsc, ItemsSortPriceDesc:
+		price, err := strconv.ParseFloat(c.Value, 64)
+		if err != nil || math.IsNaN(price) || math.IsInf(price, 0) {
+			return ItemsCursor{}, ErrInvalidCursor
+		}
+	case ItemsSortNewest:
+		if _, err := time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			return ItemsCursor{}, ErrInvalidCursor
+		}
+	}
+
+	return c, nil
+}
+
+type ItemsPage struct {
+	Items      []Item `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	Facets     Facets `json:"facets"`
+}
+
+// Facets count items per filter value. Every facet is counted with all
+// filters applied except of its own
+type Facets struct {
+	Colors []ColorFacet `json:"colors"`
+	Tags   []TagFacet   `json:"tags"`
+	Prices []PriceFacet `json:"prices"`
+}
+
+type ColorFacet struct {
+	ColorId int    `json:"colorId" db:"id"`
+	Name    string `json:"name" db:"name"`
+	Hex     string `json:"hex" db:"hex"`
+	Count   int    `json:"count" db:"count"`
+}
+
+type TagFacet struct {
+	Name  string `json:"name" db:"name"`
+	Count int    `json:"count" db:"count"`
+}
+
+type PriceFacet struct {
+	From  float64  `json:"from"`
+	To    *float64 `json:"to,omitempty"`
+	Count int      `json:"count"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+type LoginAttempt struct {
+	Id     int  `json:"id" db:"id"`
+	UserId *int `json:"userId" db:"user_id"`
+	// Login is login or email the attempt was made with
+	Login string `json:"login" db:"login"`
+	Device
+	Success   bool      `json:"success" db:"success"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type LoginAttemptsFilter struct {
+	UserId  *int
+	Ip      string
+	Success *bool
+	Limit   int
+	Offset  int
+}
+
+// Lockout is account locked after too many failed sign ins
+type Lockout struct {
+	UserId      int       `json:"userId" db:"id"`
+	Login       string    `json:"login" db:"login"`
+	Email       string    `json:"email" db:"email"`
+	LockedUntil time.Time `json:"lockedUntil" db:"locked_until"`
+}
+
+// LockoutState is counter of failed sign ins and lockout of account, locked
+// or not
+type LockoutState struct {
+	UserId       int        `json:"userId" db:"id"`
+	FailedLogins int        `json:"failedLogins" db:"failed_logins"`
+	LockedUntil  *time.Time `json:"lockedUntil" db:"locked_until"`
+}
@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusShipped   OrderStatus = "shipped"
+	OrderStatusDelivered OrderStatus = "delivered"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRefunded  OrderStatus = "refunded"
+)
+
+// orderTransitions describes allowed order lifecycle, statuses without
+// outgoing transitions are final
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusShipped, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered},
+	OrderStatusDelivered: {OrderStatusRefunded},
+}
+
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusShipped,
+		OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+		return true
+	}
+
+	return false
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, status := range orderTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Order struct {
+	Id              int            `json:"id" db:"id"`
+	UserId          *int           `json:"userId,omitempty" db:"user_id"`
+	Status          OrderStatus    `json:"status" db:"status"`
+	Total           float64        `json:"total" db:"total"`
+	Discount        float64        `json:"discount" db:"discount"`
+	Shipping        float64        `json:"shipping" db:"shipping"`
+	CouponId        *int           `json:"-"`
+	CouponCode      *string        `json:"couponCode,omitempty" db:"coupon_code"`
+	InvoiceAddress  Address        `json:"invoiceAddress"`
+	ShippingAddress Address        `json:"shippingAddress"`
+	Items           []OrderItem    `json:"items,omitempty"`
+	History         []OrderHistory `json:"history,omitempty"`
+	CreatedAt       time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time      `json:"updatedAt" db:"updated_at"`
+}
+
+// OrderItem is snapshot of cart line at the time of purchase
+type OrderItem struct {
+	Id        int     `json:"id" db:"id"`
+	ItemId    *int    `json:"itemId,omitempty" db:"item_id"`
+	Name      string  `json:"name" db:"name"`
+	VariantId *int    `json:"variantId,omitempty" db:"variant_id"`
+	Sku       string  `json:"sku" db:"sku"`
+	Price     float64 `json:"price" db:"price"`
+	Color     Color   `json:"color"`
+	Quantity  int     `json:"quantity" db:"quantity"`
+	Total     float64 `json:"total" db:"total"`
+	Discount  float64 `json:"discount" db:"discount"`
+}
+
+type OrderHistory struct {
+	Status    OrderStatus `json:"status" db:"status"`
+	CreatedAt time.Time   `json:"createdAt" db:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type Payment struct {
+	Id         int       `json:"id" db:"id"`
+	OrderId    int       `json:"orderId" db:"order_id"`
+	Provider   string    `json:"provider" db:"provider"`
+	IntentId   string    `json:"intentId" db:"intent_id"`
+	Amount     float64   `json:"amount" db:"amount"`
+	Currency   string    `json:"currency" db:"currency"`
+	Status     string    `json:"status" db:"status"`
+	ConfirmURL string    `json:"confirmUrl,omitempty"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+type Permission string
+
+const (
+	PermissionCatalogWrite  Permission = "catalog:write"
+	PermissionImagesWrite   Permission = "images:write"
+	PermissionOrdersManage  Permission = "orders:manage"
+	PermissionCouponsManage Permission = "coupons:manage"
+	PermissionUsersManage   Permission = "users:manage"
+	PermissionAuditRead     Permission = "audit:read"
+	// PermissionAll grants every permission, including ones added later
+	PermissionAll Permission = "*"
+)
+
+// Permissions lists all permissions which can be granted to roles
+var Permissions = []Permission{
+	PermissionCatalogWrite,
+	PermissionImagesWrite,
+	PermissionOrdersManage,
+	PermissionCouponsManage,
+	PermissionUsersManage,
+	PermissionAuditRead,
+	PermissionAll,
+}
+
+func (p Permission) IsValid() bool {
+	for _, permission := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SuperuserRole is created by migration for former admins
+const SuperuserRole = "superuser"
+
+type Role struct {
+	Id          int          `json:"id" db:"id"`
+	Name        string       `json:"name" db:"name"`
+	Description string       `json:"description" db:"description"`
+	Permissions []Permission `json:"permissions"`
+	CreatedAt   time.Time    `json:"createdAt" db:"created_at"`
+}
+
+// HasPermission reports whether any of permissions grants required one
+func HasPermission(permissions []Permission, required Permission) bool {
+	for _, permission := range permissions {
+		if permission == required || permission == PermissionAll {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,19 @@
+package models
+
+const (
+	SearchDefaultLimit = 20
+	SearchMaxLimit     = 100
+)
+
+// SearchResult is item found by full-text search. Highlight is HTML escaped
+// text with matched words wrapped into <mark></mark>
+type SearchResult struct {
+	Item      Item            `json:"item"`
+	Rank      float64         `json:"rank"`
+	Highlight SearchHighlight `json:"highlight"`
+}
+
+type SearchHighlight struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
@@ -2,7 +2,21 @@ package models
 
 import "time"
 
+// Device describes client the session was started from
+type Device struct {
+	UserAgent string `json:"userAgent" db:"user_agent"`
+	Ip        string `json:"ip" db:"ip"`
+}
+
 type Session struct {
-	RefreshToken string    `json:"refreshToken" bd:"refresh_token"`
-	ExpiresAt    time.Time `json:"expiresAt" bd:"expires_at"`
+	Id     int `json:"id" db:"id"`
+	UserId int `json:"-" db:"user_id"`
+	// RefreshToken holds SHA-256 hash of refresh token, never the token itself
+	RefreshToken string    `json:"-" db:"refresh_token"`
+	ExpiresAt    time.Time `json:"expiresAt" db:"expires_at"`
+	Device
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	LastUsedAt time.Time `json:"lastUsedAt" db:"last_used_at"`
+	// Current marks session the request was authenticated with
+	Current bool `json:"current" db:"-"`
 }
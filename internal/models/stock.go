@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type StockMovement struct {
+	Id        int       `json:"id" db:"id"`
+	ItemId    int       `json:"itemId" db:"item_id"`
+	ColorId   int       `json:"colorId" db:"color_id"`
+	VariantId *int      `json:"variantId,omitempty" db:"variant_id"`
+	Delta     int       `json:"delta" db:"delta"`
+	Reason    string    `json:"reason" db:"reason"`
+	OrderId   *int      `json:"orderId,omitempty" db:"order_id"`
+	UserId    *int      `json:"userId,omitempty" db:"user_id"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
@@ -1,6 +1,9 @@
 package models
 
 type Tokens struct {
-	AccessToken  string `json:"accessToken"`
+	AccessToken  string `json:"accessToken,omitempty"`
 	RefreshToken string `json:"refreshToken,omitempty"`
+	// ChallengeToken is returned instead of other tokens when sign in has to
+	// be completed with one-time code
+	ChallengeToken string `json:"challengeToken,omitempty"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const RecoveryCodesCount = 10
+
+// TwoFactor is TOTP enrollment of user, it protects sign in only after it is enabled
+type TwoFactor struct {
+	UserId    int       `json:"-" db:"user_id"`
+	Secret    string    `json:"-" db:"secret"`
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	LastStep  *int64    `json:"-" db:"last_step"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// TwoFactorEnrollment is shown to user once to set up authenticator app
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
@@ -1,14 +1,26 @@
 package models
 
+import "time"
+
 type User struct {
-	Id              int      `json:"id,omitempty" db:"id"`
-	Login           string   `json:"login" db:"login"`
-	Email           string   `json:"email" db:"email"`
+	Id            int    `json:"id,omitempty" db:"id"`
+	Login         string `json:"login" db:"login"`
+	Email         string `json:"email" db:"email"`
+	EmailVerified bool   `json:"emailVerified" db:"email_verified"`
+	// PendingEmail is new address awaiting confirmation, Email stays in use until then
+	PendingEmail    *string  `json:"pendingEmail,omitempty" db:"pending_email"`
 	Password        string   `json:"password,omitempty" db:"password"`
 	FirstName       *string  `json:"firstName,omitempty" db:"first_name"`
 	LastName        *string  `json:"lastName,omitempty" db:"last_name"`
 	Phone           string   `json:"phone,omitempty" db:"phone"`
 	InvoiceAddress  *Address `json:"invoiceAddress,omitempty"`
 	ShippingAddress *Address `json:"shippingAddress,omitempty"`
-	Admin           bool     `json:"admin,omitempty" db:"admin"`
+	Roles           []string `json:"roles,omitempty" db:"-"`
+	// TokenVersion is embedded in access tokens, tokens with older version are rejected
+	TokenVersion int `json:"-" db:"token_version"`
+	// FailedLogins counts consecutive failed sign ins, LockedUntil is set once they reach the limit
+	FailedLogins int        `json:"-" db:"failed_logins"`
+	LockedUntil  *time.Time `json:"-" db:"locked_until"`
+	// TwoFactorEnabled is filled from TOTP enrollment of user
+	TwoFactorEnabled bool `json:"twoFactorEnabled" db:"-"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type UserTokenKind string
+
+const (
+	UserTokenPasswordReset     UserTokenKind = "password_reset"
+	UserTokenEmailVerification UserTokenKind = "email_verification"
+	UserTokenTwoFactor         UserTokenKind = "two_factor_challenge"
+	UserTokenUnlock            UserTokenKind = "unlock"
+)
+
+// UserToken is single-use token sent to user by email
+type UserToken struct {
+	Id        int           `json:"id" db:"id"`
+	UserId    int           `json:"userId" db:"user_id"`
+	Kind      UserTokenKind `json:"kind" db:"kind"`
+	TokenHash string        `json:"-" db:"token_hash"`
+	Email     string        `json:"email,omitempty" db:"email"` // address email verification was sent to
+	ExpiresAt time.Time     `json:"expiresAt" db:"expires_at"`
+	UsedAt    *time.Time    `json:"usedAt" db:"used_at"`
+	Attempts  int           `json:"attempts" db:"attempts"`
+	CreatedAt time.Time     `json:"createdAt" db:"created_at"`
+}
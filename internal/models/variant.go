@@ -0,0 +1,13 @@
+package models
+
+// Variant is concrete purchasable version of item described by option
+// values, e.g. {"size": "M", "material": "cotton"}
+type Variant struct {
+	Id      int               `json:"id,omitempty" db:"id"`
+	ItemId  int               `json:"itemId" db:"item_id"`
+	Sku     string            `json:"sku" db:"sku"`
+	Price   *float64          `json:"price,omitempty" db:"price"`
+	Stock   *int              `json:"stock,omitempty" db:"stock"`
+	Options map[string]string `json:"options"`
+	Images  []Image           `json:"images,omitempty"`
+}
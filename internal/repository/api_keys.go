@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"shop_backend/internal/models"
+)
+
+type ApiKeysRepo struct {
+	db *sqlx.DB
+}
+
+func NewApiKeysRepo(db *sqlx.DB) *ApiKeysRepo {
+	return &ApiKeysRepo{db: db}
+}
+
+func (r *ApiKeysRepo) Create(ctx context.Context, key models.ApiKey) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (name,prefix,key_hash,created_by,expires_at) VALUES ($1,$2,$3,$4,$5) RETURNING id;", apiKeysTable)
+	if err := tx.QueryRowxContext(ctx, query, key.Name, key.Prefix, key.KeyHash, key.CreatedBy, key.ExpiresAt).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	scopesQuery := fmt.Sprintf("INSERT INTO %s (api_key_id,permission) VALUES ($1,$2) ON CONFLICT DO NOTHING;", apiKeysScopesTable)
+	for _, scope := range key.Scopes {
+		if _, err := tx.ExecContext(ctx, scopesQuery, id, scope); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+const apiKeyColumns = `K.id, K.name, K.prefix, K.key_hash, K.created_by, K.created_at, K.expires_at, K.last_used_at, K.last_used_ip, K.revoked_at,
+	ARRAY(SELECT S.permission FROM api_keys_scopes AS S WHERE S.api_key_id=K.id ORDER BY S.permission)`
+
+func scanApiKey(row rowScanner) (models.ApiKey, error) {
+	var (
+		key    models.ApiKey
+		scopes []string
+	)
+	if err := row.Scan(&key.Id, &key.Name, &key.Prefix, &key.KeyHash, &key.CreatedBy, &key.CreatedAt, &key.ExpiresAt,
+		&key.LastUsedAt, &key.LastUsedIp, &key.RevokedAt, pq.Array(&scopes)); err != nil {
+		return models.ApiKey{}, err
+	}
+
+	key.Scopes = make([]models.Permission, 0, len(scopes))
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, models.Permission(scope))
+	}
+
+	return key, nil
+}
+
+func (r *ApiKeysRepo) GetById(ctx context.Context, keyId int) (models.ApiKey, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s AS K WHERE K.id=$1;", apiKeyColumns, apiKeysTable)
+	key, err := scanApiKey(r.db.QueryRowxContext(ctx, query, keyId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ApiKey{}, models.ErrApiKeyNotFound
+	}
+
+	return key, err
+}
+
+// GetActive returns not revoked and not expired key by hash
+func (r *ApiKeysRepo) GetActive(ctx context.Context, keyHash string) (models.ApiKey, error) {
+	query := fmt.Sprintf(`SELECT %s FROM %s AS K
+		WHERE K.key_hash=$1 AND K.revoked_at IS NULL AND (K.expires_at IS NULL OR K.expires_at > now());`, apiKeyColumns, apiKeysTable)
+	key, err := scanApiKey(r.db.QueryRowxContext(ctx, query, keyHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ApiKey{}, models.ErrInvalidApiKey
+	}
+
+	return key, err
+}
+
+// GetAll returns all keys including revoked ones, the newest first
+func (r *ApiKeysRepo) GetAll(ctx context.Context) ([]models.ApiKey, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s AS K ORDER BY K.created_at DESC, K.id DESC;", apiKeyColumns, apiKeysTable)
+	rows, err := r.db.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]models.ApiKey, 0)
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Rotate replaces hash of not revoked key, the old key stops working at once
+func (r *ApiKeysRepo) Rotate(ctx context.Context, keyId int, prefix, keyHash string) error {
+	query := fmt.Sprintf("UPDATE %s SET prefix=$1, key_hash=$2, last_used_at=NULL, last_used_ip='' WHERE id=$3 AND revoked_at IS NULL;", apiKeysTable)
+	res, err := r.db.ExecContext(ctx, query, prefix, keyHash, keyId)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrApiKeyNotFound)
+}
+
+// Revoke disables key, it is kept to show when it was used
+func (r *ApiKeysRepo) Revoke(ctx context.Context, keyId int) error {
+	query := fmt.Sprintf("UPDATE %s SET revoked_at=now() WHERE id=$1 AND revoked_at IS NULL;", apiKeysTable)
+	res, err := r.db.ExecContext(ctx, query, keyId)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrApiKeyNotFound)
+}
+
+// Touch records use of key. Use is recorded at most once a minute, so busy
+// integrations do not write on every request
+func (r *ApiKeysRepo) Touch(ctx context.Context, keyId int, ip string) error {
+	query := fmt.Sprintf(`UPDATE %s SET last_used_at=now(), last_used_ip=$1
+		WHERE id=$2 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute');`, apiKeysTable)
+	_, err := r.db.ExecContext(ctx, query, ip, keyId)
+
+	return err
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"shop_backend/internal/models"
+)
+
+type AuditRepo struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepo(db *sqlx.DB) *AuditRepo {
+	return &AuditRepo{db: db}
+}
+
+// Create appends entry to log, entries are never changed afterwards
+func (r *AuditRepo) Create(ctx context.Context, entry models.AuditEntry) error {
+	query := fmt.Sprintf(`INSERT INTO %s (actor_id,api_key_id,action,entity_type,entity_id,before,after,diff,ip)
+		VALUES ($1,$2,$3,$4,$5,$6::jsonb,$7::jsonb,$8::jsonb,$9);`, auditLogTable)
+	_, err := r.db.ExecContext(ctx, query, entry.ActorId, entry.ApiKeyId, entry.Action, entry.EntityType, entry.EntityId,
+		jsonValue(entry.Before), jsonValue(entry.After), jsonValue(entry.Diff), entry.Ip)
+
+	return err
+}
+
+// GetAll returns entries matching filter, the latest first
+func (r *AuditRepo) GetAll(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	var c itemsConditions
+	if filter.ActorId != nil {
+		c.add("actor_id=" + c.arg(*filter.ActorId))
+	}
+	if filter.ApiKeyId != nil {
+		c.add("api_key_id=" + c.arg(*filter.ApiKeyId))
+	}
+	if filter.Action != "" {
+		c.add("action=" + c.arg(filter.Action))
+	}
+	if filter.EntityType != "" {
+		c.add("entity_type=" + c.arg(filter.EntityType))
+	}
+	if filter.EntityId != nil {
+		c.add("entity_id=" + c.arg(*filter.EntityId))
+	}
+	if filter.From != nil {
+		c.add("created_at>=" + c.arg(*filter.From))
+	}
+	if filter.To != nil {
+		c.add("created_at<" + c.arg(*filter.To))
+	}
+
+	entries := make([]models.AuditEntry, 0)
+	query := fmt.Sprintf(`SELECT id, actor_id, api_key_id, action, entity_type, entity_id, before, after, diff, ip, created_at
+		FROM %s %s ORDER BY created_at DESC, id DESC LIMIT %s OFFSET %s;`,
+		auditLogTable, c.where(), c.arg(filter.Limit), c.arg(filter.Offset))
+	if err := r.db.SelectContext(ctx, &entries, query, c.args...); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// jsonValue passes JSON document as text, so it can be cast to jsonb. Empty
+// document is stored as NULL
+func jsonValue(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return string(data)
+}
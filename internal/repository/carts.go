@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"shop_backend/internal/models"
+)
+
+type CartsRepo struct {
+	db *sqlx.DB
+}
+
+func NewCartsRepo(db *sqlx.DB) *CartsRepo {
+	return &CartsRepo{db: db}
+}
+
+// $1 = userId
+func (r *CartsRepo) GetOrCreate(ctx context.Context, userId int) (int, error) {
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (user_id) VALUES ($1) ON CONFLICT (user_id) DO UPDATE SET updated_at=now() RETURNING id;", cartsTable)
+	if err := r.db.QueryRowContext(ctx, query, userId).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// $1 = token
+func (r *CartsRepo) CreateGuest(ctx context.Context, token string) (int, error) {
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (token) VALUES ($1) RETURNING id;", cartsTable)
+	if err := r.db.QueryRowContext(ctx, query, token).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// $1 = token
+func (r *CartsRepo) GetByToken(ctx context.Context, token string) (int, error) {
+	var id int
+	query := fmt.Sprintf("UPDATE %s SET updated_at=now() WHERE token=$1 AND user_id IS NULL RETURNING id;", cartsTable)
+	if err := r.db.QueryRowContext(ctx, query, token).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrCartNotFound
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Merge moves guest cart lines into user cart summing quantities of equal lines
+// and deletes guest cart afterwards
+func (r *CartsRepo) Merge(ctx context.Context, token string, userId int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var guestId int
+	guestQuery := fmt.Sprintf("SELECT id FROM %s WHERE token=$1 AND user_id IS NULL FOR UPDATE;", cartsTable)
+	if err := tx.QueryRowContext(ctx, guestQuery, token).Scan(&guestId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrCartNotFound
+		}
+		return err
+	}
+
+	var userCartId int
+	userQuery := fmt.Sprintf("INSERT INTO %s (user_id) VALUES ($1) ON CONFLICT (user_id) DO UPDATE SET updated_at=now() RETURNING id;", cartsTable)
+	if err := tx.QueryRowContext(ctx, userQuery, userId).Scan(&userCartId); err != nil {
+		return err
+	}
+
+	mergeQuery := fmt.Sprintf(`INSERT INTO %s (cart_id,item_id,color_id,variant_id,quantity)
+		SELECT $1, item_id, color_id, variant_id, quantity FROM %s WHERE cart_id=$2
+		ON CONFLICT (cart_id,item_id,color_id,COALESCE(variant_id, 0)) DO UPDATE SET quantity=LEAST(%s.quantity + EXCLUDED.quantity, %d);`,
+		cartsItemsTable, cartsItemsTable, cartsItemsTable, models.MaxCartItemQuantity)
+	if _, err := tx.ExecContext(ctx, mergeQuery, userCartId, guestId); err != nil {
+		return err
+	}
+
+	// Coupon applied to guest cart is kept unless user cart already has one
+	couponQuery := fmt.Sprintf(`UPDATE %s AS U SET coupon_id=G.coupon_id FROM %s AS G
+		WHERE U.id=$1 AND G.id=$2 AND U.coupon_id IS NULL;`, cartsTable, cartsTable)
+	if _, err := tx.ExecContext(ctx, couponQuery, userCartId, guestId); err != nil {
+		return err
+	}
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE id=$1;", cartsTable)
+	if _, err := tx.ExecContext(ctx, deleteQuery, guestId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// $1 = cartId
+// $2 = itemId
+// $3 = colorId
+// $4 = variantId
+// $5 = quantity
+func (r *CartsRepo) AddItem(ctx context.Context, cartId, itemId, colorId int, variantId *int, quantity int) error {
+	query := fmt.Sprintf(`INSERT INTO %s (cart_id,item_id,color_id,variant_id,quantity) VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (cart_id,item_id,color_id,COALESCE(variant_id, 0)) DO UPDATE SET quantity=LEAST(%s.quantity + EXCLUDED.quantity, %d);`,
+		cartsItemsTable, cartsItemsTable, models.MaxCartItemQuantity)
+	_, err := r.db.ExecContext(ctx, query, cartId, itemId, colorId, variantId, quantity)
+
+	return err
+}
+
+// $1 = quantity
+// $2 = cartId
+// $3 = lineId
+func (r *CartsRepo) UpdateQuantity(ctx context.Context, cartId, lineId, quantity int) error {
+	query := fmt.Sprintf("UPDATE %s SET quantity=$1 WHERE cart_id=$2 AND id=$3;", cartsItemsTable)
+	res, err := r.db.ExecContext(ctx, query, quantity, cartId, lineId)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrCartItemNotFound)
+}
+
+// $1 = cartId
+// $2 = lineId
+func (r *CartsRepo) DeleteItem(ctx context.Context, cartId, lineId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE cart_id=$1 AND id=$2;", cartsItemsTable)
+	res, err := r.db.ExecContext(ctx, query, cartId, lineId)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrCartItemNotFound)
+}
+
+// Clear removes all cart lines together with applied coupon
+func (r *CartsRepo) Clear(ctx context.Context, cartId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE cart_id=$1;", cartsItemsTable)
+	if _, err := r.db.ExecContext(ctx, query, cartId); err != nil {
+		return err
+	}
+
+	return r.SetCoupon(ctx, cartId, nil)
+}
+
+// $1 = couponId
+// $2 = cartId
+func (r *CartsRepo) SetCoupon(ctx context.Context, cartId int, couponId *int) error {
+	query := fmt.Sprintf("UPDATE %s SET coupon_id=$1, updated_at=now() WHERE id=$2;", cartsTable)
+	res, err := r.db.ExecContext(ctx, query, couponId, cartId)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrCartNotFound)
+}
+
+// $1 = cartId
+func (r *CartsRepo) GetCouponId(ctx context.Context, cartId int) (*int, error) {
+	var couponId *int
+	query := fmt.Sprintf("SELECT coupon_id FROM %s WHERE id=$1;", cartsTable)
+	if err := r.db.QueryRowContext(ctx, query, cartId).Scan(&couponId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrCartNotFound
+		}
+		return nil, err
+	}
+
+	return couponId, nil
+}
+
+// GetItems returns cart lines, sku and price of variant replace ones of item
+// $1 = cartId
+func (r *CartsRepo) GetItems(ctx context.Context, cartId int) ([]models.CartItem, error) {
+	items := make([]models.CartItem, 0)
+	query := fmt.Sprintf(`SELECT CI.id, CI.item_id, I.name, CI.variant_id, COALESCE(V.sku, I.sku), COALESCE(V.price, I.price), I.category_id,
+		ARRAY(SELECT T.name FROM %s AS T WHERE T.item_id=I.id), C.id, C.name, C.hex, C.price, CI.quantity
+		FROM %s AS CI JOIN %s AS I ON I.id=CI.item_id JOIN %s AS C ON C.id=CI.color_id LEFT JOIN %s AS V ON V.id=CI.variant_id
+		WHERE CI.cart_id=$1 ORDER BY CI.id;`,
+		tagsTable, cartsItemsTable, itemsTable, colorsTable, itemsVariantsTable)
+	rows, err := r.db.QueryContext(ctx, query, cartId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.CartItem
+		if err := rows.Scan(&item.Id, &item.ItemId, &item.Name, &item.VariantId, &item.Sku, &item.Price, &item.CategoryId,
+			pq.Array(&item.Tags), &item.Color.Id, &item.Color.Name, &item.Color.Hex, &item.Color.Price, &item.Quantity); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
@@ -16,12 +16,21 @@ func NewCategoriesRepo(db *sqlx.DB) *CategoriesRepo {
 	return &CategoriesRepo{db: db}
 }
 
+const categoryColumns = "id, name, parent_id, slug, position"
+
+// categorySubtree returns query selecting ids of category and all its descendants
+func categorySubtree(categoryArg string) string {
+	return fmt.Sprintf(`WITH RECURSIVE subtree AS (SELECT id FROM %s WHERE id=%s
+		UNION ALL SELECT C.id FROM %s AS C JOIN subtree AS S ON C.parent_id=S.id) SELECT id FROM subtree`,
+		categoriesTable, categoryArg, categoriesTable)
+}
+
 func (r *CategoriesRepo) Create(category models.Category) (int, error) {
 	var id int
-	query := fmt.Sprintf("INSERT INTO %s (name) VALUES ($1) RETURNING id;", categoriesTable)
-	row := r.db.QueryRow(query, category.Name)
+	query := fmt.Sprintf("INSERT INTO %s (name,parent_id,slug,position) VALUES ($1,$2,$3,$4) RETURNING id;", categoriesTable)
+	row := r.db.QueryRow(query, category.Name, category.ParentId, category.Slug, category.Position)
 	if err := row.Scan(&id); err != nil {
-		return 0, err
+		return 0, uniqueViolation(err, "slug")
 	}
 
 	return id, nil
@@ -37,16 +46,100 @@ func (r *CategoriesRepo) Exist(categoryId int) (bool, error) {
 	return exist, nil
 }
 
-func (r *CategoriesRepo) Delete(categoryId int) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE id=$1;", categoriesTable)
-	_, err := r.db.Exec(query, categoryId)
+// Delete removes category keeping its subtree: children are attached to the
+// parent of deleted category and items are moved to moveTo or to the parent.
+// Coupons limited to category are limited to where its items and children
+// went instead, so they never start applying to the whole store. Root category
+// with items cannot be deleted without moveTo
+func (r *CategoriesRepo) Delete(categoryId int, moveTo *int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentId *int
+	lockQuery := fmt.Sprintf("SELECT parent_id FROM %s WHERE id=$1 FOR UPDATE;", categoriesTable)
+	if err := tx.QueryRow(lockQuery, categoryId).Scan(&parentId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrCategoryNotFound
+		}
+		return err
+	}
+
+	target := parentId
+	if moveTo != nil {
+		target = moveTo
+	}
+
+	if target != nil {
+		itemsQuery := fmt.Sprintf("UPDATE %s SET category_id=$1 WHERE category_id=$2;", itemsTable)
+		if _, err := tx.Exec(itemsQuery, *target, categoryId); err != nil {
+			return err
+		}
+	} else {
+		var hasItems bool
+		itemsQuery := fmt.Sprintf("SELECT exists (SELECT 1 FROM %s WHERE category_id=$1);", itemsTable)
+		if err := tx.QueryRow(itemsQuery, categoryId).Scan(&hasItems); err != nil {
+			return err
+		}
+		if hasItems {
+			return models.ErrCategoryHasItems
+		}
+	}
+
+	if err := moveCouponsCategory(tx, categoryId, target); err != nil {
+		return err
+	}
+
+	childrenQuery := fmt.Sprintf("UPDATE %s SET parent_id=$1 WHERE parent_id=$2;", categoriesTable)
+	if _, err := tx.Exec(childrenQuery, parentId, categoryId); err != nil {
+		return uniqueViolation(err, "slug")
+	}
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE id=$1;", categoriesTable)
+	if _, err := tx.Exec(deleteQuery, categoryId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// moveCouponsCategory limits coupons of category to target and to children of
+// category. Coupon left without any other category is not moved anywhere, it
+// has to be changed first
+func moveCouponsCategory(tx *sqlx.Tx, categoryId int, target *int) error {
+	if target != nil {
+		targetQuery := fmt.Sprintf(`INSERT INTO %s (coupon_id,category_id) SELECT coupon_id, $1 FROM %s WHERE category_id=$2
+			ON CONFLICT DO NOTHING;`, couponsCategoriesTable, couponsCategoriesTable)
+		if _, err := tx.Exec(targetQuery, *target, categoryId); err != nil {
+			return err
+		}
+	}
+
+	childrenQuery := fmt.Sprintf(`INSERT INTO %s (coupon_id,category_id) SELECT CC.coupon_id, C.id FROM %s AS CC, %s AS C
+		WHERE CC.category_id=$1 AND C.parent_id=$1 ON CONFLICT DO NOTHING;`, couponsCategoriesTable, couponsCategoriesTable, categoriesTable)
+	if _, err := tx.Exec(childrenQuery, categoryId); err != nil {
+		return err
+	}
+
+	var orphaned bool
+	orphanedQuery := fmt.Sprintf(`SELECT exists (SELECT 1 FROM %s AS CC WHERE CC.category_id=$1
+		AND NOT EXISTS (SELECT 1 FROM %s AS O WHERE O.coupon_id=CC.coupon_id AND O.category_id<>$1));`, couponsCategoriesTable, couponsCategoriesTable)
+	if err := tx.QueryRow(orphanedQuery, categoryId).Scan(&orphaned); err != nil {
+		return err
+	}
+	if orphaned {
+		return models.ErrCategoryHasCoupons
+	}
 
-	return err
+	return nil
 }
 
+// GetAll returns flat list of categories ordered by position inside of their parents
 func (r *CategoriesRepo) GetAll() ([]models.Category, error) {
 	var categories []models.Category
-	query := fmt.Sprintf("SELECT * FROM %s;", categoriesTable)
+	query := fmt.Sprintf("SELECT %s FROM %s ORDER BY position, name;", categoryColumns, categoriesTable)
 	err := r.db.Select(&categories, query)
 	if err != nil {
 		return nil, err
@@ -57,19 +150,85 @@ func (r *CategoriesRepo) GetAll() ([]models.Category, error) {
 
 func (r *CategoriesRepo) GetById(categoryId int) (models.Category, error) {
 	var category models.Category
-	query := fmt.Sprintf("SELECT * FROM %s WHERE id=$1;", categoriesTable)
-	if err := r.db.QueryRow(query, categoryId).Scan(&category.Id, &category.Name); err != nil && !errors.Is(err, sql.ErrNoRows) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id=$1;", categoryColumns, categoriesTable)
+	if err := r.db.Get(&category, query, categoryId); err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return models.Category{}, err
 	}
 
 	return category, nil
 }
 
+// GetPath returns ancestors of category starting from the root, category itself is not included
+func (r *CategoriesRepo) GetPath(categoryId int) ([]models.Category, error) {
+	path := make([]models.Category, 0)
+	query := fmt.Sprintf(`WITH RECURSIVE ancestors AS (
+			SELECT P.id, P.name, P.parent_id, P.slug, P.position, 1 AS depth FROM %s AS C JOIN %s AS P ON P.id=C.parent_id WHERE C.id=$1
+			UNION ALL SELECT P.id, P.name, P.parent_id, P.slug, P.position, A.depth + 1 FROM %s AS P JOIN ancestors AS A ON P.id=A.parent_id)
+		SELECT %s FROM ancestors ORDER BY depth DESC;`, categoriesTable, categoriesTable, categoriesTable, categoryColumns)
+	if err := r.db.Select(&path, query, categoryId); err != nil {
+		return nil, err
+	}
+
+	return path, nil
+}
+
+// $1 = categoryId
+func (r *CategoriesRepo) GetChildren(categoryId int) ([]models.Category, error) {
+	children := make([]models.Category, 0)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE parent_id=$1 ORDER BY position, name;", categoryColumns, categoriesTable)
+	if err := r.db.Select(&children, query, categoryId); err != nil {
+		return nil, err
+	}
+
+	return children, nil
+}
+
 // $1 = category.Name
-// $2 = category.Id
+// $2 = category.Slug
+// $3 = category.Id
 func (r *CategoriesRepo) Update(category models.Category) error {
-	query := fmt.Sprintf("UPDATE %s SET name=$1 WHERE id=$2;", categoriesTable)
-	_, err := r.db.Exec(query, category.Name, category.Id)
+	query := fmt.Sprintf("UPDATE %s SET name=$1, slug=$2 WHERE id=$3;", categoriesTable)
+	res, err := r.db.Exec(query, category.Name, category.Slug, category.Id)
+	if err != nil {
+		return uniqueViolation(err, "slug")
+	}
+
+	return checkAffected(res, models.ErrCategoryNotFound)
+}
+
+// Move attaches category with its subtree to new parent, nil parent makes it root.
+// Table is locked for writes so concurrent moves cannot create a cycle
+func (r *CategoriesRepo) Move(categoryId int, parentId *int, position int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lockQuery := fmt.Sprintf("LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE;", categoriesTable)
+	if _, err := tx.Exec(lockQuery); err != nil {
+		return err
+	}
+
+	if parentId != nil {
+		var cycle bool
+		cycleQuery := fmt.Sprintf("SELECT $2 IN (%s);", categorySubtree("$1"))
+		if err := tx.QueryRow(cycleQuery, categoryId, *parentId).Scan(&cycle); err != nil {
+			return err
+		}
+		if cycle {
+			return models.ErrCategoryCycle
+		}
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET parent_id=$1, position=$2 WHERE id=$3;", categoriesTable)
+	res, err := tx.Exec(query, parentId, position, categoryId)
+	if err != nil {
+		return uniqueViolation(err, "slug")
+	}
+	if err := checkAffected(res, models.ErrCategoryNotFound); err != nil {
+		return err
+	}
 
-	return err
+	return tx.Commit()
 }
@@ -51,7 +51,7 @@ func (r *ColorsRepo) DeleteFromItems(colorId int) error {
 }
 
 func (r *ColorsRepo) AddToItems(colorId int) error {
-	query := fmt.Sprintf("INSERT INTO %s (item_id,color_id) SELECT id, %d from %s;", itemsColorsTable, colorId, itemsTable)
+	query := fmt.Sprintf("INSERT INTO %s (item_id,color_id) SELECT id, %d from %s ON CONFLICT (item_id,color_id) DO NOTHING;", itemsColorsTable, colorId, itemsTable)
 	_, err := r.db.Exec(query)
 
 	return err
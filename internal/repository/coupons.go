@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"shop_backend/internal/models"
+)
+
+type CouponsRepo struct {
+	db *sqlx.DB
+}
+
+func NewCouponsRepo(db *sqlx.DB) *CouponsRepo {
+	return &CouponsRepo{db: db}
+}
+
+const couponColumns = "id, code, kind, value, min_total, starts_at, expires_at, usage_limit, per_user_limit, used, created_at"
+
+// Create saves coupon with its category and tag restrictions
+func (r *CouponsRepo) Create(ctx context.Context, coupon models.Coupon) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := fmt.Sprintf(`INSERT INTO %s (code,kind,value,min_total,starts_at,expires_at,usage_limit,per_user_limit)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id;`, couponsTable)
+	if err := tx.QueryRowContext(ctx, query, coupon.Code, coupon.Kind, coupon.Value, coupon.MinTotal,
+		coupon.StartsAt, coupon.ExpiresAt, coupon.UsageLimit, coupon.PerUserLimit).Scan(&id); err != nil {
+		return 0, uniqueViolation(err, "code")
+	}
+
+	if err := r.saveRestrictions(ctx, tx, id, coupon); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// Update replaces coupon terms and restrictions, usage counter is kept
+func (r *CouponsRepo) Update(ctx context.Context, coupon models.Coupon) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`UPDATE %s SET code=$1, kind=$2, value=$3, min_total=$4, starts_at=$5, expires_at=$6,
+		usage_limit=$7, per_user_limit=$8 WHERE id=$9;`, couponsTable)
+	res, err := tx.ExecContext(ctx, query, coupon.Code, coupon.Kind, coupon.Value, coupon.MinTotal,
+		coupon.StartsAt, coupon.ExpiresAt, coupon.UsageLimit, coupon.PerUserLimit, coupon.Id)
+	if err != nil {
+		return uniqueViolation(err, "code")
+	}
+	if err := checkAffected(res, models.ErrCouponNotFound); err != nil {
+		return err
+	}
+
+	for _, table := range []string{couponsCategoriesTable, couponsTagsTable} {
+		deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE coupon_id=$1;", table)
+		if _, err := tx.ExecContext(ctx, deleteQuery, coupon.Id); err != nil {
+			return err
+		}
+	}
+
+	if err := r.saveRestrictions(ctx, tx, coupon.Id, coupon); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *CouponsRepo) saveRestrictions(ctx context.Context, tx *sqlx.Tx, couponId int, coupon models.Coupon) error {
+	categoryQuery := fmt.Sprintf("INSERT INTO %s (coupon_id,category_id) SELECT $1, unnest($2::int[]) ON CONFLICT DO NOTHING;", couponsCategoriesTable)
+	if _, err := tx.ExecContext(ctx, categoryQuery, couponId, pq.Array(coupon.Categories)); err != nil {
+		return err
+	}
+
+	tagQuery := fmt.Sprintf("INSERT INTO %s (coupon_id,tag) SELECT $1, unnest($2::varchar[]) ON CONFLICT DO NOTHING;", couponsTagsTable)
+	_, err := tx.ExecContext(ctx, tagQuery, couponId, pq.Array(coupon.Tags))
+
+	return err
+}
+
+// $1 = couponId
+func (r *CouponsRepo) Delete(ctx context.Context, couponId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id=$1;", couponsTable)
+	res, err := r.db.ExecContext(ctx, query, couponId)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrCouponNotFound)
+}
+
+// $1 = couponId
+func (r *CouponsRepo) GetById(ctx context.Context, couponId int) (models.Coupon, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id=$1;", couponColumns, couponsTable)
+	return r.get(ctx, query, couponId)
+}
+
+// $1 = code
+func (r *CouponsRepo) GetByCode(ctx context.Context, code string) (models.Coupon, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE code=$1;", couponColumns, couponsTable)
+	return r.get(ctx, query, code)
+}
+
+func (r *CouponsRepo) get(ctx context.Context, query string, arg interface{}) (models.Coupon, error) {
+	var coupon models.Coupon
+	if err := r.db.GetContext(ctx, &coupon, query, arg); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Coupon{}, models.ErrCouponNotFound
+		}
+		return models.Coupon{}, err
+	}
+
+	if err := r.getRestrictions(ctx, &coupon); err != nil {
+		return models.Coupon{}, err
+	}
+
+	return coupon, nil
+}
+
+func (r *CouponsRepo) GetAll(ctx context.Context) ([]models.Coupon, error) {
+	coupons := make([]models.Coupon, 0)
+	query := fmt.Sprintf("SELECT %s FROM %s ORDER BY created_at DESC;", couponColumns, couponsTable)
+	if err := r.db.SelectContext(ctx, &coupons, query); err != nil {
+		return nil, err
+	}
+
+	for i := range coupons {
+		if err := r.getRestrictions(ctx, &coupons[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return coupons, nil
+}
+
+// $1 = couponId
+func (r *CouponsRepo) getRestrictions(ctx context.Context, coupon *models.Coupon) error {
+	coupon.Categories = make([]int, 0)
+	categoryQuery := fmt.Sprintf("SELECT category_id FROM %s WHERE coupon_id=$1 ORDER BY category_id;", couponsCategoriesTable)
+	if err := r.db.SelectContext(ctx, &coupon.Categories, categoryQuery, coupon.Id); err != nil {
+		return err
+	}
+
+	// Coupon applies to the whole subtree of its categories
+	coupon.CategoriesSubtree = make([]int, 0)
+	if len(coupon.Categories) > 0 {
+		subtreeQuery := categorySubtree("ANY($1)") + ";"
+		if err := r.db.SelectContext(ctx, &coupon.CategoriesSubtree, subtreeQuery, pq.Array(coupon.Categories)); err != nil {
+			return err
+		}
+	}
+
+	coupon.Tags = make([]string, 0)
+	tagQuery := fmt.Sprintf("SELECT tag FROM %s WHERE coupon_id=$1 ORDER BY tag;", couponsTagsTable)
+
+	return r.db.SelectContext(ctx, &coupon.Tags, tagQuery, coupon.Id)
+}
+
+// $1 = couponId
+// $2 = userId
+func (r *CouponsRepo) CountRedemptions(ctx context.Context, couponId, userId int) (int, error) {
+	var count int
+	query := fmt.Sprintf("SELECT count(*) FROM %s WHERE coupon_id=$1 AND user_id=$2;", couponsRedemptionsTable)
+	if err := r.db.QueryRowContext(ctx, query, couponId, userId).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// redeemCoupon records coupon usage by order inside of order transaction.
+// Coupon row is locked, so concurrent orders cannot exceed usage limits
+func redeemCoupon(ctx context.Context, tx *sqlx.Tx, couponId int, userId *int, orderId int, discount float64) error {
+	var (
+		usageLimit   sql.NullInt64
+		perUserLimit sql.NullInt64
+		used         int64
+	)
+	lockQuery := fmt.Sprintf(`SELECT usage_limit, per_user_limit, used FROM %s WHERE id=$1
+		AND (starts_at IS NULL OR starts_at <= now()) AND (expires_at IS NULL OR expires_at > now()) FOR UPDATE;`, couponsTable)
+	if err := tx.QueryRowContext(ctx, lockQuery, couponId).Scan(&usageLimit, &perUserLimit, &used); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrCouponInactive
+		}
+		return err
+	}
+
+	if usageLimit.Valid && used >= usageLimit.Int64 {
+		return models.ErrCouponExhausted
+	}
+
+	if perUserLimit.Valid && userId != nil {
+		var count int64
+		countQuery := fmt.Sprintf("SELECT count(*) FROM %s WHERE coupon_id=$1 AND user_id=$2;", couponsRedemptionsTable)
+		if err := tx.QueryRowContext(ctx, countQuery, couponId, *userId).Scan(&count); err != nil {
+			return err
+		}
+		if count >= perUserLimit.Int64 {
+			return models.ErrCouponExhausted
+		}
+	}
+
+	redemptionQuery := fmt.Sprintf("INSERT INTO %s (coupon_id,user_id,order_id,discount) VALUES ($1,$2,$3,$4);", couponsRedemptionsTable)
+	if _, err := tx.ExecContext(ctx, redemptionQuery, couponId, userId, orderId, discount); err != nil {
+		return err
+	}
+
+	usedQuery := fmt.Sprintf("UPDATE %s SET used=used+1 WHERE id=$1;", couponsTable)
+	_, err := tx.ExecContext(ctx, usedQuery, couponId)
+
+	return err
+}
+
+// releaseCoupon gives coupon usage of cancelled order back
+func releaseCoupon(ctx context.Context, tx *sqlx.Tx, orderId int) error {
+	query := fmt.Sprintf(`WITH R AS (DELETE FROM %s WHERE order_id=$1 RETURNING coupon_id)
+		UPDATE %s AS C SET used=C.used-1 FROM R WHERE C.id=R.coupon_id;`, couponsRedemptionsTable, couponsTable)
+	_, err := tx.ExecContext(ctx, query, orderId)
+
+	return err
+}
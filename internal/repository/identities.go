@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"shop_backend/internal/models"
+)
+
+type IdentitiesRepo struct {
+	db *sqlx.DB
+}
+
+func NewIdentitiesRepo(db *sqlx.DB) *IdentitiesRepo {
+	return &IdentitiesRepo{db: db}
+}
+
+// Get returns identity by provider and subject
+func (r *IdentitiesRepo) Get(ctx context.Context, provider, subject string) (models.UserIdentity, error) {
+	var identity models.UserIdentity
+	query := fmt.Sprintf("SELECT id, user_id, provider, subject, email, created_at FROM %s WHERE provider=$1 AND subject=$2;", usersIdentitiesTable)
+	err := r.db.GetContext(ctx, &identity, query, provider, subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.UserIdentity{}, models.ErrIdentityNotFound
+	}
+
+	return identity, err
+}
+
+func (r *IdentitiesRepo) Create(ctx context.Context, identity models.UserIdentity) error {
+	query := fmt.Sprintf("INSERT INTO %s (user_id,provider,subject,email) VALUES ($1,$2,$3,$4);", usersIdentitiesTable)
+	_, err := r.db.ExecContext(ctx, query, identity.UserId, identity.Provider, identity.Subject, identity.Email)
+
+	return uniqueViolation(err, "identity")
+}
+
+// CreateState stores pending sign in and removes expired ones
+func (r *IdentitiesRepo) CreateState(ctx context.Context, state models.OAuthState) error {
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE expires_at <= now();", oauthStatesTable)
+	if _, err := r.db.ExecContext(ctx, deleteQuery); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (state_hash,provider,code_verifier,nonce,expires_at) VALUES ($1,$2,$3,$4,$5);", oauthStatesTable)
+	_, err := r.db.ExecContext(ctx, query, state.StateHash, state.Provider, state.CodeVerifier, state.Nonce, state.ExpiresAt)
+
+	return err
+}
+
+// ConsumeState removes not expired pending sign in of provider and returns it,
+// so each state is accepted once
+func (r *IdentitiesRepo) ConsumeState(ctx context.Context, provider, stateHash string) (models.OAuthState, error) {
+	var state models.OAuthState
+	query := fmt.Sprintf(`DELETE FROM %s WHERE state_hash=$1 AND provider=$2 AND expires_at > now()
+		RETURNING state_hash, provider, code_verifier, nonce, expires_at;`, oauthStatesTable)
+	err := r.db.GetContext(ctx, &state, query, stateHash, provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.OAuthState{}, models.ErrInvalidToken
+	}
+
+	return state, err
+}
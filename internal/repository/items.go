@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"shop_backend/internal/models"
 )
 
@@ -15,6 +16,8 @@ func NewItemsRepo(db *sqlx.DB) *ItemsRepo {
 	return &ItemsRepo{db: db}
 }
 
+const itemColumns = "id, name, description, category_id, price, sku, created_at"
+
 func (r *ItemsRepo) Create(item models.Item) (int, error) {
 	var id int
 	query := fmt.Sprintf("INSERT INTO %s (name,description,category_id,sku,price) VALUES ($1,$2,$3,$4,$5) RETURNING id;", itemsTable)
@@ -27,7 +30,7 @@ func (r *ItemsRepo) Create(item models.Item) (int, error) {
 }
 
 func (r *ItemsRepo) LinkColor(itemId int, colorId int) error {
-	query := fmt.Sprintf("INSERT INTO %s (item_id,color_id) VALUES ($1,$2);", itemsColorsTable)
+	query := fmt.Sprintf("INSERT INTO %s (item_id,color_id) VALUES ($1,$2) ON CONFLICT (item_id,color_id) DO NOTHING;", itemsColorsTable)
 	_, err := r.db.Exec(query, itemId, colorId)
 
 	return err
@@ -56,19 +59,33 @@ func (r *ItemsRepo) GetNew(limit int) ([]int, error) {
 
 	return ids, nil
 }
-func (r *ItemsRepo) GetById(itemId int) (models.Item, error) {
-	var item models.Item
-	query := fmt.Sprintf("SELECT * FROM %s WHERE id=$1;", itemsTable)
-	if err := r.db.QueryRow(query, itemId).Scan(&item.Id, &item.Name, &item.Description, &item.Category.Id, &item.Price, &item.Sku, &item.CreatedAt); err != nil {
-		return models.Item{}, err
+
+// GetByIds returns items with category names in no particular order, missing ids are skipped
+func (r *ItemsRepo) GetByIds(itemsId []int) ([]models.Item, error) {
+	query := fmt.Sprintf(`SELECT I.id, I.name, I.description, I.category_id, C.name, I.price, I.sku, I.created_at
+		FROM %s AS I JOIN %s AS C ON C.id=I.category_id WHERE I.id=ANY($1);`, itemsTable, categoriesTable)
+	rows, err := r.db.Query(query, pq.Array(itemsId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]models.Item, 0, len(itemsId))
+	for rows.Next() {
+		var item models.Item
+		if err := rows.Scan(&item.Id, &item.Name, &item.Description, &item.Category.Id, &item.Category.Name,
+			&item.Price, &item.Sku, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
 	}
 
-	return item, nil
+	return items, rows.Err()
 }
 
 func (r *ItemsRepo) GetBySku(sku string) (models.Item, error) {
 	var item models.Item
-	query := fmt.Sprintf("SELECT * FROM %s where sku=$1;", itemsTable)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE sku=$1;", itemColumns, itemsTable)
 	if err := r.db.QueryRow(query, sku).Scan(&item.Id, &item.Name, &item.Description, &item.Category.Id, &item.Price, &item.Sku, &item.CreatedAt); err != nil {
 		return models.Item{}, err
 	}
@@ -76,9 +93,13 @@ func (r *ItemsRepo) GetBySku(sku string) (models.Item, error) {
 	return item, nil
 }
 
-func (r *ItemsRepo) GetByCategory(categoryId int) ([]int, error) {
+// GetByCategory returns ids of category items, with descendants items of the whole subtree are included
+func (r *ItemsRepo) GetByCategory(categoryId int, descendants bool) ([]int, error) {
 	var ids []int
 	query := fmt.Sprintf("SELECT I.id FROM %s AS I WHERE category_id=$1;", itemsTable)
+	if descendants {
+		query = fmt.Sprintf("SELECT I.id FROM %s AS I WHERE category_id IN (%s);", itemsTable, categorySubtree("$1"))
+	}
 	if err := r.db.Select(&ids, query, categoryId); err != nil {
 		return nil, err
 	}
@@ -96,34 +117,70 @@ func (r *ItemsRepo) GetByTag(tag string) ([]int, error) {
 	return ids, nil
 }
 
-func (r *ItemsRepo) GetColors(itemId int) ([]models.Color, error) {
-	var colors []models.Color
-	query := fmt.Sprintf("SELECT colors.id, colors.name, colors.hex, colors.price FROM %s, %s WHERE colors.id = %s.color_id AND %s.item_id = $1;", colorsTable, itemsColorsTable, itemsColorsTable, itemsColorsTable)
-	if err := r.db.Select(&colors, query, itemId); err != nil {
-		return []models.Color{}, err
+// GetColorsByItems returns colors with stock of items grouped by item id
+func (r *ItemsRepo) GetColorsByItems(itemsId []int) (map[int][]models.Color, error) {
+	query := fmt.Sprintf(`SELECT IC.item_id, C.id, C.name, C.hex, C.price, IC.stock FROM %s AS IC, %s AS C
+		WHERE IC.item_id=ANY($1) AND C.id=IC.color_id ORDER BY IC.id;`, itemsColorsTable, colorsTable)
+	rows, err := r.db.Query(query, pq.Array(itemsId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	colors := make(map[int][]models.Color)
+	for rows.Next() {
+		var (
+			itemId int
+			color  models.Color
+		)
+		if err := rows.Scan(&itemId, &color.Id, &color.Name, &color.Hex, &color.Price, &color.Stock); err != nil {
+			return nil, err
+		}
+		colors[itemId] = append(colors[itemId], color)
 	}
 
-	return colors, nil
+	return colors, rows.Err()
 }
 
-func (r *ItemsRepo) GetTags(itemId int) ([]models.Tag, error) {
+// GetTagsByItems returns tags of items grouped by item id
+func (r *ItemsRepo) GetTagsByItems(itemsId []int) (map[int][]models.Tag, error) {
 	var tags []models.Tag
-	query := fmt.Sprintf("SELECT * FROM %s WHERE tags.item_id = $1;", tagsTable)
-	if err := r.db.Select(&tags, query, itemId); err != nil && err != sql.ErrNoRows {
+	query := fmt.Sprintf("SELECT id, item_id, name FROM %s WHERE item_id=ANY($1) ORDER BY id;", tagsTable)
+	if err := r.db.Select(&tags, query, pq.Array(itemsId)); err != nil {
 		return nil, err
 	}
 
-	return tags, nil
+	grouped := make(map[int][]models.Tag)
+	for _, tag := range tags {
+		grouped[tag.ItemId] = append(grouped[tag.ItemId], tag)
+	}
+
+	return grouped, nil
 }
 
-func (r *ItemsRepo) GetImages(itemId int) ([]models.Image, error) {
-	var images []models.Image
-	query := fmt.Sprintf("SELECT images.id, images.filename, images.created_at FROM %s, %s WHERE images.id = %s.image_id AND %s.item_id = $1;", imagesTable, itemsImagesTable, itemsImagesTable, itemsImagesTable)
-	if err := r.db.Select(&images, query, itemId); err != nil && err != sql.ErrNoRows {
+// GetImagesByItems returns images of items grouped by item id
+func (r *ItemsRepo) GetImagesByItems(itemsId []int) (map[int][]models.Image, error) {
+	query := fmt.Sprintf(`SELECT II.item_id, I.id, I.filename, I.created_at FROM %s AS II, %s AS I
+		WHERE II.item_id=ANY($1) AND I.id=II.image_id ORDER BY II.id;`, itemsImagesTable, imagesTable)
+	rows, err := r.db.Query(query, pq.Array(itemsId))
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	images := make(map[int][]models.Image)
+	for rows.Next() {
+		var (
+			itemId int
+			image  models.Image
+		)
+		if err := rows.Scan(&itemId, &image.Id, &image.Filename, &image.CreatedAt); err != nil {
+			return nil, err
+		}
+		images[itemId] = append(images[itemId], image)
+	}
 
-	return images, nil
+	return images, rows.Err()
 }
 
 func (r *ItemsRepo) Update(itemId int, name, description string, categoryId int, price float64, sku string) error {
@@ -161,6 +218,48 @@ func (r *ItemsRepo) DeleteColors(itemId int) error {
 	return err
 }
 
+// DeleteColorsExcept unlinks all item colors except provided ones keeping their stock
+func (r *ItemsRepo) DeleteColorsExcept(itemId int, colorsId []int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE item_id=$1 AND NOT (color_id = ANY($2));", itemsColorsTable)
+	_, err := r.db.Exec(query, itemId, pq.Array(colorsId))
+
+	return err
+}
+
+// AdjustStock changes stock of item color by movement delta and records movement
+func (r *ItemsRepo) AdjustStock(movement models.StockMovement) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("UPDATE %s SET stock=stock+$1 WHERE item_id=$2 AND color_id=$3 AND stock+$1 >= 0;", itemsColorsTable)
+	res, err := tx.Exec(query, movement.Delta, movement.ItemId, movement.ColorId)
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(res, models.ErrNegativeStock); err != nil {
+		return err
+	}
+
+	if err := insertStockMovement(tx, movement); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *ItemsRepo) GetStockMovements(itemId int) ([]models.StockMovement, error) {
+	movements := make([]models.StockMovement, 0)
+	query := fmt.Sprintf("SELECT * FROM %s WHERE item_id=$1 ORDER BY created_at DESC;", stockMovementsTable)
+	if err := r.db.Select(&movements, query, itemId); err != nil {
+		return nil, err
+	}
+
+	return movements, nil
+}
+
 func (r *ItemsRepo) Exist(itemId int) (bool, error) {
 	var exist bool
 	queryMain := fmt.Sprintf("SELECT * FROM %s WHERE id=$1", itemsTable)
@@ -170,3 +269,25 @@ func (r *ItemsRepo) Exist(itemId int) (bool, error) {
 	}
 	return exist, nil
 }
+
+func (r *ItemsRepo) HasVariant(itemId, variantId int) (bool, error) {
+	var exist bool
+	queryMain := fmt.Sprintf("SELECT * FROM %s WHERE item_id=$1 AND id=$2", itemsVariantsTable)
+	query := fmt.Sprintf("SELECT exists (%s)", queryMain)
+	if err := r.db.QueryRow(query, itemId, variantId).Scan(&exist); err != nil {
+		return false, err
+	}
+
+	return exist, nil
+}
+
+func (r *ItemsRepo) HasColor(itemId, colorId int) (bool, error) {
+	var exist bool
+	queryMain := fmt.Sprintf("SELECT * FROM %s WHERE item_id=$1 AND color_id=$2", itemsColorsTable)
+	query := fmt.Sprintf("SELECT exists (%s)", queryMain)
+	if err := r.db.QueryRow(query, itemId, colorId).Scan(&exist); err != nil {
+		return false, err
+	}
+
+	return exist, nil
+}
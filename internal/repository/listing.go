@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/lib/pq"
+	"shop_backend/internal/models"
+	"strings"
+	"time"
+)
+
+// itemsConditions builds WHERE clause of item listing with positional arguments
+type itemsConditions struct {
+	conds []string
+	args  []interface{}
+}
+
+func (c *itemsConditions) arg(value interface{}) string {
+	c.args = append(c.args, value)
+	return fmt.Sprintf("$%d", len(c.args))
+}
+
+func (c *itemsConditions) add(cond string) {
+	c.conds = append(c.conds, cond)
+}
+
+func (c *itemsConditions) where() string {
+	if len(c.conds) == 0 {
+		return ""
+	}
+
+	return "WHERE " + strings.Join(c.conds, " AND ")
+}
+
+type facetKind int
+
+const (
+	noFacet facetKind = iota
+	colorsFacet
+	tagsFacet
+	pricesFacet
+)
+
+// filterConditions translates filter into conditions on items aliased as I.
+// Filter of skipped facet is left out so the facet shows all its values
+func filterConditions(filter models.ItemsFilter, skip facetKind) *itemsConditions {
+	c := &itemsConditions{}
+
+	if filter.CategoryId != nil {
+		if filter.Descendants {
+			c.add(fmt.Sprintf("I.category_id IN (%s)", categorySubtree(c.arg(*filter.CategoryId))))
+		} else {
+			c.add("I.category_id=" + c.arg(*filter.CategoryId))
+		}
+	}
+
+	if len(filter.Tags) > 0 && skip != tagsFacet {
+		c.add(fmt.Sprintf("EXISTS (SELECT 1 FROM %s AS T WHERE T.item_id=I.id AND T.name=ANY(%s))",
+			tagsTable, c.arg(pq.Array(filter.Tags))))
+	}
+
+	if len(filter.ColorsId) > 0 && skip != colorsFacet {
+		stockCond := ""
+		if filter.InStock {
+			stockCond = " AND IC.stock > 0"
+		}
+		c.add(fmt.Sprintf("EXISTS (SELECT 1 FROM %s AS IC WHERE IC.item_id=I.id AND IC.color_id=ANY(%s)%s)",
+			itemsColorsTable, c.arg(pq.Array(filter.ColorsId)), stockCond))
+	}
+
+	if skip != pricesFacet {
+		if filter.MinPrice != nil {
+			c.add("I.price >= " + c.arg(*filter.MinPrice))
+		}
+		if filter.MaxPrice != nil {
+			c.add("I.price <= " + c.arg(*filter.MaxPrice))
+		}
+	}
+
+	if filter.InStock {
+		c.add(fmt.Sprintf(`(EXISTS (SELECT 1 FROM %s AS IC WHERE IC.item_id=I.id AND IC.stock > 0)
+			OR EXISTS (SELECT 1 FROM %s AS V WHERE V.item_id=I.id AND V.stock > 0))`, itemsColorsTable, itemsVariantsTable))
+	}
+
+	return c
+}
+
+// List returns ids of one listing page and cursor of the next page, which is nil on the last page
+func (r *ItemsRepo) List(query models.ItemsQuery) ([]int, *models.ItemsCursor, error) {
+	c := filterConditions(query.Filter, noFacet)
+
+	var order string
+	switch query.Sort {
+	case models.ItemsSortPriceAsc:
+		order = "I.price ASC, I.id ASC"
+		if query.Cursor != nil {
+			c.add(fmt.Sprintf("(I.price, I.id) > (%s::numeric, %s)", c.arg(query.Cursor.Value), c.arg(query.Cursor.Id)))
+		}
+	case models.ItemsSortPriceDesc:
+		order = "I.price DESC, I.id DESC"
+		if query.Cursor != nil {
+			c.add(fmt.Sprintf("(I.price, I.id) < (%s::numeric, %s)", c.arg(query.Cursor.Value), c.arg(query.Cursor.Id)))
+		}
+	case models.ItemsSortName:
+		order = "I.name ASC, I.id ASC"
+		if query.Cursor != nil {
+			c.add(fmt.Sprintf("(I.name, I.id) > (%s, %s)", c.arg(query.Cursor.Value), c.arg(query.Cursor.Id)))
+		}
+	default:
+		order = "I.created_at DESC, I.id DESC"
+		if query.Cursor != nil {
+			c.add(fmt.Sprintf("(I.created_at, I.id) < (%s::timestamp, %s)", c.arg(query.Cursor.Value), c.arg(query.Cursor.Id)))
+		}
+	}
+
+	// One more row is fetched to know if there is next page
+	sqlQuery := fmt.Sprintf("SELECT I.id, I.name, I.price::text, I.created_at FROM %s AS I %s ORDER BY %s LIMIT %s;",
+		itemsTable, c.where(), order, c.arg(query.Limit+1))
+	rows, err := r.db.Query(sqlQuery, c.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		ids  []int
+		next *models.ItemsCursor
+		more bool
+	)
+	for rows.Next() {
+		var (
+			id        int
+			name      string
+			price     string
+			createdAt time.Time
+		)
+		if err := rows.Scan(&id, &name, &price, &createdAt); err != nil {
+			return nil, nil, err
+		}
+
+		if len(ids) == query.Limit {
+			more = true
+			break
+		}
+		ids = append(ids, id)
+
+		next = &models.ItemsCursor{Sort: query.Sort, Id: id}
+		switch query.Sort {
+		case models.ItemsSortPriceAsc, models.ItemsSortPriceDesc:
+			next.Value = price
+		case models.ItemsSortName:
+			next.Value = name
+		default:
+			next.Value = createdAt.Format(time.RFC3339Nano)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if !more {
+		next = nil
+	}
+
+	return ids, next, nil
+}
+
+// Facets counts items matching filter per color, tag and price bucket
+func (r *ItemsRepo) Facets(filter models.ItemsFilter) (models.Facets, error) {
+	facets := models.Facets{
+		Colors: make([]models.ColorFacet, 0),
+		Tags:   make([]models.TagFacet, 0),
+		Prices: make([]models.PriceFacet, 0),
+	}
+
+	c := filterConditions(filter, colorsFacet)
+	colorsQuery := fmt.Sprintf(`SELECT C.id, C.name, C.hex, count(DISTINCT I.id) AS count
+		FROM %s AS I JOIN %s AS IC ON IC.item_id=I.id JOIN %s AS C ON C.id=IC.color_id
+		%s GROUP BY C.id ORDER BY C.name;`, itemsTable, itemsColorsTable, colorsTable, c.where())
+	if err := r.db.Select(&facets.Colors, colorsQuery, c.args...); err != nil {
+		return models.Facets{}, err
+	}
+
+	c = filterConditions(filter, tagsFacet)
+	tagsQuery := fmt.Sprintf(`SELECT T.name, count(DISTINCT I.id) AS count
+		FROM %s AS I JOIN %s AS T ON T.item_id=I.id
+		%s GROUP BY T.name ORDER BY count DESC, T.name;`, itemsTable, tagsTable, c.where())
+	if err := r.db.Select(&facets.Tags, tagsQuery, c.args...); err != nil {
+		return models.Facets{}, err
+	}
+
+	// width_bucket returns 0 for prices below the first bound and
+	// len(bounds) for prices above the last one
+	c = filterConditions(filter, pricesFacet)
+	bounds := c.arg(pq.Array(models.PriceBuckets))
+	pricesQuery := fmt.Sprintf(`SELECT width_bucket(I.price, %s::numeric[]) AS bucket, count(*)
+		FROM %s AS I %s GROUP BY bucket ORDER BY bucket;`, bounds, itemsTable, c.where())
+	rows, err := r.db.Query(pricesQuery, c.args...)
+	if err != nil {
+		return models.Facets{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket, count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return models.Facets{}, err
+		}
+
+		facet := models.PriceFacet{Count: count}
+		if bucket > 0 {
+			facet.From = models.PriceBuckets[bucket-1]
+		}
+		if bucket < len(models.PriceBuckets) {
+			to := models.PriceBuckets[bucket]
+			facet.To = &to
+		}
+		facets.Prices = append(facets.Prices, facet)
+	}
+
+	return facets, rows.Err()
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"shop_backend/internal/models"
+	"time"
+)
+
+// loginAttemptsRetention is how long sign in attempts are kept for review
+const loginAttemptsRetention = "90 days"
+
+type LoginAttemptsRepo struct {
+	db *sqlx.DB
+}
+
+func NewLoginAttemptsRepo(db *sqlx.DB) *LoginAttemptsRepo {
+	return &LoginAttemptsRepo{db: db}
+}
+
+// Create records sign in attempt and removes attempts older than retention period
+func (r *LoginAttemptsRepo) Create(ctx context.Context, attempt models.LoginAttempt) error {
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE created_at < now() - interval '%s';", loginAttemptsTable, loginAttemptsRetention)
+	if _, err := r.db.ExecContext(ctx, deleteQuery); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (user_id,login,ip,user_agent,success) VALUES ($1,$2,$3,$4,$5);", loginAttemptsTable)
+	_, err := r.db.ExecContext(ctx, query, attempt.UserId, attempt.Login, attempt.Ip, attempt.UserAgent, attempt.Success)
+
+	return err
+}
+
+// GetAll returns attempts matching filter, the latest first
+func (r *LoginAttemptsRepo) GetAll(ctx context.Context, filter models.LoginAttemptsFilter) ([]models.LoginAttempt, error) {
+	var c itemsConditions
+	if filter.UserId != nil {
+		c.add("user_id=" + c.arg(*filter.UserId))
+	}
+	if filter.Ip != "" {
+		c.add("ip=" + c.arg(filter.Ip))
+	}
+	if filter.Success != nil {
+		c.add("success=" + c.arg(*filter.Success))
+	}
+
+	attempts := make([]models.LoginAttempt, 0)
+	query := fmt.Sprintf("SELECT id, user_id, login, ip, user_agent, success, created_at FROM %s %s ORDER BY created_at DESC, id DESC LIMIT %s OFFSET %s;",
+		loginAttemptsTable, c.where(), c.arg(filter.Limit), c.arg(filter.Offset))
+	if err := r.db.SelectContext(ctx, &attempts, query, c.args...); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// RegisterFailure counts failed sign in of user. Once maxFailures consecutive
+// failures are reached the account is locked for lockFor and counter starts
+// over. Reports whether this failure locked the account
+func (r *LoginAttemptsRepo) RegisterFailure(ctx context.Context, userId, maxFailures int, lockFor time.Duration) (bool, error) {
+	var locked bool
+	query := fmt.Sprintf(`UPDATE %s SET
+			failed_logins = CASE WHEN failed_logins+1 >= $2 THEN 0 ELSE failed_logins+1 END,
+			locked_until = CASE WHEN failed_logins+1 >= $2 THEN now() + make_interval(secs => $3) ELSE locked_until END
+		WHERE id=$1 RETURNING failed_logins=0;`, usersTable)
+	if err := r.db.QueryRowContext(ctx, query, userId, maxFailures, lockFor.Seconds()).Scan(&locked); err != nil {
+		return false, err
+	}
+
+	return locked, nil
+}
+
+// IsLocked reports whether account of user is locked now
+func (r *LoginAttemptsRepo) IsLocked(ctx context.Context, userId int) (bool, error) {
+	var locked bool
+	query := fmt.Sprintf("SELECT coalesce(locked_until > now(), false) FROM %s WHERE id=$1;", usersTable)
+	if err := r.db.QueryRowContext(ctx, query, userId).Scan(&locked); err != nil {
+		return false, err
+	}
+
+	return locked, nil
+}
+
+// Unlock lifts lockout of user and resets counter of failed sign ins
+func (r *LoginAttemptsRepo) Unlock(ctx context.Context, userId int) error {
+	query := fmt.Sprintf("UPDATE %s SET failed_logins=0, locked_until=NULL WHERE id=$1;", usersTable)
+	res, err := r.db.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrUserNotFound)
+}
+
+// GetLockouts returns currently locked accounts
+func (r *LoginAttemptsRepo) GetLockouts(ctx context.Context) ([]models.Lockout, error) {
+	lockouts := make([]models.Lockout, 0)
+	query := fmt.Sprintf("SELECT id, login, email, locked_until FROM %s WHERE locked_until > now() ORDER BY locked_until DESC;", usersTable)
+	if err := r.db.SelectContext(ctx, &lockouts, query); err != nil {
+		return nil, err
+	}
+
+	return lockouts, nil
+}
+
+func (r *LoginAttemptsRepo) GetLockout(ctx context.Context, userId int) (models.LockoutState, error) {
+	var state models.LockoutState
+	query := fmt.Sprintf("SELECT id, failed_logins, locked_until FROM %s WHERE id=$1;", usersTable)
+	err := r.db.GetContext(ctx, &state, query, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.LockoutState{}, models.ErrUserNotFound
+	}
+
+	return state, err
+}
@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"shop_backend/internal/models"
+)
+
+type OrdersRepo struct {
+	db *sqlx.DB
+}
+
+func NewOrdersRepo(db *sqlx.DB) *OrdersRepo {
+	return &OrdersRepo{db: db}
+}
+
+const orderColumns = `id, user_id, status, total, discount, shipping, coupon_code,
+	invoice_country, invoice_city, invoice_street, invoice_zip,
+	shipping_country, shipping_city, shipping_street, shipping_zip,
+	created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOrder(row rowScanner) (models.Order, error) {
+	var order models.Order
+	err := row.Scan(&order.Id, &order.UserId, &order.Status, &order.Total, &order.Discount, &order.Shipping, &order.CouponCode,
+		&order.InvoiceAddress.Country, &order.InvoiceAddress.City, &order.InvoiceAddress.Street, &order.InvoiceAddress.Zip,
+		&order.ShippingAddress.Country, &order.ShippingAddress.City, &order.ShippingAddress.Street, &order.ShippingAddress.Zip,
+		&order.CreatedAt, &order.UpdatedAt)
+
+	return order, err
+}
+
+// Create saves order with its items, reserves stock, redeems coupon and clears
+// cart it was made from in one transaction. Cart is locked until commit, so
+// concurrent order from the same cart waits and then finds it changed
+func (r *OrdersRepo) Create(ctx context.Context, cartId int, order models.Order) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCart(ctx, tx, cartId, order); err != nil {
+		return 0, err
+	}
+
+	var id int
+	orderQuery := fmt.Sprintf(`INSERT INTO %s (user_id,status,total,discount,shipping,coupon_code,
+		invoice_country,invoice_city,invoice_street,invoice_zip,
+		shipping_country,shipping_city,shipping_street,shipping_zip)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14) RETURNING id;`, ordersTable)
+	if err := tx.QueryRowContext(ctx, orderQuery, order.UserId, order.Status, order.Total, order.Discount, order.Shipping, order.CouponCode,
+		order.InvoiceAddress.Country, order.InvoiceAddress.City, order.InvoiceAddress.Street, order.InvoiceAddress.Zip,
+		order.ShippingAddress.Country, order.ShippingAddress.City, order.ShippingAddress.Street, order.ShippingAddress.Zip).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	if order.CouponId != nil {
+		if err := redeemCoupon(ctx, tx, *order.CouponId, order.UserId, id, order.Discount); err != nil {
+			return 0, err
+		}
+	}
+
+	itemQuery := fmt.Sprintf(`INSERT INTO %s (order_id,item_id,name,variant_id,sku,price,color_id,color_name,color_hex,color_price,quantity,total,discount)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13);`, ordersItemsTable)
+	// Variant has stock of its own, color stock is reserved for lines without variant
+	reserveQuery := fmt.Sprintf("UPDATE %s SET stock=stock-$1 WHERE item_id=$2 AND color_id=$3 AND stock >= $1;", itemsColorsTable)
+	reserveVariantQuery := fmt.Sprintf("UPDATE %s SET stock=stock-$1 WHERE item_id=$2 AND id=$3 AND stock >= $1;", itemsVariantsTable)
+	for _, item := range order.Items {
+		if _, err := tx.ExecContext(ctx, itemQuery, id, item.ItemId, item.Name, item.VariantId, item.Sku, item.Price,
+			item.Color.Id, item.Color.Name, item.Color.Hex, item.Color.Price, item.Quantity, item.Total, item.Discount); err != nil {
+			return 0, err
+		}
+
+		var res sql.Result
+		if item.VariantId != nil {
+			res, err = tx.ExecContext(ctx, reserveVariantQuery, item.Quantity, item.ItemId, *item.VariantId)
+		} else {
+			res, err = tx.ExecContext(ctx, reserveQuery, item.Quantity, item.ItemId, item.Color.Id)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := checkAffected(res, models.ErrOutOfStock); err != nil {
+			return 0, fmt.Errorf("%s (%s): %w", item.Name, item.Color.Name, err)
+		}
+
+		orderId := id
+		if err := insertStockMovement(tx, models.StockMovement{
+			ItemId:    *item.ItemId,
+			ColorId:   item.Color.Id,
+			VariantId: item.VariantId,
+			Delta:     -item.Quantity,
+			Reason:    "order reservation",
+			OrderId:   &orderId,
+			UserId:    order.UserId,
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	historyQuery := fmt.Sprintf("INSERT INTO %s (order_id,status) VALUES ($1,$2);", ordersHistoryTable)
+	if _, err := tx.ExecContext(ctx, historyQuery, id, order.Status); err != nil {
+		return 0, err
+	}
+
+	clearQuery := fmt.Sprintf("DELETE FROM %s WHERE cart_id=$1;", cartsItemsTable)
+	if _, err := tx.ExecContext(ctx, clearQuery, cartId); err != nil {
+		return 0, err
+	}
+	couponQuery := fmt.Sprintf("UPDATE %s SET coupon_id=NULL, updated_at=now() WHERE id=$1;", cartsTable)
+	if _, err := tx.ExecContext(ctx, couponQuery, cartId); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// lockCart locks cart row and checks that its lines and coupon are still the
+// ones order was priced from
+func lockCart(ctx context.Context, tx *sqlx.Tx, cartId int, order models.Order) error {
+	var couponId *int
+	cartQuery := fmt.Sprintf("SELECT coupon_id FROM %s WHERE id=$1 FOR UPDATE;", cartsTable)
+	if err := tx.QueryRowContext(ctx, cartQuery, cartId).Scan(&couponId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrCartNotFound
+		}
+		return err
+	}
+
+	var lines []struct {
+		ItemId    int  `db:"item_id"`
+		ColorId   int  `db:"color_id"`
+		VariantId *int `db:"variant_id"`
+		Quantity  int  `db:"quantity"`
+	}
+	linesQuery := fmt.Sprintf("SELECT item_id, color_id, variant_id, quantity FROM %s WHERE cart_id=$1 ORDER BY id;", cartsItemsTable)
+	if err := tx.SelectContext(ctx, &lines, linesQuery, cartId); err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return models.ErrEmptyCart
+	}
+
+	if len(lines) != len(order.Items) || (couponId == nil) != (order.CouponId == nil) ||
+		couponId != nil && *couponId != *order.CouponId {
+		return models.ErrCartChanged
+	}
+	for i, line := range lines {
+		item := order.Items[i]
+		if item.ItemId == nil || *item.ItemId != line.ItemId || item.Color.Id != line.ColorId || item.Quantity != line.Quantity ||
+			(item.VariantId == nil) != (line.VariantId == nil) || item.VariantId != nil && *item.VariantId != *line.VariantId {
+			return models.ErrCartChanged
+		}
+	}
+
+	return nil
+}
+
+// $1 = orderId
+func (r *OrdersRepo) GetById(ctx context.Context, orderId int) (models.Order, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id=$1;", orderColumns, ordersTable)
+	order, err := scanOrder(r.db.QueryRowContext(ctx, query, orderId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Order{}, models.ErrOrderNotFound
+	} else if err != nil {
+		return models.Order{}, err
+	}
+
+	return order, nil
+}
+
+// $1 = userId
+func (r *OrdersRepo) GetByUser(ctx context.Context, userId int) ([]models.Order, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE user_id=$1 ORDER BY created_at DESC;", orderColumns, ordersTable)
+	return r.selectOrders(ctx, query, userId)
+}
+
+// GetAll returns all orders, filtered by status if it is not empty
+func (r *OrdersRepo) GetAll(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
+	if status == "" {
+		query := fmt.Sprintf("SELECT %s FROM %s ORDER BY created_at DESC;", orderColumns, ordersTable)
+		return r.selectOrders(ctx, query)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE status=$1 ORDER BY created_at DESC;", orderColumns, ordersTable)
+	return r.selectOrders(ctx, query, status)
+}
+
+func (r *OrdersRepo) selectOrders(ctx context.Context, query string, args ...interface{}) ([]models.Order, error) {
+	orders := make([]models.Order, 0)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// $1 = orderId
+func (r *OrdersRepo) GetItems(ctx context.Context, orderId int) ([]models.OrderItem, error) {
+	items := make([]models.OrderItem, 0)
+	query := fmt.Sprintf(`SELECT id, item_id, name, variant_id, sku, price, color_id, color_name, color_hex, color_price, quantity, total, discount
+		FROM %s WHERE order_id=$1 ORDER BY id;`, ordersItemsTable)
+	rows, err := r.db.QueryContext(ctx, query, orderId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			item    models.OrderItem
+			colorId sql.NullInt64
+		)
+		if err := rows.Scan(&item.Id, &item.ItemId, &item.Name, &item.VariantId, &item.Sku, &item.Price,
+			&colorId, &item.Color.Name, &item.Color.Hex, &item.Color.Price, &item.Quantity, &item.Total, &item.Discount); err != nil {
+			return nil, err
+		}
+		item.Color.Id = int(colorId.Int64)
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// $1 = orderId
+func (r *OrdersRepo) GetHistory(ctx context.Context, orderId int) ([]models.OrderHistory, error) {
+	var history []models.OrderHistory
+	query := fmt.Sprintf("SELECT status, created_at FROM %s WHERE order_id=$1 ORDER BY id;", ordersHistoryTable)
+	if err := r.db.SelectContext(ctx, &history, query, orderId); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// UpdateStatus changes order status only if it still has expected status
+func (r *OrdersRepo) UpdateStatus(ctx context.Context, orderId int, from, to models.OrderStatus) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := r.updateStatus(ctx, tx, orderId, from, to); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Cancel moves order into cancelled status and returns its reserved stock
+// and coupon usage
+func (r *OrdersRepo) Cancel(ctx context.Context, orderId int, from models.OrderStatus) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := r.updateStatus(ctx, tx, orderId, from, models.OrderStatusCancelled); err != nil {
+		return err
+	}
+
+	// Stock goes back where it was reserved from, to variant if line has one
+	releaseQuery := fmt.Sprintf(`UPDATE %s AS IC SET stock=IC.stock+OI.quantity FROM %s AS OI
+		WHERE OI.order_id=$1 AND OI.variant_id IS NULL AND IC.item_id=OI.item_id AND IC.color_id=OI.color_id;`, itemsColorsTable, ordersItemsTable)
+	if _, err := tx.ExecContext(ctx, releaseQuery, orderId); err != nil {
+		return err
+	}
+	releaseVariantsQuery := fmt.Sprintf(`UPDATE %s AS V SET stock=V.stock+OI.quantity FROM %s AS OI
+		WHERE OI.order_id=$1 AND V.id=OI.variant_id;`, itemsVariantsTable, ordersItemsTable)
+	if _, err := tx.ExecContext(ctx, releaseVariantsQuery, orderId); err != nil {
+		return err
+	}
+
+	movementsQuery := fmt.Sprintf(`INSERT INTO %s (item_id,color_id,variant_id,delta,reason,order_id)
+		SELECT OI.item_id, OI.color_id, OI.variant_id, OI.quantity, 'order cancellation', OI.order_id FROM %s AS OI
+		WHERE OI.order_id=$1 AND OI.item_id IS NOT NULL AND OI.color_id IS NOT NULL;`, stockMovementsTable, ordersItemsTable)
+	if _, err := tx.ExecContext(ctx, movementsQuery, orderId); err != nil {
+		return err
+	}
+
+	if err := releaseCoupon(ctx, tx, orderId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// $1 = to
+// $2 = orderId
+// $3 = from
+func (r *OrdersRepo) updateStatus(ctx context.Context, tx *sqlx.Tx, orderId int, from, to models.OrderStatus) error {
+	query := fmt.Sprintf("UPDATE %s SET status=$1, updated_at=now() WHERE id=$2 AND status=$3;", ordersTable)
+	res, err := tx.ExecContext(ctx, query, to, orderId, from)
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(res, models.ErrOrderStatusChange); err != nil {
+		return err
+	}
+
+	historyQuery := fmt.Sprintf("INSERT INTO %s (order_id,status) VALUES ($1,$2);", ordersHistoryTable)
+	_, err = tx.ExecContext(ctx, historyQuery, orderId, to)
+
+	return err
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"shop_backend/internal/models"
+)
+
+type PaymentsRepo struct {
+	db *sqlx.DB
+}
+
+func NewPaymentsRepo(db *sqlx.DB) *PaymentsRepo {
+	return &PaymentsRepo{db: db}
+}
+
+// Create saves payment, order may have only one payment which has not failed
+func (r *PaymentsRepo) Create(ctx context.Context, payment models.Payment) (int, error) {
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (order_id,provider,intent_id,amount,currency,status) VALUES ($1,$2,$3,$4,$5,$6) RETURNING id;", paymentsTable)
+	if err := r.db.QueryRowContext(ctx, query, payment.OrderId, payment.Provider, payment.IntentId,
+		payment.Amount, payment.Currency, payment.Status).Scan(&id); err != nil {
+		if pqError, ok := err.(*pq.Error); ok && pqError.Code == "23505" {
+			return 0, models.ErrPaymentExists
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// $1 = intentId
+func (r *PaymentsRepo) GetByIntent(ctx context.Context, intentId string) (models.Payment, error) {
+	var payment models.Payment
+	query := fmt.Sprintf("SELECT id, order_id, provider, intent_id, amount, currency, status, created_at, updated_at FROM %s WHERE intent_id=$1;", paymentsTable)
+	if err := r.db.GetContext(ctx, &payment, query, intentId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Payment{}, models.ErrPaymentNotFound
+		}
+		return models.Payment{}, err
+	}
+
+	return payment, nil
+}
+
+// $1 = orderId
+func (r *PaymentsRepo) GetByOrder(ctx context.Context, orderId int) ([]models.Payment, error) {
+	payments := make([]models.Payment, 0)
+	query := fmt.Sprintf("SELECT id, order_id, provider, intent_id, amount, currency, status, created_at, updated_at FROM %s WHERE order_id=$1 ORDER BY created_at DESC;", paymentsTable)
+	if err := r.db.SelectContext(ctx, &payments, query, orderId); err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// UpdateStatus changes payment status only if it still has expected status
+// $1 = to
+// $2 = paymentId
+// $3 = from
+func (r *PaymentsRepo) UpdateStatus(ctx context.Context, paymentId int, from, to string) error {
+	query := fmt.Sprintf("UPDATE %s SET status=$1, updated_at=now() WHERE id=$2 AND status=$3;", paymentsTable)
+	res, err := r.db.ExecContext(ctx, query, to, paymentId, from)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrPaymentStatus)
+}
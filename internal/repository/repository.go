@@ -2,24 +2,55 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"shop_backend/internal/models"
+	"time"
 )
 
 const (
-	usersTable         = "users"
-	categoriesTable    = "categories"
-	itemsTable         = "items"
-	colorsTable        = "colors"
-	itemsColorsTable   = "items_colors"
-	tagsTable          = "tags"
-	imagesTable        = "images"
-	itemsImagesTable   = "items_images"
-	sessionsTable      = "sessions"
-	addressTable       = "address"
-	usersInvoiceTable  = "users_invoice"
-	usersShippingTable = "users_shipping"
-	phonesTable        = "phone_numbers"
+	usersTable              = "users"
+	categoriesTable         = "categories"
+	itemsTable              = "items"
+	colorsTable             = "colors"
+	itemsColorsTable        = "items_colors"
+	tagsTable               = "tags"
+	imagesTable             = "images"
+	itemsImagesTable        = "items_images"
+	sessionsTable           = "sessions"
+	sessionsUsedTokensTable = "sessions_used_tokens"
+	usersTokensTable        = "users_tokens"
+	usersTotpTable          = "users_totp"
+	usersRecoveryCodesTable = "users_recovery_codes"
+	rolesTable              = "roles"
+	rolesPermissionsTable   = "roles_permissions"
+	usersRolesTable         = "users_roles"
+	loginAttemptsTable      = "login_attempts"
+	apiKeysTable            = "api_keys"
+	apiKeysScopesTable      = "api_keys_scopes"
+	auditLogTable           = "audit_log"
+	usersIdentitiesTable    = "users_identities"
+	oauthStatesTable        = "oauth_states"
+	addressTable            = "address"
+	usersInvoiceTable       = "users_invoice"
+	usersShippingTable      = "users_shipping"
+	phonesTable             = "phone_numbers"
+	cartsTable              = "carts"
+	cartsItemsTable         = "carts_items"
+	ordersTable             = "orders"
+	ordersItemsTable        = "orders_items"
+	ordersHistoryTable      = "orders_history"
+	stockMovementsTable     = "stock_movements"
+	itemsVariantsTable      = "items_variants"
+	variantsOptionsTable    = "variants_options"
+	variantsImagesTable     = "variants_images"
+	paymentsTable           = "payments"
+	couponsTable            = "coupons"
+	couponsCategoriesTable  = "coupons_categories"
+	couponsTagsTable        = "coupons_tags"
+	couponsRedemptionsTable = "coupons_redemptions"
 )
 
 type Images interface {
@@ -46,9 +77,12 @@ type Categories interface {
 	Exist(categoryId int) (bool, error)
 	Create(category models.Category) (int, error)
 	GetAll() ([]models.Category, error)
-	Delete(categoryId int) error
+	Delete(categoryId int, moveTo *int) error
 	GetById(categoryId int) (models.Category, error)
+	GetPath(categoryId int) ([]models.Category, error)
+	GetChildren(categoryId int) ([]models.Category, error)
 	Update(category models.Category) error
+	Move(categoryId int, parentId *int, position int) error
 }
 
 type Items interface {
@@ -57,53 +91,233 @@ type Items interface {
 	LinkTag(itemId int, tag string) error
 	LinkImage(itemId, imageId int) error
 	GetNew(limit int) ([]int, error)
-	GetById(itemId int) (models.Item, error)
+	GetByIds(itemsId []int) ([]models.Item, error)
 	GetBySku(sku string) (models.Item, error)
-	GetByCategory(categoryId int) ([]int, error)
+	GetByCategory(categoryId int, descendants bool) ([]int, error)
 	GetByTag(tag string) ([]int, error)
-	GetColors(itemId int) ([]models.Color, error)
-	GetTags(itemId int) ([]models.Tag, error)
-	GetImages(itemId int) ([]models.Image, error)
+	GetColorsByItems(itemsId []int) (map[int][]models.Color, error)
+	GetTagsByItems(itemsId []int) (map[int][]models.Tag, error)
+	GetImagesByItems(itemsId []int) (map[int][]models.Image, error)
 	Update(itemId int, name, description string, categoryId int, price float64, sku string) error
 	Delete(itemId int) error
 	DeleteTags(itemId int) error
 	DeleteImages(itemId int) error
 	DeleteColors(itemId int) error
 	Exist(itemId int) (bool, error)
+	HasColor(itemId, colorId int) (bool, error)
+	HasVariant(itemId, variantId int) (bool, error)
+	DeleteColorsExcept(itemId int, colorsId []int) error
+	AdjustStock(movement models.StockMovement) error
+	GetStockMovements(itemId int) ([]models.StockMovement, error)
+	Search(text string, limit, offset int) ([]models.SearchResult, error)
+	List(query models.ItemsQuery) ([]int, *models.ItemsCursor, error)
+	Facets(filter models.ItemsFilter) (models.Facets, error)
+	GetVariantsByItems(itemsId []int) (map[int][]models.Variant, error)
+	GetVariantBySku(sku string) (models.Variant, error)
+	SaveVariants(itemId int, variants []models.Variant) error
 }
 
 type Users interface {
-	SetSession(ctx context.Context, userId int, session models.Session) error
-	DeleteSession(ctx context.Context, userId int) error
 	Delete(ctx context.Context, userId int) error
 	Create(ctx context.Context, user models.User) (models.User, error)
 	CreatePhone(ctx context.Context, userId int) error
 	CreateDefaultAddress(ctx context.Context, table string, userId int) error
 	LinkAddress(ctx context.Context, table string, userId int, addressId int) error
 	CreateAddress(ctx context.Context, address models.Address) (models.Address, error)
-	GetByCredentials(ctx context.Context, findBy, login, password string) (models.User, error)
-	GetByRefreshToken(ctx context.Context, refreshToken string) (models.User, error)
+	GetByLogin(ctx context.Context, findBy, login string) (models.User, error)
 	GetById(ctx context.Context, userId int) (models.User, error)
 	GetPhone(ctx context.Context, userId int) (models.Phone, error)
 	GetAddress(ctx context.Context, typeof string, userId int) (models.Address, error)
 	UpdateField(ctx context.Context, field string, value interface{}, userId int) error
 	UpdatePhone(ctx context.Context, phoneCode, phoneNumber string, userId int) error
+	ConfirmEmail(ctx context.Context, userId int, email string) error
+	GetTokenVersion(ctx context.Context, userId int) (int, error)
+	IncrementTokenVersion(ctx context.Context, userId int) (int, error)
+}
+
+type Sessions interface {
+	Create(ctx context.Context, session models.Session) (int, error)
+	Rotate(ctx context.Context, refreshTokenHash string, session models.Session) (models.Session, error)
+	GetByUser(ctx context.Context, userId int) ([]models.Session, error)
+	Exists(ctx context.Context, sessionId int) (bool, error)
+	Delete(ctx context.Context, userId, sessionId int) error
+	DeleteOthers(ctx context.Context, userId, currentId int) ([]int, error)
+	DeleteByUser(ctx context.Context, userId int) error
+}
+
+type UsersTokens interface {
+	Create(ctx context.Context, token models.UserToken) error
+	Consume(ctx context.Context, kind models.UserTokenKind, tokenHash string) (models.UserToken, error)
+	Attempt(ctx context.Context, kind models.UserTokenKind, tokenHash string, maxAttempts int) (int, error)
+	GetUserId(ctx context.Context, kind models.UserTokenKind, tokenHash string) (int, error)
+	DeleteUnused(ctx context.Context, userId int, kind models.UserTokenKind) error
+}
+
+type TwoFactor interface {
+	Get(ctx context.Context, userId int) (models.TwoFactor, error)
+	SetSecret(ctx context.Context, userId int, secret string) error
+	Enable(ctx context.Context, userId int, step int64, recoveryHashes []string) error
+	Disable(ctx context.Context, userId int) error
+	UseStep(ctx context.Context, userId int, step int64) error
+	UseRecoveryCode(ctx context.Context, userId int, codeHash string) error
+}
+
+type Roles interface {
+	Create(ctx context.Context, role models.Role) (int, error)
+	Update(ctx context.Context, role models.Role) error
+	Delete(ctx context.Context, roleId int) error
+	GetById(ctx context.Context, roleId int) (models.Role, error)
+	GetAll(ctx context.Context) ([]models.Role, error)
+	GetByUser(ctx context.Context, userId int) ([]models.Role, error)
+	GetPermissions(ctx context.Context, userId int) ([]models.Permission, error)
+	GetUsersIds(ctx context.Context, roleId int) ([]int, error)
+	SetUserRoles(ctx context.Context, userId int, rolesId []int) error
+	CountWithPermission(ctx context.Context, permission models.Permission) (int, error)
+}
+
+type LoginAttempts interface {
+	Create(ctx context.Context, attempt models.LoginAttempt) error
+	GetAll(ctx context.Context, filter models.LoginAttemptsFilter) ([]models.LoginAttempt, error)
+	RegisterFailure(ctx context.Context, userId, maxFailures int, lockFor time.Duration) (bool, error)
+	IsLocked(ctx context.Context, userId int) (bool, error)
+	Unlock(ctx context.Context, userId int) error
+	GetLockouts(ctx context.Context) ([]models.Lockout, error)
+	GetLockout(ctx context.Context, userId int) (models.LockoutState, error)
+}
+
+type Identities interface {
+	Get(ctx context.Context, provider, subject string) (models.UserIdentity, error)
+	Create(ctx context.Context, identity models.UserIdentity) error
+	CreateState(ctx context.Context, state models.OAuthState) error
+	ConsumeState(ctx context.Context, provider, stateHash string) (models.OAuthState, error)
+}
+
+type ApiKeys interface {
+	Create(ctx context.Context, key models.ApiKey) (int, error)
+	GetById(ctx context.Context, keyId int) (models.ApiKey, error)
+	GetActive(ctx context.Context, keyHash string) (models.ApiKey, error)
+	GetAll(ctx context.Context) ([]models.ApiKey, error)
+	Rotate(ctx context.Context, keyId int, prefix, keyHash string) error
+	Revoke(ctx context.Context, keyId int) error
+	Touch(ctx context.Context, keyId int, ip string) error
+}
+
+type Audit interface {
+	Create(ctx context.Context, entry models.AuditEntry) error
+	GetAll(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+type Carts interface {
+	GetOrCreate(ctx context.Context, userId int) (int, error)
+	CreateGuest(ctx context.Context, token string) (int, error)
+	GetByToken(ctx context.Context, token string) (int, error)
+	Merge(ctx context.Context, token string, userId int) error
+	AddItem(ctx context.Context, cartId, itemId, colorId int, variantId *int, quantity int) error
+	UpdateQuantity(ctx context.Context, cartId, lineId, quantity int) error
+	DeleteItem(ctx context.Context, cartId, lineId int) error
+	Clear(ctx context.Context, cartId int) error
+	GetItems(ctx context.Context, cartId int) ([]models.CartItem, error)
+	SetCoupon(ctx context.Context, cartId int, couponId *int) error
+	GetCouponId(ctx context.Context, cartId int) (*int, error)
+}
+
+type Orders interface {
+	Create(ctx context.Context, cartId int, order models.Order) (int, error)
+	GetById(ctx context.Context, orderId int) (models.Order, error)
+	GetByUser(ctx context.Context, userId int) ([]models.Order, error)
+	GetAll(ctx context.Context, status models.OrderStatus) ([]models.Order, error)
+	GetItems(ctx context.Context, orderId int) ([]models.OrderItem, error)
+	GetHistory(ctx context.Context, orderId int) ([]models.OrderHistory, error)
+	UpdateStatus(ctx context.Context, orderId int, from, to models.OrderStatus) error
+	Cancel(ctx context.Context, orderId int, from models.OrderStatus) error
+}
+
+type Payments interface {
+	Create(ctx context.Context, payment models.Payment) (int, error)
+	GetByIntent(ctx context.Context, intentId string) (models.Payment, error)
+	GetByOrder(ctx context.Context, orderId int) ([]models.Payment, error)
+	UpdateStatus(ctx context.Context, paymentId int, from, to string) error
+}
+
+type Coupons interface {
+	Create(ctx context.Context, coupon models.Coupon) (int, error)
+	Update(ctx context.Context, coupon models.Coupon) error
+	Delete(ctx context.Context, couponId int) error
+	GetById(ctx context.Context, couponId int) (models.Coupon, error)
+	GetByCode(ctx context.Context, code string) (models.Coupon, error)
+	GetAll(ctx context.Context) ([]models.Coupon, error)
+	CountRedemptions(ctx context.Context, couponId, userId int) (int, error)
 }
 
 type Repositories struct {
-	Users      Users
-	Items      Items
-	Categories Categories
-	Colors     Colors
-	Images     Images
+	Users         Users
+	Sessions      Sessions
+	UsersTokens   UsersTokens
+	TwoFactor     TwoFactor
+	Roles         Roles
+	LoginAttempts LoginAttempts
+	Identities    Identities
+	ApiKeys       ApiKeys
+	Audit         Audit
+	Items         Items
+	Categories    Categories
+	Colors        Colors
+	Images        Images
+	Carts         Carts
+	Orders        Orders
+	Payments      Payments
+	Coupons       Coupons
 }
 
 func NewRepositories(db *sqlx.DB) *Repositories {
 	return &Repositories{
-		Users:      NewUsersRepo(db),
-		Items:      NewItemsRepo(db),
-		Categories: NewCategoriesRepo(db),
-		Colors:     NewColorsRepo(db),
-		Images:     NewImagesRepo(db),
+		Users:         NewUsersRepo(db),
+		Sessions:      NewSessionsRepo(db),
+		UsersTokens:   NewUsersTokensRepo(db),
+		TwoFactor:     NewTwoFactorRepo(db),
+		Roles:         NewRolesRepo(db),
+		LoginAttempts: NewLoginAttemptsRepo(db),
+		Identities:    NewIdentitiesRepo(db),
+		ApiKeys:       NewApiKeysRepo(db),
+		Audit:         NewAuditRepo(db),
+		Items:         NewItemsRepo(db),
+		Categories:    NewCategoriesRepo(db),
+		Colors:        NewColorsRepo(db),
+		Images:        NewImagesRepo(db),
+		Carts:         NewCartsRepo(db),
+		Orders:        NewOrdersRepo(db),
+		Payments:      NewPaymentsRepo(db),
+		Coupons:       NewCouponsRepo(db),
+	}
+}
+
+// insertStockMovement records stock change inside of transaction
+func insertStockMovement(tx *sqlx.Tx, movement models.StockMovement) error {
+	query := fmt.Sprintf("INSERT INTO %s (item_id,color_id,variant_id,delta,reason,order_id,user_id) VALUES ($1,$2,$3,$4,$5,$6,$7);", stockMovementsTable)
+	_, err := tx.Exec(query, movement.ItemId, movement.ColorId, movement.VariantId, movement.Delta, movement.Reason, movement.OrderId, movement.UserId)
+
+	return err
+}
+
+// uniqueViolation converts unique constraint violation into models.ErrUniqueValue of field
+func uniqueViolation(err error, field string) error {
+	if pqError, ok := err.(*pq.Error); ok && pqError.Code == "23505" {
+		return models.NewErrUniqueValue(field)
 	}
+
+	return err
+}
+
+// checkAffected returns notFound if the statement did not touch any row
+func checkAffected(res sql.Result, notFound error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return notFound
+	}
+
+	return nil
 }
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"shop_backend/internal/models"
+)
+
+type RolesRepo struct {
+	db *sqlx.DB
+}
+
+func NewRolesRepo(db *sqlx.DB) *RolesRepo {
+	return &RolesRepo{db: db}
+}
+
+func (r *RolesRepo) Create(ctx context.Context, role models.Role) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (name,description) VALUES ($1,$2) RETURNING id;", rolesTable)
+	if err := tx.QueryRowxContext(ctx, query, role.Name, role.Description).Scan(&id); err != nil {
+		return 0, uniqueViolation(err, "name")
+	}
+
+	if err := insertPermissions(ctx, tx, id, role.Permissions); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// Update changes name and description of role and replaces its permissions
+func (r *RolesRepo) Update(ctx context.Context, role models.Role) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("UPDATE %s SET name=$1, description=$2 WHERE id=$3;", rolesTable)
+	res, err := tx.ExecContext(ctx, query, role.Name, role.Description, role.Id)
+	if err != nil {
+		return uniqueViolation(err, "name")
+	}
+	if err := checkAffected(res, models.ErrRoleNotFound); err != nil {
+		return err
+	}
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE role_id=$1;", rolesPermissionsTable)
+	if _, err := tx.ExecContext(ctx, deleteQuery, role.Id); err != nil {
+		return err
+	}
+
+	if err := insertPermissions(ctx, tx, role.Id, role.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertPermissions(ctx context.Context, tx *sqlx.Tx, roleId int, permissions []models.Permission) error {
+	query := fmt.Sprintf("INSERT INTO %s (role_id,permission) VALUES ($1,$2) ON CONFLICT DO NOTHING;", rolesPermissionsTable)
+	for _, permission := range permissions {
+		if _, err := tx.ExecContext(ctx, query, roleId, permission); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *RolesRepo) Delete(ctx context.Context, roleId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id=$1;", rolesTable)
+	res, err := r.db.ExecContext(ctx, query, roleId)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrRoleNotFound)
+}
+
+const roleColumns = `R.id, R.name, R.description, R.created_at,
+	ARRAY(SELECT RP.permission FROM roles_permissions AS RP WHERE RP.role_id=R.id ORDER BY RP.permission)`
+
+func scanRole(row rowScanner) (models.Role, error) {
+	var (
+		role        models.Role
+		permissions []string
+	)
+	if err := row.Scan(&role.Id, &role.Name, &role.Description, &role.CreatedAt, pq.Array(&permissions)); err != nil {
+		return models.Role{}, err
+	}
+
+	role.Permissions = make([]models.Permission, 0, len(permissions))
+	for _, permission := range permissions {
+		role.Permissions = append(role.Permissions, models.Permission(permission))
+	}
+
+	return role, nil
+}
+
+func (r *RolesRepo) GetById(ctx context.Context, roleId int) (models.Role, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s AS R WHERE R.id=$1;", roleColumns, rolesTable)
+	role, err := scanRole(r.db.QueryRowxContext(ctx, query, roleId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Role{}, models.ErrRoleNotFound
+	}
+
+	return role, err
+}
+
+func (r *RolesRepo) GetAll(ctx context.Context) ([]models.Role, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s AS R ORDER BY R.name;", roleColumns, rolesTable)
+	return r.selectRoles(ctx, query)
+}
+
+func (r *RolesRepo) GetByUser(ctx context.Context, userId int) ([]models.Role, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s AS R JOIN %s AS UR ON UR.role_id=R.id WHERE UR.user_id=$1 ORDER BY R.name;",
+		roleColumns, rolesTable, usersRolesTable)
+	return r.selectRoles(ctx, query, userId)
+}
+
+func (r *RolesRepo) selectRoles(ctx context.Context, query string, args ...interface{}) ([]models.Role, error) {
+	rows, err := r.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]models.Role, 0)
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GetPermissions returns permissions granted to user by all of their roles
+func (r *RolesRepo) GetPermissions(ctx context.Context, userId int) ([]models.Permission, error) {
+	permissions := make([]models.Permission, 0)
+	query := fmt.Sprintf(`SELECT DISTINCT RP.permission FROM %s AS UR JOIN %s AS RP ON RP.role_id=UR.role_id
+		WHERE UR.user_id=$1 ORDER BY RP.permission;`, usersRolesTable, rolesPermissionsTable)
+	if err := r.db.SelectContext(ctx, &permissions, query, userId); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// GetUsersIds returns ids of users having role
+func (r *RolesRepo) GetUsersIds(ctx context.Context, roleId int) ([]int, error) {
+	usersIds := make([]int, 0)
+	query := fmt.Sprintf("SELECT user_id FROM %s WHERE role_id=$1;", usersRolesTable)
+	if err := r.db.SelectContext(ctx, &usersIds, query, roleId); err != nil {
+		return nil, err
+	}
+
+	return usersIds, nil
+}
+
+// SetUserRoles replaces roles of user
+func (r *RolesRepo) SetUserRoles(ctx context.Context, userId int, rolesId []int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE user_id=$1;", usersRolesTable)
+	if _, err := tx.ExecContext(ctx, deleteQuery, userId); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (user_id,role_id) VALUES ($1,$2) ON CONFLICT DO NOTHING;", usersRolesTable)
+	for _, roleId := range rolesId {
+		if _, err := tx.ExecContext(ctx, query, userId, roleId); err != nil {
+			return foreignKeyViolation(err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// foreignKeyViolation converts missing user or role of users_roles into not found error
+func foreignKeyViolation(err error) error {
+	if pqError, ok := err.(*pq.Error); ok && pqError.Code == "23503" {
+		if pqError.Constraint == "users_roles_user_id_fkey" {
+			return models.ErrUserNotFound
+		}
+		return models.ErrRoleNotFound
+	}
+
+	return err
+}
+
+// CountWithPermission returns number of users having permission through any of their roles
+func (r *RolesRepo) CountWithPermission(ctx context.Context, permission models.Permission) (int, error) {
+	var count int
+	query := fmt.Sprintf(`SELECT count(DISTINCT UR.user_id) FROM %s AS UR JOIN %s AS RP ON RP.role_id=UR.role_id
+		WHERE RP.permission=$1;`, usersRolesTable, rolesPermissionsTable)
+	if err := r.db.GetContext(ctx, &count, query, permission); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"fmt"
+	"shop_backend/internal/models"
+	"strings"
+	"unicode"
+)
+
+const searchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=25, MinWords=10, MaxFragments=2"
+
+// Search finds items by name, description, tags and category name. Every
+// word of text is matched as prefix, so partially typed words are found too.
+// Results are ordered by relevance
+func (r *ItemsRepo) Search(text string, limit, offset int) ([]models.SearchResult, error) {
+	results := make([]models.SearchResult, 0)
+	tsQuery := prefixTsQuery(text)
+	if tsQuery == "" {
+		return results, nil
+	}
+
+	query := fmt.Sprintf(`SELECT I.id, ts_rank(I.search, Q) AS rank,
+		ts_headline('simple', %s, Q, 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'),
+		ts_headline('simple', %s, Q, '%s')
+		FROM %s AS I, to_tsquery('simple', $1) AS Q
+		WHERE I.search @@ Q ORDER BY rank DESC, I.id LIMIT $2 OFFSET $3;`,
+		escapeHTML("I.name"), escapeHTML("I.description"), searchHeadlineOptions, itemsTable)
+	rows, err := r.db.Query(query, tsQuery, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result models.SearchResult
+		if err := rows.Scan(&result.Item.Id, &result.Rank, &result.Highlight.Name, &result.Highlight.Description); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// escapeHTML returns SQL expression escaping HTML of column, so highlight
+// marks are the only markup in headline. Ampersand goes first, otherwise
+// entities of brackets would be escaped again
+func escapeHTML(column string) string {
+	return fmt.Sprintf("replace(replace(replace(%s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')", column)
+}
+
+// prefixTsQuery turns user input into tsquery where all words are required
+// and each of them is matched as prefix: "red sh" -> "red:* & sh:*".
+// Punctuation is dropped so input cannot break tsquery syntax
+func prefixTsQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i := range words {
+		words[i] += ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
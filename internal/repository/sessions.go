@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"shop_backend/internal/models"
+)
+
+type SessionsRepo struct {
+	db *sqlx.DB
+}
+
+func NewSessionsRepo(db *sqlx.DB) *SessionsRepo {
+	return &SessionsRepo{db: db}
+}
+
+const sessionColumns = "id, user_id, refresh_token, expires_at, user_agent, ip, created_at, last_used_at"
+
+// Create starts new session and removes expired sessions of the same user
+func (r *SessionsRepo) Create(ctx context.Context, session models.Session) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE user_id=$1 AND expires_at <= now();", sessionsTable)
+	if _, err := tx.ExecContext(ctx, deleteQuery, session.UserId); err != nil {
+		return 0, err
+	}
+
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (user_id,refresh_token,expires_at,user_agent,ip) VALUES ($1,$2,$3,$4,$5) RETURNING id;", sessionsTable)
+	if err := tx.QueryRowxContext(ctx, query, session.UserId, session.RefreshToken, session.ExpiresAt,
+		session.UserAgent, session.Ip).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// Rotate exchanges refresh token hash of active session for session.RefreshToken
+// and returns updated session. Expiry is checked by database clock. Old hash is
+// remembered, if it is presented again the session is deleted and
+// models.ErrRefreshTokenReused is returned
+func (r *SessionsRepo) Rotate(ctx context.Context, refreshTokenHash string, session models.Session) (models.Session, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return models.Session{}, err
+	}
+	defer tx.Rollback()
+
+	var current models.Session
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE refresh_token=$1 AND expires_at > now() FOR UPDATE;", sessionColumns, sessionsTable)
+	err = tx.GetContext(ctx, &current, query, refreshTokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Session{}, r.revokeReused(ctx, tx, refreshTokenHash)
+	} else if err != nil {
+		return models.Session{}, err
+	}
+
+	usedQuery := fmt.Sprintf("INSERT INTO %s (session_id,refresh_token) VALUES ($1,$2);", sessionsUsedTokensTable)
+	if _, err := tx.ExecContext(ctx, usedQuery, current.Id, refreshTokenHash); err != nil {
+		return models.Session{}, err
+	}
+
+	updateQuery := fmt.Sprintf(`UPDATE %s SET refresh_token=$1, expires_at=$2, user_agent=$3, ip=$4, last_used_at=now()
+		WHERE id=$5 RETURNING %s;`, sessionsTable, sessionColumns)
+	var rotated models.Session
+	if err := tx.GetContext(ctx, &rotated, updateQuery, session.RefreshToken, session.ExpiresAt,
+		session.UserAgent, session.Ip, current.Id); err != nil {
+		return models.Session{}, err
+	}
+
+	return rotated, tx.Commit()
+}
+
+// revokeReused deletes session which refresh token has already been used.
+// Unknown tokens result in models.ErrSessionNotFound
+func (r *SessionsRepo) revokeReused(ctx context.Context, tx *sqlx.Tx, refreshTokenHash string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id=(SELECT session_id FROM %s WHERE refresh_token=$1);", sessionsTable, sessionsUsedTokensTable)
+	res, err := tx.ExecContext(ctx, query, refreshTokenHash)
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(res, models.ErrSessionNotFound); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return models.ErrRefreshTokenReused
+}
+
+// GetByUser returns active sessions of user, most recently used first
+func (r *SessionsRepo) GetByUser(ctx context.Context, userId int) ([]models.Session, error) {
+	sessions := make([]models.Session, 0)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE user_id=$1 AND expires_at > now() ORDER BY last_used_at DESC;", sessionColumns, sessionsTable)
+	if err := r.db.SelectContext(ctx, &sessions, query, userId); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Exists reports whether session has not been deleted, expired sessions exist
+// until they are cleaned up
+func (r *SessionsRepo) Exists(ctx context.Context, sessionId int) (bool, error) {
+	var exists bool
+	query := fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE id=$1);", sessionsTable)
+	if err := r.db.QueryRowxContext(ctx, query, sessionId).Scan(&exists); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *SessionsRepo) Delete(ctx context.Context, userId, sessionId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id=$1 AND user_id=$2;", sessionsTable)
+	res, err := r.db.ExecContext(ctx, query, sessionId, userId)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrSessionNotFound)
+}
+
+// DeleteOthers deletes all sessions of user except the current one and
+// returns ids of deleted sessions
+func (r *SessionsRepo) DeleteOthers(ctx context.Context, userId, currentId int) ([]int, error) {
+	ids := make([]int, 0)
+	query := fmt.Sprintf("DELETE FROM %s WHERE user_id=$1 AND id<>$2 RETURNING id;", sessionsTable)
+	if err := r.db.SelectContext(ctx, &ids, query, userId, currentId); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (r *SessionsRepo) DeleteByUser(ctx context.Context, userId int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE user_id=$1;", sessionsTable)
+	_, err := r.db.ExecContext(ctx, query, userId)
+
+	return err
+}
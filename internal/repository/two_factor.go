@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"shop_backend/internal/models"
+)
+
+type TwoFactorRepo struct {
+	db *sqlx.DB
+}
+
+func NewTwoFactorRepo(db *sqlx.DB) *TwoFactorRepo {
+	return &TwoFactorRepo{db: db}
+}
+
+func (r *TwoFactorRepo) Get(ctx context.Context, userId int) (models.TwoFactor, error) {
+	var twoFactor models.TwoFactor
+	query := fmt.Sprintf("SELECT user_id, secret, enabled, last_step, created_at FROM %s WHERE user_id=$1;", usersTotpTable)
+	err := r.db.GetContext(ctx, &twoFactor, query, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.TwoFactor{}, models.ErrTwoFactorNotEnrolled
+	}
+
+	return twoFactor, err
+}
+
+// SetSecret starts new enrollment replacing not yet enabled one
+func (r *TwoFactorRepo) SetSecret(ctx context.Context, userId int, secret string) error {
+	query := fmt.Sprintf(`INSERT INTO %[1]s (user_id,secret) VALUES ($1,$2)
+		ON CONFLICT (user_id) DO UPDATE SET secret=$2, last_step=NULL, created_at=now() WHERE %[1]s.enabled=false;`, usersTotpTable)
+	res, err := r.db.ExecContext(ctx, query, userId, secret)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrTwoFactorEnabled)
+}
+
+// Enable turns on enrolled two-factor authentication accepting code of step
+// and replaces recovery codes of user
+func (r *TwoFactorRepo) Enable(ctx context.Context, userId int, step int64, recoveryHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("UPDATE %s SET enabled=true, last_step=$2 WHERE user_id=$1 AND enabled=false;", usersTotpTable)
+	res, err := tx.ExecContext(ctx, query, userId, step)
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(res, models.ErrTwoFactorEnabled); err != nil {
+		return err
+	}
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE user_id=$1;", usersRecoveryCodesTable)
+	if _, err := tx.ExecContext(ctx, deleteQuery, userId); err != nil {
+		return err
+	}
+
+	insertQuery := fmt.Sprintf("INSERT INTO %s (user_id,code_hash) VALUES ($1,$2);", usersRecoveryCodesTable)
+	for _, hash := range recoveryHashes {
+		if _, err := tx.ExecContext(ctx, insertQuery, userId, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Disable removes enrollment and recovery codes of user
+func (r *TwoFactorRepo) Disable(ctx context.Context, userId int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE user_id=$1;", usersTotpTable)
+	res, err := tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(res, models.ErrTwoFactorNotEnrolled); err != nil {
+		return err
+	}
+
+	codesQuery := fmt.Sprintf("DELETE FROM %s WHERE user_id=$1;", usersRecoveryCodesTable)
+	if _, err := tx.ExecContext(ctx, codesQuery, userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep accepts code of time step once, codes of already used or earlier
+// steps result in models.ErrInvalidOneTimeCode
+func (r *TwoFactorRepo) UseStep(ctx context.Context, userId int, step int64) error {
+	query := fmt.Sprintf("UPDATE %s SET last_step=$2 WHERE user_id=$1 AND (last_step IS NULL OR last_step < $2);", usersTotpTable)
+	res, err := r.db.ExecContext(ctx, query, userId, step)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrInvalidOneTimeCode)
+}
+
+// UseRecoveryCode marks unused recovery code as used
+func (r *TwoFactorRepo) UseRecoveryCode(ctx context.Context, userId int, codeHash string) error {
+	query := fmt.Sprintf("UPDATE %s SET used_at=now() WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL;", usersRecoveryCodesTable)
+	res, err := r.db.ExecContext(ctx, query, userId, codeHash)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, models.ErrInvalidOneTimeCode)
+}
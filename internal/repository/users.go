@@ -7,7 +7,6 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"shop_backend/internal/models"
-	"time"
 )
 
 type UsersRepo struct {
@@ -66,12 +65,12 @@ func (r *UsersRepo) LinkAddress(ctx context.Context, table string, userId int, a
 	return err
 }
 
+// GetByLogin returns user with password hash, password must be verified by caller
 // $1 = login
-// $2 = password
-func (r *UsersRepo) GetByCredentials(ctx context.Context, findBy, login, password string) (models.User, error) {
+func (r *UsersRepo) GetByLogin(ctx context.Context, findBy, login string) (models.User, error) {
 	var user models.User
-	query := fmt.Sprintf("SELECT * FROM %s WHERE %s=$1 AND password=$2 LIMIT 1;", usersTable, findBy)
-	rows, err := r.db.QueryxContext(ctx, query, login, password)
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s=$1 LIMIT 1;", usersTable, findBy)
+	rows, err := r.db.QueryxContext(ctx, query, login)
 	if err == sql.ErrNoRows {
 		return models.User{}, models.ErrUserNotFound
 	} else if err != nil {
@@ -84,34 +83,13 @@ func (r *UsersRepo) GetByCredentials(ctx context.Context, findBy, login, passwor
 		}
 	}
 
-	if user == (models.User{}) {
+	if user.Id == 0 {
 		return models.User{}, models.ErrUserNotFound
 	}
 
 	return user, nil
 }
 
-// $1 = refreshToken
-// $2 = time.Now()
-func (r *UsersRepo) GetByRefreshToken(ctx context.Context, refreshToken string) (models.User, error) {
-	var user models.User
-	query := fmt.Sprintf("SELECT U.* FROM %s AS S, %s AS U WHERE S.refresh_token=$1 AND S.expires_at > $2::timestamp AND U.id=S.user_id;", sessionsTable, usersTable)
-	rows, err := r.db.QueryxContext(ctx, query, refreshToken, time.Now())
-	if err == sql.ErrNoRows {
-		return models.User{}, models.ErrUserNotFound
-	} else if err != nil {
-		return models.User{}, err
-	}
-
-	for rows.Next() {
-		if err := rows.StructScan(&user); err != nil {
-			return models.User{}, err
-		}
-	}
-
-	return user, nil
-}
-
 // $1 = userId
 func (r *UsersRepo) GetById(ctx context.Context, userId int) (models.User, error) {
 	var user models.User
@@ -150,21 +128,42 @@ func (r *UsersRepo) GetPhone(ctx context.Context, userId int) (models.Phone, err
 	return phone, err
 }
 
+// ConfirmEmail marks email as verified if it is pending email of user, which
+// replaces current one, or current email when there is no pending one
+func (r *UsersRepo) ConfirmEmail(ctx context.Context, userId int, email string) error {
+	query := fmt.Sprintf(`UPDATE %s SET email=$2, pending_email=NULL, email_verified=true
+		WHERE id=$1 AND (pending_email=$2 OR pending_email IS NULL AND email=$2);`, usersTable)
+	res, err := r.db.ExecContext(ctx, query, userId, email)
+	if err != nil {
+		return uniqueViolation(err, "email")
+	}
+
+	return checkAffected(res, models.ErrInvalidToken)
+}
+
 // $1 = userId
-// $2 = refreshToken
-// $3 = expiresAt
-func (r *UsersRepo) SetSession(ctx context.Context, userId int, session models.Session) error {
-	query := fmt.Sprintf("INSERT INTO %s (user_id,refresh_token,expires_at) VALUES ($1,$2,$3);", sessionsTable)
-	_, err := r.db.ExecContext(ctx, query, userId, session.RefreshToken, session.ExpiresAt)
-	return err
+func (r *UsersRepo) GetTokenVersion(ctx context.Context, userId int) (int, error) {
+	var version int
+	query := fmt.Sprintf("SELECT token_version FROM %s WHERE id=$1;", usersTable)
+	err := r.db.QueryRowContext(ctx, query, userId).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, models.ErrUserNotFound
+	}
+
+	return version, err
 }
 
+// IncrementTokenVersion invalidates all access tokens of user and returns new version
 // $1 = userId
-func (r *UsersRepo) DeleteSession(ctx context.Context, userId int) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE user_id=$1;", sessionsTable)
-	_, err := r.db.ExecContext(ctx, query, userId)
+func (r *UsersRepo) IncrementTokenVersion(ctx context.Context, userId int) (int, error) {
+	var version int
+	query := fmt.Sprintf("UPDATE %s SET token_version=token_version+1 WHERE id=$1 RETURNING token_version;", usersTable)
+	err := r.db.QueryRowContext(ctx, query, userId).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, models.ErrUserNotFound
+	}
 
-	return err
+	return version, err
 }
 
 // $1 = userId
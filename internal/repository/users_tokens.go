@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"shop_backend/internal/models"
+)
+
+type UsersTokensRepo struct {
+	db *sqlx.DB
+}
+
+func NewUsersTokensRepo(db *sqlx.DB) *UsersTokensRepo {
+	return &UsersTokensRepo{db: db}
+}
+
+// Create stores token replacing unused tokens of the same kind, so only the
+// latest email sent to user is valid
+func (r *UsersTokensRepo) Create(ctx context.Context, token models.UserToken) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE user_id=$1 AND kind=$2 AND used_at IS NULL;", usersTokensTable)
+	if _, err := tx.ExecContext(ctx, deleteQuery, token.UserId, token.Kind); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (user_id,kind,token_hash,email,expires_at) VALUES ($1,$2,$3,$4,$5);", usersTokensTable)
+	if _, err := tx.ExecContext(ctx, query, token.UserId, token.Kind, token.TokenHash, token.Email, token.ExpiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Attempt counts attempt to use unused and not expired token and returns its
+// user id while number of attempts does not exceed maxAttempts
+func (r *UsersTokensRepo) Attempt(ctx context.Context, kind models.UserTokenKind, tokenHash string, maxAttempts int) (int, error) {
+	var userId int
+	query := fmt.Sprintf(`UPDATE %s SET attempts=attempts+1
+		WHERE kind=$1 AND token_hash=$2 AND used_at IS NULL AND expires_at > now() AND attempts < $3 RETURNING user_id;`, usersTokensTable)
+	err := r.db.QueryRowxContext(ctx, query, kind, tokenHash, maxAttempts).Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, models.ErrInvalidToken
+	}
+
+	return userId, err
+}
+
+// GetUserId returns user id of unused and not expired token
+func (r *UsersTokensRepo) GetUserId(ctx context.Context, kind models.UserTokenKind, tokenHash string) (int, error) {
+	var userId int
+	query := fmt.Sprintf("SELECT user_id FROM %s WHERE kind=$1 AND token_hash=$2 AND used_at IS NULL AND expires_at > now();", usersTokensTable)
+	err := r.db.QueryRowxContext(ctx, query, kind, tokenHash).Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, models.ErrInvalidToken
+	}
+
+	return userId, err
+}
+
+// Consume marks unused and not expired token as used and returns it
+func (r *UsersTokensRepo) Consume(ctx context.Context, kind models.UserTokenKind, tokenHash string) (models.UserToken, error) {
+	var token models.UserToken
+	query := fmt.Sprintf(`UPDATE %s SET used_at=now()
+		WHERE kind=$1 AND token_hash=$2 AND used_at IS NULL AND expires_at > now()
+		RETURNING id, user_id, kind, token_hash, email, expires_at, used_at, attempts, created_at;`, usersTokensTable)
+	err := r.db.GetContext(ctx, &token, query, kind, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.UserToken{}, models.ErrInvalidToken
+	}
+
+	return token, err
+}
+
+// DeleteUnused removes unused tokens of kind sent to user
+func (r *UsersTokensRepo) DeleteUnused(ctx context.Context, userId int, kind models.UserTokenKind) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE user_id=$1 AND kind=$2 AND used_at IS NULL;", usersTokensTable)
+	_, err := r.db.ExecContext(ctx, query, userId, kind)
+
+	return err
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"shop_backend/internal/models"
+)
+
+const variantColumns = "V.id, V.item_id, V.sku, V.price, V.stock"
+
+// GetVariantsByItems returns variants of items with options and images grouped by item id
+func (r *ItemsRepo) GetVariantsByItems(itemsId []int) (map[int][]models.Variant, error) {
+	query := fmt.Sprintf(`SELECT %s, COALESCE((SELECT json_object_agg(O.name, O.value) FROM %s AS O WHERE O.variant_id=V.id), '{}')
+		FROM %s AS V WHERE V.item_id=ANY($1) ORDER BY V.id;`, variantColumns, variantsOptionsTable, itemsVariantsTable)
+	rows, err := r.db.Query(query, pq.Array(itemsId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []models.Variant
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	grouped := make(map[int][]models.Variant)
+	if len(variants) == 0 {
+		return grouped, nil
+	}
+
+	images, err := r.getVariantsImages(itemsId)
+	if err != nil {
+		return nil, err
+	}
+	for _, variant := range variants {
+		variant.Images = images[variant.Id]
+		grouped[variant.ItemId] = append(grouped[variant.ItemId], variant)
+	}
+
+	return grouped, nil
+}
+
+func (r *ItemsRepo) GetVariantBySku(sku string) (models.Variant, error) {
+	query := fmt.Sprintf(`SELECT %s, COALESCE((SELECT json_object_agg(O.name, O.value) FROM %s AS O WHERE O.variant_id=V.id), '{}')
+		FROM %s AS V WHERE V.sku=$1;`, variantColumns, variantsOptionsTable, itemsVariantsTable)
+	variant, err := scanVariant(r.db.QueryRow(query, sku))
+	if err != nil {
+		return models.Variant{}, err
+	}
+
+	images, err := r.getVariantsImages([]int{variant.ItemId})
+	if err != nil {
+		return models.Variant{}, err
+	}
+	variant.Images = images[variant.Id]
+
+	return variant, nil
+}
+
+// SaveVariants replaces item variants with provided ones. Variants are matched
+// by sku, so stock of kept variants is not lost when it is not provided
+func (r *ItemsRepo) SaveVariants(itemId int, variants []models.Variant) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	skus := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		skus = append(skus, variant.Sku)
+	}
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE item_id=$1 AND NOT (sku = ANY($2));", itemsVariantsTable)
+	if _, err := tx.Exec(deleteQuery, itemId, pq.Array(skus)); err != nil {
+		return err
+	}
+
+	upsertQuery := fmt.Sprintf(`INSERT INTO %s AS V (item_id,sku,price,stock) VALUES ($1,$2,$3,COALESCE($4,0))
+		ON CONFLICT (sku) DO UPDATE SET price=EXCLUDED.price, stock=COALESCE($4,V.stock) WHERE V.item_id=EXCLUDED.item_id
+		RETURNING id;`, itemsVariantsTable)
+	deleteOptionsQuery := fmt.Sprintf("DELETE FROM %s WHERE variant_id=$1;", variantsOptionsTable)
+	optionQuery := fmt.Sprintf("INSERT INTO %s (variant_id,name,value) VALUES ($1,$2,$3);", variantsOptionsTable)
+	deleteImagesQuery := fmt.Sprintf("DELETE FROM %s WHERE variant_id=$1;", variantsImagesTable)
+	imageQuery := fmt.Sprintf("INSERT INTO %s (variant_id,image_id) VALUES ($1,$2);", variantsImagesTable)
+	for _, variant := range variants {
+		var variantId int
+		if err := tx.QueryRow(upsertQuery, itemId, variant.Sku, variant.Price, variant.Stock).Scan(&variantId); err != nil {
+			// Conflicting sku belongs to another item
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.ErrSkuTaken
+			}
+			return err
+		}
+
+		if _, err := tx.Exec(deleteOptionsQuery, variantId); err != nil {
+			return err
+		}
+		for name, value := range variant.Options {
+			if _, err := tx.Exec(optionQuery, variantId, name, value); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(deleteImagesQuery, variantId); err != nil {
+			return err
+		}
+		for _, image := range variant.Images {
+			if _, err := tx.Exec(imageQuery, variantId, image.Id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// getVariantsImages returns images of all variants of items grouped by variant id
+func (r *ItemsRepo) getVariantsImages(itemsId []int) (map[int][]models.Image, error) {
+	query := fmt.Sprintf(`SELECT VI.variant_id, I.id, I.filename, I.created_at FROM %s AS VI, %s AS I, %s AS V
+		WHERE V.item_id=ANY($1) AND VI.variant_id=V.id AND I.id=VI.image_id ORDER BY VI.id;`, variantsImagesTable, imagesTable, itemsVariantsTable)
+	rows, err := r.db.Query(query, pq.Array(itemsId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make(map[int][]models.Image)
+	for rows.Next() {
+		var (
+			variantId int
+			image     models.Image
+		)
+		if err := rows.Scan(&variantId, &image.Id, &image.Filename, &image.CreatedAt); err != nil {
+			return nil, err
+		}
+		images[variantId] = append(images[variantId], image)
+	}
+
+	return images, rows.Err()
+}
+
+func scanVariant(row rowScanner) (models.Variant, error) {
+	var (
+		variant models.Variant
+		options []byte
+	)
+	if err := row.Scan(&variant.Id, &variant.ItemId, &variant.Sku, &variant.Price, &variant.Stock, &options); err != nil {
+		return models.Variant{}, err
+	}
+
+	if err := json.Unmarshal(options, &variant.Options); err != nil {
+		return models.Variant{}, err
+	}
+
+	return variant, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"sync"
+	"time"
+)
+
+type activeSession struct {
+	exists   bool
+	cachedAt time.Time
+}
+
+// ActiveSessions checks that session of access token still exists, so ending
+// session revokes only its own access token. Like TokenVersions, results are
+// cached in memory for ttl, session ended by another instance of the
+// application stops working after ttl at most, session ended through Revoke
+// stops working immediately
+type ActiveSessions struct {
+	repo repository.Sessions
+	ttl  time.Duration
+
+	mu       sync.RWMutex
+	sessions map[int]activeSession
+	sweptAt  time.Time
+}
+
+func NewActiveSessions(repo repository.Sessions, ttl time.Duration) *ActiveSessions {
+	return &ActiveSessions{
+		repo:     repo,
+		ttl:      ttl,
+		sessions: make(map[int]activeSession),
+	}
+}
+
+// Check returns models.ErrTokenRevoked if session does not exist anymore
+func (s *ActiveSessions) Check(ctx context.Context, sessionId int) error {
+	s.mu.RLock()
+	cached, ok := s.sessions[sessionId]
+	s.mu.RUnlock()
+
+	if !ok || time.Since(cached.cachedAt) >= s.ttl {
+		exists, err := s.repo.Exists(ctx, sessionId)
+		if err != nil {
+			return err
+		}
+		s.set(exists, sessionId)
+		cached.exists = exists
+	}
+
+	if !cached.exists {
+		return models.ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// Revoke marks deleted sessions as ended, so their access tokens are rejected
+// without waiting for cache to expire
+func (s *ActiveSessions) Revoke(sessionsIds ...int) {
+	s.set(false, sessionsIds...)
+}
+
+func (s *ActiveSessions) set(exists bool, sessionsIds ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Expired entries are dropped once per ttl, so map does not grow with every session ever seen
+	if time.Since(s.sweptAt) >= s.ttl {
+		for id, cached := range s.sessions {
+			if time.Since(cached.cachedAt) >= s.ttl {
+				delete(s.sessions, id)
+			}
+		}
+		s.sweptAt = time.Now()
+	}
+	for _, sessionId := range sessionsIds {
+		s.sessions[sessionId] = activeSession{exists: exists, cachedAt: time.Now()}
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"shop_backend/pkg/auth"
+	"testing"
+	"time"
+)
+
+type fakeSessionsRepo struct {
+	repository.Sessions
+	sessions map[int]models.Session
+}
+
+func (r *fakeSessionsRepo) Exists(_ context.Context, sessionId int) (bool, error) {
+	_, ok := r.sessions[sessionId]
+	return ok, nil
+}
+
+func (r *fakeSessionsRepo) Delete(_ context.Context, userId, sessionId int) error {
+	session, ok := r.sessions[sessionId]
+	if !ok || session.UserId != userId {
+		return models.ErrSessionNotFound
+	}
+	delete(r.sessions, sessionId)
+
+	return nil
+}
+
+func (r *fakeSessionsRepo) DeleteOthers(_ context.Context, userId, currentId int) ([]int, error) {
+	var ids []int
+	for id, session := range r.sessions {
+		if session.UserId == userId && id != currentId {
+			delete(r.sessions, id)
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// fakeTokenVersionsRepo keeps every user at token version zero
+type fakeTokenVersionsRepo struct {
+	repository.Users
+}
+
+func (r *fakeTokenVersionsRepo) GetTokenVersion(_ context.Context, _ int) (int, error) {
+	return 0, nil
+}
+
+func TestRevokeSessions(t *testing.T) {
+	tests := []struct {
+		name    string
+		revoke  func(s *UsersService) error
+		revoked []int
+	}{
+		{name: "logout", revoke: func(s *UsersService) error {
+			return s.Logout(context.Background(), 1, 1)
+		}, revoked: []int{1}},
+		{name: "revoke session", revoke: func(s *UsersService) error {
+			return s.RevokeSession(context.Background(), 1, 2)
+		}, revoked: []int{2}},
+		{name: "revoke other sessions", revoke: func(s *UsersService) error {
+			return s.RevokeOtherSessions(context.Background(), 1, 1)
+		}, revoked: []int{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Sessions 1-3 belong to user 1 on different devices, session 4 to user 2
+			repo := &fakeSessionsRepo{sessions: map[int]models.Session{
+				1: {Id: 1, UserId: 1}, 2: {Id: 2, UserId: 1}, 3: {Id: 3, UserId: 1}, 4: {Id: 4, UserId: 2},
+			}}
+			service := &UsersService{
+				sessionsRepo: repo,
+				versions:     NewTokenVersions(&fakeTokenVersionsRepo{}, time.Minute),
+				sessions:     NewActiveSessions(repo, time.Minute),
+			}
+
+			// Sessions are cached as active before revocation
+			for _, session := range repo.sessions {
+				if err := service.CheckToken(context.Background(), auth.Claims{UserId: session.UserId, SessionId: session.Id}); err != nil {
+					t.Fatalf("session %d: %v", session.Id, err)
+				}
+			}
+
+			if err := tt.revoke(service); err != nil {
+				t.Fatal(err)
+			}
+
+			revoked := make(map[int]bool)
+			for _, id := range tt.revoked {
+				revoked[id] = true
+			}
+			for id, userId := range map[int]int{1: 1, 2: 1, 3: 1, 4: 2} {
+				err := service.CheckToken(context.Background(), auth.Claims{UserId: userId, SessionId: id})
+				if revoked[id] && !errors.Is(err, models.ErrTokenRevoked) {
+					t.Fatalf("session %d: error = %v, want %v", id, err, models.ErrTokenRevoked)
+				} else if !revoked[id] && err != nil {
+					t.Fatalf("session %d: error = %v, want access token to keep working", id, err)
+				}
+			}
+		})
+	}
+}
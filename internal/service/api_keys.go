@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"shop_backend/pkg/auth"
+	"shop_backend/pkg/logger"
+	"strings"
+)
+
+// apiKeyPrefixLength is number of characters of key shown to tell keys apart
+const apiKeyPrefixLength = len(models.ApiKeyPrefix) + 8
+
+type ApiKeysService struct {
+	repo  repository.ApiKeys
+	roles *RolesService
+}
+
+func NewApiKeysService(repo repository.ApiKeys, roles *RolesService) *ApiKeysService {
+	return &ApiKeysService{repo: repo, roles: roles}
+}
+
+// Create stores new key with scopes and returns it together with the key
+// itself. Key cannot grant more than its creator has
+func (s *ApiKeysService) Create(ctx context.Context, claims auth.Claims, key models.ApiKey) (models.NewApiKey, error) {
+	if err := validateScopes(key.Scopes); err != nil {
+		return models.NewApiKey{}, err
+	}
+	if err := s.roles.authorizeAll(ctx, claims, key.Scopes); err != nil {
+		return models.NewApiKey{}, err
+	}
+
+	secret, err := newApiKey()
+	if err != nil {
+		return models.NewApiKey{}, err
+	}
+	key.Prefix = secret[:apiKeyPrefixLength]
+	key.KeyHash = auth.HashToken(secret)
+
+	keyId, err := s.repo.Create(ctx, key)
+	if err != nil {
+		return models.NewApiKey{}, err
+	}
+
+	created, err := s.repo.GetById(ctx, keyId)
+	if err != nil {
+		return models.NewApiKey{}, err
+	}
+
+	return models.NewApiKey{ApiKey: created, Key: secret}, nil
+}
+
+func (s *ApiKeysService) GetAll(ctx context.Context) ([]models.ApiKey, error) {
+	return s.repo.GetAll(ctx)
+}
+
+func (s *ApiKeysService) GetById(ctx context.Context, keyId int) (models.ApiKey, error) {
+	return s.repo.GetById(ctx, keyId)
+}
+
+// Rotate replaces key keeping its name and scopes, the old key stops working
+// at once. Only users having all scopes of key can get its new secret
+func (s *ApiKeysService) Rotate(ctx context.Context, claims auth.Claims, keyId int) (models.NewApiKey, error) {
+	if err := s.authorizeKey(ctx, claims, keyId); err != nil {
+		return models.NewApiKey{}, err
+	}
+
+	secret, err := newApiKey()
+	if err != nil {
+		return models.NewApiKey{}, err
+	}
+
+	if err := s.repo.Rotate(ctx, keyId, secret[:apiKeyPrefixLength], auth.HashToken(secret)); err != nil {
+		return models.NewApiKey{}, err
+	}
+
+	rotated, err := s.repo.GetById(ctx, keyId)
+	if err != nil {
+		return models.NewApiKey{}, err
+	}
+
+	return models.NewApiKey{ApiKey: rotated, Key: secret}, nil
+}
+
+// Revoke revokes key, only users having all its scopes can do it
+func (s *ApiKeysService) Revoke(ctx context.Context, claims auth.Claims, keyId int) error {
+	if err := s.authorizeKey(ctx, claims, keyId); err != nil {
+		return err
+	}
+
+	return s.repo.Revoke(ctx, keyId)
+}
+
+// authorizeKey checks that claims grant every scope of key
+func (s *ApiKeysService) authorizeKey(ctx context.Context, claims auth.Claims, keyId int) error {
+	key, err := s.repo.GetById(ctx, keyId)
+	if err != nil {
+		return err
+	}
+
+	return s.roles.authorizeAll(ctx, claims, key.Scopes)
+}
+
+// Authenticate returns active key and records its use. Failed record must
+// not break request, so error is only logged
+func (s *ApiKeysService) Authenticate(ctx context.Context, key, ip string) (models.ApiKey, error) {
+	if !strings.HasPrefix(key, models.ApiKeyPrefix) {
+		return models.ApiKey{}, models.ErrInvalidApiKey
+	}
+
+	apiKey, err := s.repo.GetActive(ctx, auth.HashToken(key))
+	if err != nil {
+		return models.ApiKey{}, err
+	}
+
+	if err := s.repo.Touch(ctx, apiKey.Id, ip); err != nil {
+		logger.Errorf("failed to record use of api key %d: %s", apiKey.Id, err.Error())
+	}
+
+	return apiKey, nil
+}
+
+func newApiKey() (string, error) {
+	token, err := auth.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	return models.ApiKeyPrefix + token, nil
+}
+
+func validateScopes(scopes []models.Permission) error {
+	if len(scopes) == 0 {
+		return models.ErrWrongScope
+	}
+
+	for _, scope := range scopes {
+		if !scope.IsApiKeyScope() {
+			return models.ErrWrongScope
+		}
+	}
+
+	return nil
+}
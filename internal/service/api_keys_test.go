@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"shop_backend/pkg/auth"
+	"testing"
+	"time"
+)
+
+type fakeRolesRepo struct {
+	repository.Roles
+	roles []models.Role
+}
+
+func (r *fakeRolesRepo) GetAll(_ context.Context) ([]models.Role, error) {
+	return r.roles, nil
+}
+
+type fakeApiKeysRepo struct {
+	repository.ApiKeys
+	keys    map[int]models.ApiKey
+	created []models.ApiKey
+	rotated []int
+	revoked []int
+}
+
+func (r *fakeApiKeysRepo) Create(_ context.Context, key models.ApiKey) (int, error) {
+	r.created = append(r.created, key)
+	key.Id = 100 + len(r.created)
+	r.keys[key.Id] = key
+
+	return key.Id, nil
+}
+
+func (r *fakeApiKeysRepo) GetById(_ context.Context, keyId int) (models.ApiKey, error) {
+	key, ok := r.keys[keyId]
+	if !ok {
+		return models.ApiKey{}, models.ErrApiKeyNotFound
+	}
+
+	return key, nil
+}
+
+func (r *fakeApiKeysRepo) Rotate(_ context.Context, keyId int, _, _ string) error {
+	r.rotated = append(r.rotated, keyId)
+	return nil
+}
+
+func (r *fakeApiKeysRepo) Revoke(_ context.Context, keyId int) error {
+	r.revoked = append(r.revoked, keyId)
+	return nil
+}
+
+func newApiKeysTest() (*ApiKeysService, *fakeApiKeysRepo) {
+	roles := NewRolesService(&fakeRolesRepo{roles: []models.Role{
+		{Name: "admin", Permissions: []models.Permission{models.PermissionAll}},
+		{Name: "support", Permissions: []models.Permission{models.PermissionUsersManage, models.PermissionCatalogWrite}},
+	}}, nil, false, time.Minute)
+	repo := &fakeApiKeysRepo{keys: map[int]models.ApiKey{
+		1: {Id: 1, Scopes: []models.Permission{models.PermissionCatalogWrite}},
+		2: {Id: 2, Scopes: []models.Permission{models.PermissionCatalogWrite, models.PermissionOrdersManage}},
+	}}
+
+	return NewApiKeysService(repo, roles), repo
+}
+
+func TestApiKeysScopes(t *testing.T) {
+	admin := auth.Claims{UserId: 1, Roles: []string{"admin"}}
+	support := auth.Claims{UserId: 2, Roles: []string{"support"}}
+
+	tests := []struct {
+		name   string
+		claims auth.Claims
+		keyId  int
+		err    error
+	}{
+		{name: "superuser manages any key", claims: admin, keyId: 2},
+		{name: "key within caller permissions", claims: support, keyId: 1},
+		{name: "key with scope caller lacks", claims: support, keyId: 2, err: models.ErrForbidden},
+		{name: "unknown key", claims: admin, keyId: 3, err: models.ErrApiKeyNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo := newApiKeysTest()
+
+			_, err := service.Rotate(context.Background(), tt.claims, tt.keyId)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("rotate error = %v, want %v", err, tt.err)
+			}
+			if err := service.Revoke(context.Background(), tt.claims, tt.keyId); !errors.Is(err, tt.err) {
+				t.Fatalf("revoke error = %v, want %v", err, tt.err)
+			}
+
+			if tt.err != nil && (len(repo.rotated) != 0 || len(repo.revoked) != 0) {
+				t.Fatalf("rotated %v, revoked %v, want no changes", repo.rotated, repo.revoked)
+			}
+		})
+	}
+}
+
+func TestApiKeysCreateScopes(t *testing.T) {
+	support := auth.Claims{UserId: 2, Roles: []string{"support"}}
+
+	tests := []struct {
+		name   string
+		scopes []models.Permission
+		err    error
+	}{
+		{name: "held scope", scopes: []models.Permission{models.PermissionCatalogWrite}},
+		{name: "scope caller lacks", scopes: []models.Permission{models.PermissionOrdersManage}, err: models.ErrForbidden},
+		{name: "permission which is not scope", scopes: []models.Permission{models.PermissionUsersManage}, err: models.ErrWrongScope},
+		{name: "no scopes", err: models.ErrWrongScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo := newApiKeysTest()
+
+			_, err := service.Create(context.Background(), support, models.ApiKey{Name: "key", Scopes: tt.scopes})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil && len(repo.created) != 0 {
+				t.Fatalf("created %v, want none", repo.created)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+)
+
+type AuditService struct {
+	repo repository.Audit
+}
+
+func NewAuditService(repo repository.Audit) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record appends entry to audit log with diff of entity states before and after change
+func (s *AuditService) Record(ctx context.Context, entry models.AuditEntry) error {
+	diff, err := auditDiff(entry.Before, entry.After)
+	if err != nil {
+		return err
+	}
+	entry.Diff = diff
+
+	return s.repo.Create(ctx, entry)
+}
+
+func (s *AuditService) GetAll(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	return s.repo.GetAll(ctx, filter)
+}
+
+type auditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// auditDiff compares top level fields of two JSON objects. Missing state of
+// created or deleted entity counts as object without fields, state which is
+// not an object is compared as a whole under "value" key
+func auditDiff(before, after json.RawMessage) (json.RawMessage, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]auditChange)
+	for field, from := range beforeFields {
+		if to := afterFields[field]; !reflect.DeepEqual(from, to) {
+			diff[field] = auditChange{From: from, To: to}
+		}
+	}
+	for field, to := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			diff[field] = auditChange{To: to}
+		}
+	}
+
+	return json.Marshal(diff)
+}
+
+func auditFields(state json.RawMessage) (map[string]interface{}, error) {
+	if len(state) == 0 {
+		return nil, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(state, &value); err != nil {
+		return nil, err
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return value, nil
+	default:
+		return map[string]interface{}{"value": value}, nil
+	}
+}
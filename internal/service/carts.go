@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"shop_backend/pkg/auth"
+)
+
+type CartsService struct {
+	repo          repository.Carts
+	itemsRepo     repository.Items
+	couponsRepo   repository.Coupons
+	tokenManager  auth.TokenManager
+	shippingPrice float64
+}
+
+func NewCartsService(repo repository.Carts, itemsRepo repository.Items, couponsRepo repository.Coupons,
+	tokenManager auth.TokenManager, shippingPrice float64) *CartsService {
+	return &CartsService{
+		repo:          repo,
+		itemsRepo:     itemsRepo,
+		couponsRepo:   couponsRepo,
+		tokenManager:  tokenManager,
+		shippingPrice: shippingPrice,
+	}
+}
+
+// resolve returns cart id and token of owner's cart. Guest cart is created
+// only if create is set, otherwise models.ErrCartNotFound is returned
+func (s *CartsService) resolve(ctx context.Context, owner models.CartOwner, create bool) (int, string, error) {
+	if !owner.IsGuest() {
+		cartId, err := s.repo.GetOrCreate(ctx, owner.UserId)
+		return cartId, "", err
+	}
+
+	if owner.Token != "" {
+		cartId, err := s.repo.GetByToken(ctx, owner.Token)
+		if err == nil {
+			return cartId, owner.Token, nil
+		}
+		if !errors.Is(err, models.ErrCartNotFound) {
+			return 0, "", err
+		}
+	}
+
+	if !create {
+		return 0, "", models.ErrCartNotFound
+	}
+
+	token, err := s.tokenManager.NewCartToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	cartId, err := s.repo.CreateGuest(ctx, token)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return cartId, token, nil
+}
+
+func (s *CartsService) Get(ctx context.Context, owner models.CartOwner) (models.Cart, error) {
+	cartId, token, err := s.resolve(ctx, owner, false)
+	if errors.Is(err, models.ErrCartNotFound) {
+		return models.Cart{Items: []models.CartItem{}}, nil
+	} else if err != nil {
+		return models.Cart{}, err
+	}
+
+	items, err := s.repo.GetItems(ctx, cartId)
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	cart := models.Cart{
+		Id:    cartId,
+		Token: token,
+		Items: items,
+	}
+
+	// Coupon which stopped being valid stays in cart, customer sees why
+	// it is not applied
+	coupon, err := cartCoupon(ctx, s.repo, s.couponsRepo, cartId, owner.UserId)
+	if err == nil {
+		err = priceCart(&cart, coupon, s.shippingPrice)
+	}
+	if err != nil {
+		if !isCouponError(err) {
+			return models.Cart{}, err
+		}
+		cart.CouponError = err.Error()
+		if err := priceCart(&cart, nil, s.shippingPrice); err != nil {
+			return models.Cart{}, err
+		}
+	}
+
+	return cart, nil
+}
+
+// ApplyCoupon attaches coupon to owner's cart if it can be used with current cart items
+func (s *CartsService) ApplyCoupon(ctx context.Context, owner models.CartOwner, code string) error {
+	cartId, _, err := s.resolve(ctx, owner, false)
+	if errors.Is(err, models.ErrCartNotFound) {
+		return models.ErrEmptyCart
+	} else if err != nil {
+		return err
+	}
+
+	coupon, err := s.couponsRepo.GetByCode(ctx, models.NormalizeCouponCode(code))
+	if err != nil {
+		return err
+	}
+	if err := checkCoupon(ctx, s.couponsRepo, coupon, owner.UserId); err != nil {
+		return err
+	}
+
+	items, err := s.repo.GetItems(ctx, cartId)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return models.ErrEmptyCart
+	}
+	if err := priceCart(&models.Cart{Items: items}, &coupon, s.shippingPrice); err != nil {
+		return err
+	}
+
+	return s.repo.SetCoupon(ctx, cartId, &coupon.Id)
+}
+
+func (s *CartsService) RemoveCoupon(ctx context.Context, owner models.CartOwner) error {
+	cartId, _, err := s.resolve(ctx, owner, false)
+	if errors.Is(err, models.ErrCartNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return s.repo.SetCoupon(ctx, cartId, nil)
+}
+
+// AddItem adds item to owner's cart creating guest cart if needed. Variant is
+// optional, when set its price and stock apply to the line.
+// Returns token of guest cart, empty for user carts
+func (s *CartsService) AddItem(ctx context.Context, owner models.CartOwner, itemId, colorId int, variantId *int, quantity int) (string, error) {
+	if quantity < 1 || quantity > models.MaxCartItemQuantity {
+		return "", models.ErrWrongQuantity
+	}
+
+	available, err := s.itemsRepo.HasColor(itemId, colorId)
+	if err != nil {
+		return "", err
+	}
+	if !available {
+		return "", models.ErrItemColorNotFound
+	}
+
+	if variantId != nil {
+		available, err := s.itemsRepo.HasVariant(itemId, *variantId)
+		if err != nil {
+			return "", err
+		}
+		if !available {
+			return "", models.ErrItemVariantNotFound
+		}
+	}
+
+	cartId, token, err := s.resolve(ctx, owner, true)
+	if err != nil {
+		return "", err
+	}
+
+	return token, s.repo.AddItem(ctx, cartId, itemId, colorId, variantId, quantity)
+}
+
+func (s *CartsService) UpdateQuantity(ctx context.Context, owner models.CartOwner, lineId, quantity int) error {
+	if quantity < 1 || quantity > models.MaxCartItemQuantity {
+		return models.ErrWrongQuantity
+	}
+
+	cartId, _, err := s.resolve(ctx, owner, false)
+	if errors.Is(err, models.ErrCartNotFound) {
+		return models.ErrCartItemNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return s.repo.UpdateQuantity(ctx, cartId, lineId, quantity)
+}
+
+func (s *CartsService) DeleteItem(ctx context.Context, owner models.CartOwner, lineId int) error {
+	cartId, _, err := s.resolve(ctx, owner, false)
+	if errors.Is(err, models.ErrCartNotFound) {
+		return models.ErrCartItemNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return s.repo.DeleteItem(ctx, cartId, lineId)
+}
+
+func (s *CartsService) Clear(ctx context.Context, owner models.CartOwner) error {
+	cartId, _, err := s.resolve(ctx, owner, false)
+	if errors.Is(err, models.ErrCartNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return s.repo.Clear(ctx, cartId)
+}
+
+// isCouponError reports whether err explains why coupon cannot be used
+func isCouponError(err error) bool {
+	return errors.Is(err, models.ErrCouponNotFound) || errors.Is(err, models.ErrCouponInactive) ||
+		errors.Is(err, models.ErrCouponExhausted) || errors.Is(err, models.ErrCouponMinTotal) ||
+		errors.Is(err, models.ErrCouponNotEligible)
+}
+
+// roundPrice rounds price to cents
+func roundPrice(price float64) float64 {
+	return math.Round(price*100) / 100
+}
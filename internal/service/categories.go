@@ -3,6 +3,7 @@ package service
 import (
 	"shop_backend/internal/models"
 	"shop_backend/internal/repository"
+	"strings"
 )
 
 type CategoriesService struct {
@@ -13,9 +14,19 @@ func NewCategoriesService(repo repository.Categories) *CategoriesService {
 	return &CategoriesService{repo: repo}
 }
 
-func (s *CategoriesService) Create(name string) (int, error) {
+// Create adds category under parent, root category is created for nil parent.
+// Slug is made from name if it is empty
+func (s *CategoriesService) Create(name, slug string, parentId *int, position int) (int, error) {
+	slug, err := makeSlug(slug, name)
+	if err != nil {
+		return 0, err
+	}
+
 	category := models.Category{
-		Name: name,
+		Name:     name,
+		ParentId: parentId,
+		Slug:     slug,
+		Position: position,
 	}
 	id, err := s.repo.Create(category)
 	if err != nil {
@@ -29,23 +40,111 @@ func (s *CategoriesService) Exist(categoryId int) (bool, error) {
 	return s.repo.Exist(categoryId)
 }
 
-func (s *CategoriesService) Delete(categoryId int) error {
-	return s.repo.Delete(categoryId)
+// Delete removes category, its children move one level up and its items
+// move to moveTo or to the parent category
+func (s *CategoriesService) Delete(categoryId int, moveTo *int) error {
+	return s.repo.Delete(categoryId, moveTo)
 }
 
 func (s *CategoriesService) GetAll() ([]models.Category, error) {
 	return s.repo.GetAll()
 }
 
+// GetTree returns root categories with nested children ordered by position
+func (s *CategoriesService) GetTree() ([]models.Category, error) {
+	categories, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]models.Category)
+	for _, category := range categories {
+		parentId := 0
+		if category.ParentId != nil {
+			parentId = *category.ParentId
+		}
+		children[parentId] = append(children[parentId], category)
+	}
+
+	return buildTree(children, 0), nil
+}
+
+func buildTree(children map[int][]models.Category, parentId int) []models.Category {
+	level := children[parentId]
+	for i := range level {
+		level[i].Children = buildTree(children, level[i].Id)
+	}
+
+	return level
+}
+
+// GetById returns category with breadcrumbs from the root and direct children
 func (s *CategoriesService) GetById(categoryId int) (models.Category, error) {
-	return s.repo.GetById(categoryId)
+	category, err := s.repo.GetById(categoryId)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	category.Breadcrumbs, err = s.repo.GetPath(categoryId)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	category.Children, err = s.repo.GetChildren(categoryId)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	return category, nil
 }
 
-func (s *CategoriesService) Update(categoryId int, name string) error {
+func (s *CategoriesService) Update(categoryId int, name, slug string) error {
+	slug, err := makeSlug(slug, name)
+	if err != nil {
+		return err
+	}
+
 	category := models.Category{
 		Id:   categoryId,
 		Name: name,
+		Slug: slug,
 	}
 
 	return s.repo.Update(category)
 }
+
+// Move attaches category with its subtree to another parent, nil parent makes it root
+func (s *CategoriesService) Move(categoryId int, parentId *int, position int) error {
+	if parentId != nil && *parentId == categoryId {
+		return models.ErrCategoryCycle
+	}
+
+	return s.repo.Move(categoryId, parentId, position)
+}
+
+// makeSlug normalizes slug or builds it from name if slug is empty
+func makeSlug(slug, name string) (string, error) {
+	if slug == "" {
+		slug = name
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(slug) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	if b.Len() == 0 {
+		return "", models.ErrWrongSlug
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"time"
+)
+
+type CouponsService struct {
+	repo repository.Coupons
+}
+
+func NewCouponsService(repo repository.Coupons) *CouponsService {
+	return &CouponsService{repo: repo}
+}
+
+func (s *CouponsService) Create(ctx context.Context, coupon models.Coupon) (int, error) {
+	if err := prepareCoupon(&coupon); err != nil {
+		return 0, err
+	}
+
+	return s.repo.Create(ctx, coupon)
+}
+
+func (s *CouponsService) Update(ctx context.Context, coupon models.Coupon) error {
+	if err := prepareCoupon(&coupon); err != nil {
+		return err
+	}
+
+	return s.repo.Update(ctx, coupon)
+}
+
+func (s *CouponsService) Delete(ctx context.Context, couponId int) error {
+	return s.repo.Delete(ctx, couponId)
+}
+
+func (s *CouponsService) GetById(ctx context.Context, couponId int) (models.Coupon, error) {
+	return s.repo.GetById(ctx, couponId)
+}
+
+func (s *CouponsService) GetAll(ctx context.Context) ([]models.Coupon, error) {
+	return s.repo.GetAll(ctx)
+}
+
+// prepareCoupon normalizes code and checks that coupon terms make sense
+func prepareCoupon(coupon *models.Coupon) error {
+	coupon.Code = models.NormalizeCouponCode(coupon.Code)
+	if coupon.Code == "" {
+		return models.ErrCouponTerms
+	}
+
+	switch coupon.Kind {
+	case models.CouponKindPercent:
+		if coupon.Value <= 0 || coupon.Value > 100 {
+			return models.ErrCouponTerms
+		}
+	case models.CouponKindFixed:
+		if coupon.Value <= 0 {
+			return models.ErrCouponTerms
+		}
+	case models.CouponKindFreeShipping:
+		coupon.Value = 0
+	default:
+		return models.ErrCouponKind
+	}
+
+	if coupon.MinTotal < 0 {
+		return models.ErrCouponTerms
+	}
+	if coupon.StartsAt != nil && coupon.ExpiresAt != nil && !coupon.StartsAt.Before(*coupon.ExpiresAt) {
+		return models.ErrCouponTerms
+	}
+	if (coupon.UsageLimit != nil && *coupon.UsageLimit < 1) || (coupon.PerUserLimit != nil && *coupon.PerUserLimit < 1) {
+		return models.ErrCouponTerms
+	}
+
+	return nil
+}
+
+// checkCoupon verifies validity window and usage limits of coupon,
+// per user limit is checked only for authenticated users
+func checkCoupon(ctx context.Context, repo repository.Coupons, coupon models.Coupon, userId int) error {
+	if !coupon.IsActive(time.Now()) {
+		return models.ErrCouponInactive
+	}
+
+	if coupon.UsageLimit != nil && coupon.Used >= *coupon.UsageLimit {
+		return models.ErrCouponExhausted
+	}
+
+	if coupon.PerUserLimit != nil && userId != 0 {
+		count, err := repo.CountRedemptions(ctx, coupon.Id, userId)
+		if err != nil {
+			return err
+		}
+		if count >= *coupon.PerUserLimit {
+			return models.ErrCouponExhausted
+		}
+	}
+
+	return nil
+}
+
+// priceCart computes line totals, subtotal, shipping and total of cart.
+// Coupon discount is spread over eligible lines, if coupon cannot be applied
+// cart is priced without it and the reason is returned
+func priceCart(cart *models.Cart, coupon *models.Coupon, shippingPrice float64) error {
+	cart.Subtotal, cart.Discount, cart.Shipping = 0, 0, 0
+	for i := range cart.Items {
+		line := &cart.Items[i]
+		line.Total = roundPrice((line.Price + line.Color.Price) * float64(line.Quantity))
+		line.Discount = 0
+		cart.Subtotal += line.Total
+	}
+	cart.Subtotal = roundPrice(cart.Subtotal)
+	if len(cart.Items) > 0 {
+		cart.Shipping = shippingPrice
+	}
+	cart.Total = roundPrice(cart.Subtotal + cart.Shipping)
+
+	if coupon == nil {
+		return nil
+	}
+
+	if cart.Subtotal < coupon.MinTotal {
+		return models.ErrCouponMinTotal
+	}
+
+	var (
+		eligible      []int
+		eligibleTotal float64
+	)
+	for i, line := range cart.Items {
+		if coupon.AppliesTo(line.CategoryId, line.Tags) {
+			eligible = append(eligible, i)
+			eligibleTotal += line.Total
+		}
+	}
+	if len(eligible) == 0 {
+		return models.ErrCouponNotEligible
+	}
+
+	switch coupon.Kind {
+	case models.CouponKindPercent:
+		for _, i := range eligible {
+			line := &cart.Items[i]
+			line.Discount = roundPrice(line.Total * coupon.Value / 100)
+			cart.Discount += line.Discount
+		}
+	case models.CouponKindFixed:
+		// Amount is split in proportion to line totals, the last line takes
+		// the rounding remainder so discounts sum up exactly
+		amount := roundPrice(coupon.Value)
+		if amount > eligibleTotal {
+			amount = roundPrice(eligibleTotal)
+		}
+		rest := amount
+		for n, i := range eligible {
+			line := &cart.Items[i]
+			if n == len(eligible)-1 {
+				line.Discount = roundPrice(rest)
+			} else {
+				line.Discount = roundPrice(amount * line.Total / eligibleTotal)
+				rest -= line.Discount
+			}
+			cart.Discount += line.Discount
+		}
+	case models.CouponKindFreeShipping:
+		cart.Shipping = 0
+	}
+
+	cart.Discount = roundPrice(cart.Discount)
+	cart.Total = roundPrice(cart.Subtotal - cart.Discount + cart.Shipping)
+	cart.Coupon = &models.AppliedCoupon{
+		Code:  coupon.Code,
+		Kind:  coupon.Kind,
+		Value: coupon.Value,
+	}
+
+	return nil
+}
+
+// cartCoupon returns coupon applied to cart or nil if there is no one.
+// Coupon is returned together with the reason if it cannot be used anymore
+func cartCoupon(ctx context.Context, cartsRepo repository.Carts, couponsRepo repository.Coupons, cartId, userId int) (*models.Coupon, error) {
+	couponId, err := cartsRepo.GetCouponId(ctx, cartId)
+	if err != nil || couponId == nil {
+		return nil, err
+	}
+
+	coupon, err := couponsRepo.GetById(ctx, *couponId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &coupon, checkCoupon(ctx, couponsRepo, coupon, userId)
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shop_backend/internal/models"
+	"shop_backend/pkg/auth"
+	"shop_backend/pkg/mailer"
+	"time"
+)
+
+const verificationBody = `Hello %s,
+
+please confirm %s is your email address by following the link below,
+it is valid for %s:
+
+%s
+
+If you did not use this address in our shop, ignore this email.
+`
+
+// UpdateEmail stores email as pending and sends verification to it. Current
+// email stays in use until the new one is confirmed
+func (s *UsersService) UpdateEmail(ctx context.Context, userId int, email string) error {
+	user, err := s.repo.GetById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	// Changing back to current email cancels pending change and links sent to it
+	if email == user.Email {
+		if err := s.repo.UpdateField(ctx, "pending_email", nil, userId); err != nil {
+			return err
+		}
+		return s.usersTokensRepo.DeleteUnused(ctx, userId, models.UserTokenEmailVerification)
+	}
+
+	if _, err := s.repo.GetByLogin(ctx, "email", email); err == nil {
+		return models.NewErrUniqueValue("email")
+	} else if !errors.Is(err, models.ErrUserNotFound) {
+		return err
+	}
+
+	if err := s.repo.UpdateField(ctx, "pending_email", email, userId); err != nil {
+		return err
+	}
+
+	return s.sendVerification(ctx, userId, user.Login, email)
+}
+
+// ConfirmEmail verifies address token was sent to, if it is still pending or
+// unverified email of token owner. Pending email replaces current one
+func (s *UsersService) ConfirmEmail(ctx context.Context, token string) error {
+	verification, err := s.usersTokensRepo.Consume(ctx, models.UserTokenEmailVerification, auth.HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	return s.repo.ConfirmEmail(ctx, verification.UserId, verification.Email)
+}
+
+// ResendVerification sends new verification link to pending or unverified email
+func (s *UsersService) ResendVerification(ctx context.Context, userId int) error {
+	user, err := s.repo.GetById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case user.PendingEmail != nil:
+		return s.sendVerification(ctx, userId, user.Login, *user.PendingEmail)
+	case !user.EmailVerified:
+		return s.sendVerification(ctx, userId, user.Login, user.Email)
+	default:
+		return models.ErrEmailVerified
+	}
+}
+
+// sendVerification emails confirmation link for address. Previously sent
+// links stop working
+func (s *UsersService) sendVerification(ctx context.Context, userId int, login, address string) error {
+	token, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.usersTokensRepo.Create(ctx, models.UserToken{
+		UserId:    userId,
+		Kind:      models.UserTokenEmailVerification,
+		TokenHash: auth.HashToken(token),
+		Email:     address,
+		ExpiresAt: time.Now().Add(s.verificationTTL),
+	}); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      address,
+		Subject: "Confirm your email",
+		Body:    fmt.Sprintf(verificationBody, login, address, s.verificationTTL, s.link("/email/confirm", token)),
+	})
+}
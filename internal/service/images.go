@@ -81,6 +81,10 @@ func (s *ImagesService) GetAll() ([]models.Image, error) {
 	return s.repo.GetAll()
 }
 
+func (s *ImagesService) GetById(imageId int) (models.Image, error) {
+	return s.repo.GetById(imageId)
+}
+
 func (s *ImagesService) Exist(imageId int) (bool, error) {
 	return s.repo.Exist(imageId)
 }
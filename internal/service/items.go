@@ -1,9 +1,12 @@
 package service
 
 import (
-	"fmt"
+	"database/sql"
+	"errors"
 	"shop_backend/internal/models"
 	"shop_backend/internal/repository"
+	"sort"
+	"strings"
 )
 
 type ItemsService struct {
@@ -55,183 +58,133 @@ func (s *ItemsService) LinkTags(itemId int, tags []string) error {
 }
 
 func (s *ItemsService) GetNew() ([]models.Item, error) {
-	var items []models.Item
 	ids, err := s.repo.GetNew(4)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, id := range ids {
-		item, err := s.repo.GetById(id)
-		if err != nil {
-			return nil, err
-		}
-
-		colors, err := s.repo.GetColors(item.Id)
-		if err != nil {
-			return nil, err
-		}
-		item.Colors = colors
-
-		tags, err := s.repo.GetTags(item.Id)
-		if err != nil {
-			return nil, err
-		}
-		item.Tags = tags
-
-		images, err := s.repo.GetImages(item.Id)
-		if err != nil {
-			return nil, err
-		}
-		for i := range images {
-			images[i].Filename = "/files/" + images[i].Filename
-		}
-		item.Images = images
-
-		items = append(items, item)
-	}
-
-	fmt.Println(items)
-
-	return items, nil
+	return s.assemble(ids)
 }
 
 func (s *ItemsService) GetById(itemId int) (models.Item, error) {
-	item, err := s.repo.GetById(itemId)
+	items, err := s.assemble([]int{itemId})
 	if err != nil {
 		return models.Item{}, err
 	}
-
-	colors, err := s.repo.GetColors(item.Id)
-	if err != nil {
-		return models.Item{}, err
+	if len(items) == 0 {
+		return models.Item{}, sql.ErrNoRows
 	}
-	item.Colors = colors
 
-	tags, err := s.repo.GetTags(item.Id)
-	if err != nil {
-		return models.Item{}, err
-	}
-	item.Tags = tags
-
-	images, err := s.repo.GetImages(item.Id)
-	if err != nil {
-		return models.Item{}, err
-	}
-	for i := range images {
-		images[i].Filename = "/files/" + images[i].Filename
-	}
-	item.Images = images
-
-	return item, nil
+	return items[0], nil
 }
 
+// GetBySku resolves sku of item or of one of its variants. For variant sku
+// the parent item is returned with selected variant in item.Variant
 func (s *ItemsService) GetBySku(sku string) (models.Item, error) {
 	item, err := s.repo.GetBySku(sku)
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.getByVariantSku(sku)
+	} else if err != nil {
 		return models.Item{}, err
 	}
 
-	colors, err := s.repo.GetColors(item.Id)
-	if err != nil {
-		return models.Item{}, err
-	}
-	item.Colors = colors
+	return s.GetById(item.Id)
+}
 
-	tags, err := s.repo.GetTags(item.Id)
+func (s *ItemsService) getByVariantSku(sku string) (models.Item, error) {
+	variant, err := s.repo.GetVariantBySku(sku)
 	if err != nil {
 		return models.Item{}, err
 	}
-	item.Tags = tags
 
-	images, err := s.repo.GetImages(item.Id)
+	item, err := s.GetById(variant.ItemId)
 	if err != nil {
 		return models.Item{}, err
 	}
-	for i := range images {
-		images[i].Filename = "/files/" + images[i].Filename
+
+	for i := range item.Variants {
+		if item.Variants[i].Id == variant.Id {
+			item.Variant = &item.Variants[i]
+			break
+		}
 	}
-	item.Images = images
 
 	return item, nil
 }
 
-func (s *ItemsService) GetByCategory(categoryId int) ([]models.Item, error) {
-	var items []models.Item
-	ids, err := s.repo.GetByCategory(categoryId)
+// GetByCategory returns category items, with descendants items of all subcategories are included
+func (s *ItemsService) GetByCategory(categoryId int, descendants bool) ([]models.Item, error) {
+	ids, err := s.repo.GetByCategory(categoryId, descendants)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, id := range ids {
-		item, err := s.repo.GetById(id)
-		if err != nil {
-			return nil, err
-		}
-		colors, err := s.repo.GetColors(item.Id)
-		if err != nil {
-			return nil, err
-		}
-		item.Colors = colors
-
-		tags, err := s.repo.GetTags(item.Id)
-		if err != nil {
-			return nil, err
-		}
-		item.Tags = tags
-
-		images, err := s.repo.GetImages(item.Id)
-		if err != nil {
-			return nil, err
-		}
-		for i := range images {
-			images[i].Filename = "/files/" + images[i].Filename
-		}
-		item.Images = images
-
-		items = append(items, item)
-	}
-
-	return items, err
+	return s.assemble(ids)
 }
 
 func (s *ItemsService) GetByTag(tag string) ([]models.Item, error) {
-	var items []models.Item
 	ids, err := s.repo.GetByTag(tag)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, id := range ids {
-		item, err := s.repo.GetById(id)
-		if err != nil {
-			return nil, err
-		}
-		colors, err := s.repo.GetColors(item.Id)
-		if err != nil {
-			return nil, err
-		}
-		item.Colors = colors
+	return s.assemble(ids)
+}
 
-		tags, err := s.repo.GetTags(item.Id)
-		if err != nil {
-			return nil, err
-		}
-		item.Tags = tags
+// assemble loads items with category, colors, variants, tags and images in a
+// constant number of queries. Items are returned in order of ids, missing ids are skipped
+func (s *ItemsService) assemble(ids []int) ([]models.Item, error) {
+	items := make([]models.Item, 0, len(ids))
+	if len(ids) == 0 {
+		return items, nil
+	}
 
-		images, err := s.repo.GetImages(item.Id)
-		if err != nil {
-			return nil, err
+	found, err := s.repo.GetByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	colors, err := s.repo.GetColorsByItems(ids)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := s.repo.GetVariantsByItems(ids)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := s.repo.GetTagsByItems(ids)
+	if err != nil {
+		return nil, err
+	}
+	images, err := s.repo.GetImagesByItems(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byId := make(map[int]models.Item, len(found))
+	for _, item := range found {
+		item.Colors = colors[item.Id]
+		item.Variants = variants[item.Id]
+		for i := range item.Variants {
+			for j := range item.Variants[i].Images {
+				item.Variants[i].Images[j].Filename = "/files/" + item.Variants[i].Images[j].Filename
+			}
 		}
-		for i := range images {
-			images[i].Filename = "/files/" + images[i].Filename
+		item.InStock = inStock(item.Colors, item.Variants)
+		item.Tags = tags[item.Id]
+		item.Images = images[item.Id]
+		for i := range item.Images {
+			item.Images[i].Filename = "/files/" + item.Images[i].Filename
 		}
-		item.Images = images
+		byId[item.Id] = item
+	}
 
-		items = append(items, item)
+	for _, id := range ids {
+		if item, ok := byId[id]; ok {
+			items = append(items, item)
+		}
 	}
 
-	return items, err
+	return items, nil
 }
 
 func (s *ItemsService) Update(id int, name, description string, categoryId int, tags []string, colorsId []int, price float64, sku string, imagesId []int) error {
@@ -251,8 +204,8 @@ func (s *ItemsService) Update(id int, name, description string, categoryId int,
 		}
 	}
 
-	// Update colors
-	if err := s.repo.DeleteColors(id); err != nil {
+	// Update colors keeping stock of remaining ones
+	if err := s.repo.DeleteColorsExcept(id, colorsId); err != nil {
 		return err
 	}
 	for _, colorId := range colorsId {
@@ -281,3 +234,161 @@ func (s *ItemsService) Delete(itemId int) error {
 func (s *ItemsService) Exist(itemId int) (bool, error) {
 	return s.repo.Exist(itemId)
 }
+
+// SetVariants replaces item variants. All variants must define the same
+// option names and differ by their values
+func (s *ItemsService) SetVariants(itemId int, variants []models.Variant) error {
+	combinations := make(map[string]bool, len(variants))
+	for _, variant := range variants {
+		if len(variant.Options) == 0 || len(variant.Options) != len(variants[0].Options) {
+			return models.ErrVariantOptions
+		}
+
+		names := make([]string, 0, len(variant.Options))
+		for name := range variant.Options {
+			if _, ok := variants[0].Options[name]; !ok {
+				return models.ErrVariantOptions
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var combination strings.Builder
+		for _, name := range names {
+			combination.WriteString(name + "=" + variant.Options[name] + ";")
+		}
+		if combinations[combination.String()] {
+			return models.ErrVariantOptions
+		}
+		combinations[combination.String()] = true
+
+		// Variant sku must not clash with sku of any item
+		if _, err := s.repo.GetBySku(variant.Sku); err == nil {
+			return models.ErrSkuTaken
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+
+	return s.repo.SaveVariants(itemId, variants)
+}
+
+func (s *ItemsService) AdjustStock(itemId, colorId, delta int, reason string, userId *int) error {
+	available, err := s.repo.HasColor(itemId, colorId)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return models.ErrItemColorNotFound
+	}
+
+	return s.repo.AdjustStock(models.StockMovement{
+		ItemId:  itemId,
+		ColorId: colorId,
+		Delta:   delta,
+		Reason:  reason,
+		UserId:  userId,
+	})
+}
+
+func (s *ItemsService) GetStockMovements(itemId int) ([]models.StockMovement, error) {
+	return s.repo.GetStockMovements(itemId)
+}
+
+// Search returns items matching text ordered by relevance
+func (s *ItemsService) Search(text string, limit, offset int) ([]models.SearchResult, error) {
+	if limit < 1 {
+		limit = models.SearchDefaultLimit
+	} else if limit > models.SearchMaxLimit {
+		limit = models.SearchMaxLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	results, err := s.repo.Search(text, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.Item.Id)
+	}
+
+	items, err := s.assemble(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Items deleted between queries are dropped
+	byId := make(map[int]models.Item, len(items))
+	for _, item := range items {
+		byId[item.Id] = item
+	}
+	found := results[:0]
+	for _, result := range results {
+		if item, ok := byId[result.Item.Id]; ok {
+			result.Item = item
+			found = append(found, result)
+		}
+	}
+
+	return found, nil
+}
+
+// List returns one page of filtered and sorted items together with facet counts
+func (s *ItemsService) List(query models.ItemsQuery) (models.ItemsPage, error) {
+	if query.Sort == "" {
+		query.Sort = models.ItemsSortNewest
+	}
+	if !query.Sort.IsValid() {
+		return models.ItemsPage{}, models.ErrWrongItemsSort
+	}
+	if query.Cursor != nil && query.Cursor.Sort != query.Sort {
+		return models.ItemsPage{}, models.ErrInvalidCursor
+	}
+	if query.Limit < 1 {
+		query.Limit = models.ListingDefaultLimit
+	} else if query.Limit > models.ListingMaxLimit {
+		query.Limit = models.ListingMaxLimit
+	}
+
+	ids, next, err := s.repo.List(query)
+	if err != nil {
+		return models.ItemsPage{}, err
+	}
+
+	var page models.ItemsPage
+	page.Items, err = s.assemble(ids)
+	if err != nil {
+		return models.ItemsPage{}, err
+	}
+	if next != nil {
+		page.NextCursor = next.Encode()
+	}
+
+	page.Facets, err = s.repo.Facets(query.Filter)
+	if err != nil {
+		return models.ItemsPage{}, err
+	}
+
+	return page, nil
+}
+
+// inStock reports whether at least one item color or variant is available
+func inStock(colors []models.Color, variants []models.Variant) bool {
+	for _, color := range colors {
+		if color.Stock != nil && *color.Stock > 0 {
+			return true
+		}
+	}
+
+	for _, variant := range variants {
+		if variant.Stock != nil && *variant.Stock > 0 {
+			return true
+		}
+	}
+
+	return false
+}
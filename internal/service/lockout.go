@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"shop_backend/pkg/auth"
+	"shop_backend/pkg/logger"
+	"shop_backend/pkg/mailer"
+	"time"
+)
+
+const unlockBody = `Hello %s,
+
+your account has been locked for %s after too many failed sign in attempts.
+If it was you, follow the link below to unlock it now:
+
+%s
+
+If it was not you, someone may be guessing your password, consider changing it.
+`
+
+// checkLockout rejects sign in to locked account without verifying password,
+// so guessing cannot continue while account is locked
+func (s *UsersService) checkLockout(ctx context.Context, user models.User, login string, device models.Device) error {
+	locked, err := s.loginAttemptsRepo.IsLocked(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	if locked {
+		s.recordLoginAttempt(ctx, &user.Id, login, device, false)
+		return models.ErrAccountLocked
+	}
+
+	return nil
+}
+
+// loginFailed counts failed sign in and emails unlock link once account gets locked
+func (s *UsersService) loginFailed(ctx context.Context, user models.User, login string, device models.Device) error {
+	s.recordLoginAttempt(ctx, &user.Id, login, device, false)
+
+	locked, err := s.loginAttemptsRepo.RegisterFailure(ctx, user.Id, s.maxLoginFailures, s.lockoutDuration)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+
+	// Failed email must not hide lockout, account unlocks itself anyway
+	if err := s.sendUnlock(ctx, user); err != nil {
+		logger.Errorf("failed to send unlock email to user %d: %s", user.Id, err.Error())
+	}
+
+	return nil
+}
+
+// loginSucceeded resets counter of failed sign ins
+func (s *UsersService) loginSucceeded(ctx context.Context, user models.User, login string, device models.Device) error {
+	s.recordLoginAttempt(ctx, &user.Id, login, device, true)
+
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+
+	return s.loginAttemptsRepo.Unlock(ctx, user.Id)
+}
+
+// recordLoginAttempt keeps attempt for review by admins. Failed record must
+// not break authentication, so error is only logged
+func (s *UsersService) recordLoginAttempt(ctx context.Context, userId *int, login string, device models.Device, success bool) {
+	if err := s.loginAttemptsRepo.Create(ctx, models.LoginAttempt{
+		UserId:  userId,
+		Login:   login,
+		Device:  device,
+		Success: success,
+	}); err != nil {
+		logger.Errorf("failed to record login attempt of %q: %s", login, err.Error())
+	}
+}
+
+func (s *UsersService) sendUnlock(ctx context.Context, user models.User) error {
+	token, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+
+	// Lockout ends by itself, link is not needed after that
+	if err := s.usersTokensRepo.Create(ctx, models.UserToken{
+		UserId:    user.Id,
+		Kind:      models.UserTokenUnlock,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(s.lockoutDuration),
+	}); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Account locked",
+		Body:    fmt.Sprintf(unlockBody, user.Login, s.lockoutDuration, s.link("/unlock", token)),
+	})
+}
+
+// UnlockAccount lifts lockout by token from unlock email
+func (s *UsersService) UnlockAccount(ctx context.Context, token string) error {
+	unlock, err := s.usersTokensRepo.Consume(ctx, models.UserTokenUnlock, auth.HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	return s.loginAttemptsRepo.Unlock(ctx, unlock.UserId)
+}
+
+type LoginAttemptsService struct {
+	repo repository.LoginAttempts
+}
+
+func NewLoginAttemptsService(repo repository.LoginAttempts) *LoginAttemptsService {
+	return &LoginAttemptsService{repo: repo}
+}
+
+func (s *LoginAttemptsService) GetAll(ctx context.Context, filter models.LoginAttemptsFilter) ([]models.LoginAttempt, error) {
+	return s.repo.GetAll(ctx, filter)
+}
+
+func (s *LoginAttemptsService) GetLockouts(ctx context.Context) ([]models.Lockout, error) {
+	return s.repo.GetLockouts(ctx)
+}
+
+func (s *LoginAttemptsService) GetLockout(ctx context.Context, userId int) (models.LockoutState, error) {
+	return s.repo.GetLockout(ctx, userId)
+}
+
+func (s *LoginAttemptsService) Unlock(ctx context.Context, userId int) error {
+	return s.repo.Unlock(ctx, userId)
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"shop_backend/internal/models"
+	"shop_backend/pkg/auth"
+	"shop_backend/pkg/oidc"
+	"strings"
+	"time"
+)
+
+const (
+	// oauthStateTTL is how long user has to complete sign in at identity provider
+	oauthStateTTL = 10 * time.Minute
+	// oauthLoginLength leaves room for suffix making generated login unique
+	oauthLoginLength   = 10
+	oauthLoginAttempts = 5
+)
+
+// OAuthURL starts sign in with identity provider and returns address of its
+// sign in page with state, which has to be kept in browser starting sign in.
+// Login hint is passed to provider and may be empty
+func (s *UsersService) OAuthURL(ctx context.Context, providerName, loginHint string) (string, string, error) {
+	provider, ok := s.oauthProviders[providerName]
+	if !ok {
+		return "", "", models.ErrProviderNotFound
+	}
+
+	state, err := auth.NewToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := auth.NewToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", "", err
+	}
+
+	url, err := provider.AuthCodeURL(ctx, state, nonce, oidc.Challenge(verifier), loginHint)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.identitiesRepo.CreateState(ctx, models.OAuthState{
+		StateHash:    auth.HashToken(state),
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oauthStateTTL),
+	}); err != nil {
+		return "", "", err
+	}
+
+	return url, state, nil
+}
+
+// SignInOAuth completes sign in with identity provider. State has to match
+// the one kept in browser, otherwise attacker could sign victim in to
+// attacker's account with code of their own. Unknown identity is linked to
+// user with the same verified email, or new user is created. Like password
+// sign in it may end with two-factor challenge
+func (s *UsersService) SignInOAuth(ctx context.Context, providerName, code, state, browserState, cartToken string, device models.Device) (models.Tokens, error) {
+	provider, ok := s.oauthProviders[providerName]
+	if !ok {
+		return models.Tokens{}, models.ErrProviderNotFound
+	}
+
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return models.Tokens{}, models.ErrInvalidToken
+	}
+
+	pending, err := s.identitiesRepo.ConsumeState(ctx, providerName, auth.HashToken(state))
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	identity, err := provider.Exchange(ctx, code, pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	user, err := s.oauthUser(ctx, providerName, identity)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	challenge, err := s.twoFactorChallenge(ctx, user.Id)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+	if challenge != "" {
+		return models.Tokens{ChallengeToken: challenge}, nil
+	}
+
+	// Provider proves control of account as well as unlock link does
+	if err := s.loginSucceeded(ctx, user, providerName+":"+identity.Email, device); err != nil {
+		return models.Tokens{}, err
+	}
+
+	s.mergeCart(ctx, cartToken, user.Id)
+
+	return s.createSession(ctx, user.Id, device)
+}
+
+// oauthUser returns user linked to identity, linking or creating one by email.
+// Account with unverified email is not linked, otherwise whoever registered
+// someone else's email would get access to their provider sign ins
+func (s *UsersService) oauthUser(ctx context.Context, providerName string, identity oidc.Identity) (models.User, error) {
+	linked, err := s.identitiesRepo.Get(ctx, providerName, identity.Subject)
+	if err == nil {
+		return s.repo.GetById(ctx, linked.UserId)
+	} else if !errors.Is(err, models.ErrIdentityNotFound) {
+		return models.User{}, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return models.User{}, models.ErrProviderEmail
+	}
+
+	user, err := s.repo.GetByLogin(ctx, "email", identity.Email)
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+		if user, err = s.createOAuthUser(ctx, identity.Email); err != nil {
+			return models.User{}, err
+		}
+	case err != nil:
+		return models.User{}, err
+	case !user.EmailVerified:
+		return models.User{}, models.ErrIdentityNotLinked
+	}
+
+	if err := s.identitiesRepo.Create(ctx, models.UserIdentity{
+		UserId:   user.Id,
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}); err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// createOAuthUser creates user with verified email, login derived from email
+// and random password, which can be replaced by password reset
+func (s *UsersService) createOAuthUser(ctx context.Context, email string) (models.User, error) {
+	login, err := s.oauthLogin(ctx, email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	password, err := auth.NewToken()
+	if err != nil {
+		return models.User{}, err
+	}
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.createUser(ctx, models.User{
+		Email:    email,
+		Login:    login,
+		Password: passwordHash,
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := s.repo.ConfirmEmail(ctx, user.Id, email); err != nil {
+		return models.User{}, err
+	}
+
+	return s.repo.GetById(ctx, user.Id)
+}
+
+// oauthLogin derives free login from local part of email, adding random
+// digits if it is taken
+func (s *UsersService) oauthLogin(ctx context.Context, email string) (string, error) {
+	var base strings.Builder
+	for _, r := range strings.SplitN(email, "@", 2)[0] {
+		if base.Len() == oauthLoginLength {
+			break
+		}
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			base.WriteRune(r)
+		}
+	}
+	if base.Len() < 2 {
+		base.Reset()
+		base.WriteString("user")
+	}
+
+	login := base.String()
+	for i := 0; i < oauthLoginAttempts; i++ {
+		if _, err := s.repo.GetByLogin(ctx, "login", login); errors.Is(err, models.ErrUserNotFound) {
+			return login, nil
+		} else if err != nil {
+			return "", err
+		}
+
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		login = fmt.Sprintf("%s%04d", base.String(), suffix.Int64())
+	}
+
+	return "", models.NewErrUniqueValue("login")
+}
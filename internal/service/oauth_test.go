@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"shop_backend/pkg/oidc"
+	"testing"
+)
+
+// Fakes embed repository interfaces, methods sign in with provider does not
+// reach are left nil
+
+type fakeUsersRepo struct {
+	repository.Users
+	users []models.User
+}
+
+func (r *fakeUsersRepo) GetByLogin(_ context.Context, findBy, login string) (models.User, error) {
+	for _, user := range r.users {
+		if findBy == "email" && user.Email == login || findBy == "login" && user.Login == login {
+			return user, nil
+		}
+	}
+
+	return models.User{}, models.ErrUserNotFound
+}
+
+func (r *fakeUsersRepo) GetById(_ context.Context, userId int) (models.User, error) {
+	for _, user := range r.users {
+		if user.Id == userId {
+			return user, nil
+		}
+	}
+
+	return models.User{}, models.ErrUserNotFound
+}
+
+type fakeIdentitiesRepo struct {
+	repository.Identities
+	identities []models.UserIdentity
+	states     map[string]models.OAuthState
+}
+
+func (r *fakeIdentitiesRepo) Get(_ context.Context, provider, subject string) (models.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+
+	return models.UserIdentity{}, models.ErrIdentityNotFound
+}
+
+func (r *fakeIdentitiesRepo) Create(_ context.Context, identity models.UserIdentity) error {
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *fakeIdentitiesRepo) CreateState(_ context.Context, state models.OAuthState) error {
+	r.states[state.StateHash] = state
+	return nil
+}
+
+func (r *fakeIdentitiesRepo) ConsumeState(_ context.Context, provider, stateHash string) (models.OAuthState, error) {
+	state, ok := r.states[stateHash]
+	if !ok || state.Provider != provider {
+		return models.OAuthState{}, models.ErrInvalidToken
+	}
+	delete(r.states, stateHash)
+
+	return state, nil
+}
+
+// fakeTwoFactorRepo has two-factor authentication enabled for everyone, so
+// successful sign in ends with challenge before any session is created
+type fakeTwoFactorRepo struct {
+	repository.TwoFactor
+}
+
+func (r *fakeTwoFactorRepo) Get(_ context.Context, userId int) (models.TwoFactor, error) {
+	return models.TwoFactor{UserId: userId, Enabled: true}, nil
+}
+
+type fakeUsersTokensRepo struct {
+	repository.UsersTokens
+	tokens []models.UserToken
+}
+
+func (r *fakeUsersTokensRepo) Create(_ context.Context, token models.UserToken) error {
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+type oauthTest struct {
+	service    *UsersService
+	users      *fakeUsersRepo
+	identities *fakeIdentitiesRepo
+	tokens     *fakeUsersTokensRepo
+}
+
+func newOAuthTest(t *testing.T, users ...models.User) *oauthTest {
+	t.Helper()
+
+	issuer, err := oidc.NewMockIssuer("", "shop", "", "default@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(issuer)
+	t.Cleanup(srv.Close)
+
+	provider, err := oidc.NewProvider(oidc.Config{
+		Issuer:      srv.URL,
+		ClientId:    "shop",
+		RedirectURL: "http://shop.test/oauth/mock/callback",
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test := &oauthTest{
+		users:      &fakeUsersRepo{users: users},
+		identities: &fakeIdentitiesRepo{states: make(map[string]models.OAuthState)},
+		tokens:     &fakeUsersTokensRepo{},
+	}
+	test.service = &UsersService{
+		repo:            test.users,
+		identitiesRepo:  test.identities,
+		twoFactorRepo:   &fakeTwoFactorRepo{},
+		usersTokensRepo: test.tokens,
+		oauthProviders:  map[string]*oidc.Provider{"mock": provider},
+	}
+
+	return test
+}
+
+// authorize starts sign in as email and returns code and state provider
+// redirected back with, along with state kept in browser
+func (test *oauthTest) authorize(t *testing.T, email string) (code, state, browserState string) {
+	t.Helper()
+
+	authURL, browserState, err := test.service.OAuthURL(context.Background(), "mock", email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return location.Query().Get("code"), location.Query().Get("state"), browserState
+}
+
+func TestSignInOAuthLinksVerifiedEmail(t *testing.T) {
+	test := newOAuthTest(t, models.User{Id: 7, Login: "user", Email: "user@example.com", EmailVerified: true})
+
+	code, state, browserState := test.authorize(t, "user@example.com")
+	tokens, err := test.service.SignInOAuth(context.Background(), "mock", code, state, browserState, "", models.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.ChallengeToken == "" {
+		t.Fatal("sign in of user with two-factor authentication did not end with challenge")
+	}
+
+	if len(test.identities.identities) != 1 || test.identities.identities[0].UserId != 7 {
+		t.Fatalf("identities = %+v, want identity linked to user 7", test.identities.identities)
+	}
+	if len(test.tokens.tokens) != 1 || test.tokens.tokens[0].UserId != 7 {
+		t.Fatalf("challenges = %+v, want challenge of user 7", test.tokens.tokens)
+	}
+
+	// Linked identity signs in as the same user
+	code, state, browserState = test.authorize(t, "user@example.com")
+	if _, err := test.service.SignInOAuth(context.Background(), "mock", code, state, browserState, "", models.Device{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(test.identities.identities) != 1 || len(test.tokens.tokens) != 2 || test.tokens.tokens[1].UserId != 7 {
+		t.Fatalf("identities = %+v, challenges = %+v, want second sign in of user 7", test.identities.identities, test.tokens.tokens)
+	}
+}
+
+func TestSignInOAuthSkipsUnverifiedEmail(t *testing.T) {
+	test := newOAuthTest(t, models.User{Id: 7, Login: "user", Email: "user@example.com"})
+
+	code, state, browserState := test.authorize(t, "user@example.com")
+	_, err := test.service.SignInOAuth(context.Background(), "mock", code, state, browserState, "", models.Device{})
+	if !errors.Is(err, models.ErrIdentityNotLinked) {
+		t.Fatalf("error = %v, want %v", err, models.ErrIdentityNotLinked)
+	}
+	if len(test.identities.identities) != 0 {
+		t.Fatalf("identities = %+v, want none", test.identities.identities)
+	}
+}
+
+func TestSignInOAuthRequiresBrowserState(t *testing.T) {
+	test := newOAuthTest(t, models.User{Id: 7, Login: "user", Email: "user@example.com", EmailVerified: true})
+
+	// Attacker's code and state posted from victim's browser, which holds
+	// state of its own sign in or none at all
+	code, state, _ := test.authorize(t, "user@example.com")
+	_, _, victimState := test.authorize(t, "victim@example.com")
+	for _, browserState := range []string{victimState, ""} {
+		_, err := test.service.SignInOAuth(context.Background(), "mock", code, state, browserState, "", models.Device{})
+		if !errors.Is(err, models.ErrInvalidToken) {
+			t.Fatalf("error = %v, want %v", err, models.ErrInvalidToken)
+		}
+	}
+	if len(test.identities.identities) != 0 {
+		t.Fatalf("identities = %+v, want none", test.identities.identities)
+	}
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+)
+
+type OrdersService struct {
+	repo          repository.Orders
+	cartsRepo     repository.Carts
+	usersRepo     repository.Users
+	couponsRepo   repository.Coupons
+	shippingPrice float64
+}
+
+func NewOrdersService(repo repository.Orders, cartsRepo repository.Carts, usersRepo repository.Users,
+	couponsRepo repository.Coupons, shippingPrice float64) *OrdersService {
+	return &OrdersService{
+		repo:          repo,
+		cartsRepo:     cartsRepo,
+		usersRepo:     usersRepo,
+		couponsRepo:   couponsRepo,
+		shippingPrice: shippingPrice,
+	}
+}
+
+// Create converts user cart into pending order reserving stock of its items
+// and redeeming applied coupon. Items, prices, discounts and addresses are
+// copied into order so later changes do not affect it. Only users with
+// verified email can place orders
+func (s *OrdersService) Create(ctx context.Context, userId int) (models.Order, error) {
+	user, err := s.usersRepo.GetById(ctx, userId)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if !user.EmailVerified {
+		return models.Order{}, models.ErrEmailNotVerified
+	}
+
+	cartId, err := s.cartsRepo.GetOrCreate(ctx, userId)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	lines, err := s.cartsRepo.GetItems(ctx, cartId)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if len(lines) == 0 {
+		return models.Order{}, models.ErrEmptyCart
+	}
+
+	invoiceAddress, err := s.usersRepo.GetAddress(ctx, "invoice", userId)
+	if err != nil {
+		return models.Order{}, err
+	}
+	shippingAddress, err := s.usersRepo.GetAddress(ctx, "shipping", userId)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if invoiceAddress == (models.Address{}) || shippingAddress == (models.Address{}) {
+		return models.Order{}, models.ErrAddressNotFound
+	}
+
+	coupon, err := cartCoupon(ctx, s.cartsRepo, s.couponsRepo, cartId, userId)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	cart := models.Cart{Items: lines}
+	if err := priceCart(&cart, coupon, s.shippingPrice); err != nil {
+		return models.Order{}, err
+	}
+
+	order := models.Order{
+		UserId:          &userId,
+		Status:          models.OrderStatusPending,
+		Total:           cart.Total,
+		Discount:        cart.Discount,
+		Shipping:        cart.Shipping,
+		InvoiceAddress:  invoiceAddress,
+		ShippingAddress: shippingAddress,
+	}
+	if coupon != nil {
+		order.CouponId = &coupon.Id
+		order.CouponCode = &coupon.Code
+	}
+	for _, line := range cart.Items {
+		itemId := line.ItemId
+		order.Items = append(order.Items, models.OrderItem{
+			ItemId:    &itemId,
+			Name:      line.Name,
+			VariantId: line.VariantId,
+			Sku:       line.Sku,
+			Price:     line.Price,
+			Color:     line.Color,
+			Quantity:  line.Quantity,
+			Total:     line.Total,
+			Discount:  line.Discount,
+		})
+	}
+
+	// Cart is cleared in the same transaction, so it cannot be ordered twice
+	orderId, err := s.repo.Create(ctx, cartId, order)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	return s.get(ctx, orderId)
+}
+
+// GetById returns order only if it belongs to user
+func (s *OrdersService) GetById(ctx context.Context, userId, orderId int) (models.Order, error) {
+	order, err := s.get(ctx, orderId)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	if order.UserId == nil || *order.UserId != userId {
+		return models.Order{}, models.ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
+func (s *OrdersService) GetByUser(ctx context.Context, userId int) ([]models.Order, error) {
+	return s.repo.GetByUser(ctx, userId)
+}
+
+func (s *OrdersService) Get(ctx context.Context, orderId int) (models.Order, error) {
+	return s.get(ctx, orderId)
+}
+
+func (s *OrdersService) GetAll(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
+	if status != "" && !status.IsValid() {
+		return nil, models.ErrWrongOrderStatus
+	}
+
+	return s.repo.GetAll(ctx, status)
+}
+
+// UpdateStatus moves order to status. Refunded status is set only by payment
+// refund, which sends money back at provider
+func (s *OrdersService) UpdateStatus(ctx context.Context, orderId int, status models.OrderStatus) error {
+	if !status.IsValid() {
+		return models.ErrWrongOrderStatus
+	}
+	if status == models.OrderStatusRefunded {
+		return models.ErrRefundViaPayment
+	}
+
+	order, err := s.repo.GetById(ctx, orderId)
+	if err != nil {
+		return err
+	}
+
+	if !order.Status.CanTransitionTo(status) {
+		return models.NewErrOrderTransition(order.Status, status)
+	}
+
+	if status == models.OrderStatusCancelled {
+		return s.repo.Cancel(ctx, orderId, order.Status)
+	}
+
+	return s.repo.UpdateStatus(ctx, orderId, order.Status, status)
+}
+
+func (s *OrdersService) get(ctx context.Context, orderId int) (models.Order, error) {
+	order, err := s.repo.GetById(ctx, orderId)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	order.Items, err = s.repo.GetItems(ctx, orderId)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	order.History, err = s.repo.GetHistory(ctx, orderId)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	return order, nil
+}
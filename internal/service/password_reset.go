@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"shop_backend/internal/models"
+	"shop_backend/pkg/auth"
+	"shop_backend/pkg/mailer"
+	"time"
+)
+
+const passwordResetBody = `Hello %s,
+
+we received a request to reset password of your account. Follow the link
+below to choose a new password, it is valid for %s:
+
+%s
+
+If you did not request the reset, ignore this email, your password stays unchanged.
+`
+
+// ForgotPassword emails password reset link to user. Unknown email is not
+// reported, so the endpoint cannot be used to find registered addresses
+func (s *UsersService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.GetByLogin(ctx, "email", email)
+	if errors.Is(err, models.ErrUserNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.usersTokensRepo.Create(ctx, models.UserToken{
+		UserId:    user.Id,
+		Kind:      models.UserTokenPasswordReset,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(s.passwordResetTTL),
+	}); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body:    fmt.Sprintf(passwordResetBody, user.Login, s.passwordResetTTL, s.link("/password/reset", token)),
+	})
+}
+
+// ResetPassword sets new password by reset token, lifts lockout and ends all sessions of user
+func (s *UsersService) ResetPassword(ctx context.Context, token, password string) error {
+	reset, err := s.usersTokensRepo.Consume(ctx, models.UserTokenPasswordReset, auth.HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdateField(ctx, "password", passwordHash, reset.UserId); err != nil {
+		return err
+	}
+
+	// Reset proves control of email as well as unlock link does
+	if err := s.loginAttemptsRepo.Unlock(ctx, reset.UserId); err != nil {
+		return err
+	}
+
+	if err := s.sessionsRepo.DeleteByUser(ctx, reset.UserId); err != nil {
+		return err
+	}
+
+	return s.versions.Revoke(ctx, reset.UserId)
+}
+
+// link builds frontend link carrying token in query
+func (s *UsersService) link(path, token string) string {
+	return s.linkBaseURL + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"shop_backend/pkg/logger"
+	"shop_backend/pkg/payments"
+	"strconv"
+)
+
+type PaymentsService struct {
+	repo       repository.Payments
+	ordersRepo repository.Orders
+	provider   payments.Provider
+	currency   string
+}
+
+func NewPaymentsService(repo repository.Payments, ordersRepo repository.Orders, provider payments.Provider, currency string) *PaymentsService {
+	return &PaymentsService{
+		repo:       repo,
+		ordersRepo: ordersRepo,
+		provider:   provider,
+		currency:   currency,
+	}
+}
+
+// Create starts payment of user pending order. Order which already has payment
+// that has not failed cannot be paid again
+func (s *PaymentsService) Create(ctx context.Context, userId, orderId int) (models.Payment, error) {
+	order, err := s.ordersRepo.GetById(ctx, orderId)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	if order.UserId == nil || *order.UserId != userId {
+		return models.Payment{}, models.ErrOrderNotFound
+	}
+	if order.Status != models.OrderStatusPending {
+		return models.Payment{}, models.ErrOrderNotPayable
+	}
+
+	orderPayments, err := s.repo.GetByOrder(ctx, orderId)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	for _, payment := range orderPayments {
+		if payment.Status != string(payments.StatusFailed) {
+			return models.Payment{}, models.ErrPaymentExists
+		}
+	}
+
+	intent, err := s.provider.CreateIntent(ctx, toMinorUnits(order.Total), s.currency, strconv.Itoa(order.Id))
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	payment := models.Payment{
+		OrderId:    order.Id,
+		Provider:   s.provider.Name(),
+		IntentId:   intent.Id,
+		Amount:     order.Total,
+		Currency:   intent.Currency,
+		Status:     string(intent.Status),
+		ConfirmURL: intent.ConfirmURL,
+	}
+	payment.Id, err = s.repo.Create(ctx, payment)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	return payment, nil
+}
+
+func (s *PaymentsService) GetByOrder(ctx context.Context, orderId int) ([]models.Payment, error) {
+	return s.repo.GetByOrder(ctx, orderId)
+}
+
+// HandleWebhook applies provider event to payment and its order
+func (s *PaymentsService) HandleWebhook(ctx context.Context, payload []byte, signature string) error {
+	event, err := s.provider.HandleWebhook(payload, signature)
+	if err != nil {
+		return err
+	}
+
+	payment, err := s.repo.GetByIntent(ctx, event.IntentId)
+	if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case payments.EventAuthorized:
+		return s.capture(ctx, payment)
+	case payments.EventFailed:
+		return s.setStatus(ctx, payment, payments.StatusFailed)
+	case payments.EventRefunded:
+		if err := s.setStatus(ctx, payment, payments.StatusRefunded); err != nil {
+			return err
+		}
+		return s.moveOrder(ctx, payment.OrderId, models.OrderStatusRefunded)
+	}
+
+	return nil
+}
+
+// Simulate completes payment using sandbox provider and processes produced webhook
+func (s *PaymentsService) Simulate(ctx context.Context, intentId string, succeed bool) error {
+	simulator, ok := s.provider.(payments.Simulator)
+	if !ok {
+		return models.ErrCannotSimulate
+	}
+
+	payload, signature, err := simulator.Confirm(ctx, intentId, succeed)
+	if err != nil {
+		return err
+	}
+
+	return s.HandleWebhook(ctx, payload, signature)
+}
+
+// Refund returns money of all succeeded order payments and moves order to
+// refunded status. Order which cannot be refunded is checked before any money
+// is sent back
+func (s *PaymentsService) Refund(ctx context.Context, orderId int) error {
+	order, err := s.ordersRepo.GetById(ctx, orderId)
+	if err != nil {
+		return err
+	}
+	if !order.Status.CanTransitionTo(models.OrderStatusRefunded) {
+		return models.NewErrOrderTransition(order.Status, models.OrderStatusRefunded)
+	}
+
+	orderPayments, err := s.repo.GetByOrder(ctx, orderId)
+	if err != nil {
+		return err
+	}
+
+	var succeeded []models.Payment
+	for _, payment := range orderPayments {
+		if payment.Status == string(payments.StatusSucceeded) {
+			succeeded = append(succeeded, payment)
+		}
+	}
+	if len(succeeded) == 0 {
+		return models.ErrPaymentNotFound
+	}
+
+	for _, payment := range succeeded {
+		if _, err := s.provider.Refund(ctx, payment.IntentId, toMinorUnits(payment.Amount)); err != nil {
+			return err
+		}
+		if err := s.setStatus(ctx, payment, payments.StatusRefunded); err != nil {
+			return err
+		}
+	}
+
+	return s.moveOrder(ctx, orderId, models.OrderStatusRefunded)
+}
+
+// capture takes authorized money and marks pending order as paid. If order is
+// not pending anymore, e.g. it was cancelled or paid by another payment
+// meanwhile, money is refunded back
+func (s *PaymentsService) capture(ctx context.Context, payment models.Payment) error {
+	// Redelivered event of already processed payment
+	if payment.Status == string(payments.StatusSucceeded) || payment.Status == string(payments.StatusRefunded) {
+		return nil
+	}
+
+	intent, err := s.provider.Capture(ctx, payment.IntentId)
+	if err != nil {
+		return err
+	}
+	if err := s.setStatus(ctx, payment, intent.Status); err != nil {
+		return err
+	}
+	payment.Status = string(intent.Status)
+
+	if err := s.payOrder(ctx, payment.OrderId); err != nil {
+		if !errors.Is(err, models.ErrOrderNotPayable) && !errors.Is(err, models.ErrOrderStatusChange) {
+			return err
+		}
+
+		logger.Warnf("refunding payment %d of order %d: %s", payment.Id, payment.OrderId, err.Error())
+		if _, err := s.provider.Refund(ctx, payment.IntentId, intent.Amount); err != nil {
+			return err
+		}
+		return s.setStatus(ctx, payment, payments.StatusRefunded)
+	}
+
+	return nil
+}
+
+func (s *PaymentsService) setStatus(ctx context.Context, payment models.Payment, status payments.Status) error {
+	if payment.Status == string(status) {
+		return nil
+	}
+
+	return s.repo.UpdateStatus(ctx, payment.Id, payment.Status, string(status))
+}
+
+// payOrder moves order into paid status only from pending one
+func (s *PaymentsService) payOrder(ctx context.Context, orderId int) error {
+	order, err := s.ordersRepo.GetById(ctx, orderId)
+	if err != nil {
+		return err
+	}
+	if order.Status != models.OrderStatusPending {
+		return models.ErrOrderNotPayable
+	}
+
+	return s.ordersRepo.UpdateStatus(ctx, orderId, order.Status, models.OrderStatusPaid)
+}
+
+func (s *PaymentsService) moveOrder(ctx context.Context, orderId int, status models.OrderStatus) error {
+	order, err := s.ordersRepo.GetById(ctx, orderId)
+	if err != nil {
+		return err
+	}
+	if order.Status == status {
+		return nil
+	}
+	if !order.Status.CanTransitionTo(status) {
+		return models.NewErrOrderTransition(order.Status, status)
+	}
+
+	return s.ordersRepo.UpdateStatus(ctx, orderId, order.Status, status)
+}
+
+// toMinorUnits converts price into cents
+func toMinorUnits(price float64) int64 {
+	return int64(math.Round(price * 100))
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"shop_backend/pkg/payments"
+	"testing"
+)
+
+type fakeOrdersRepo struct {
+	repository.Orders
+	orders map[int]models.Order
+}
+
+func (r *fakeOrdersRepo) GetById(_ context.Context, orderId int) (models.Order, error) {
+	order, ok := r.orders[orderId]
+	if !ok {
+		return models.Order{}, models.ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
+func (r *fakeOrdersRepo) UpdateStatus(_ context.Context, orderId int, from, to models.OrderStatus) error {
+	order := r.orders[orderId]
+	if order.Status != from {
+		return models.ErrOrderStatusChange
+	}
+	order.Status = to
+	r.orders[orderId] = order
+
+	return nil
+}
+
+type fakePaymentsRepo struct {
+	repository.Payments
+	payments []models.Payment
+}
+
+func (r *fakePaymentsRepo) GetByOrder(_ context.Context, orderId int) ([]models.Payment, error) {
+	var orderPayments []models.Payment
+	for _, payment := range r.payments {
+		if payment.OrderId == orderId {
+			orderPayments = append(orderPayments, payment)
+		}
+	}
+
+	return orderPayments, nil
+}
+
+func (r *fakePaymentsRepo) UpdateStatus(_ context.Context, paymentId int, from, to string) error {
+	for i := range r.payments {
+		if r.payments[i].Id == paymentId && r.payments[i].Status == from {
+			r.payments[i].Status = to
+			return nil
+		}
+	}
+
+	return models.ErrPaymentStatus
+}
+
+type fakePaymentProvider struct {
+	payments.Provider
+	refunded []string
+}
+
+func (p *fakePaymentProvider) Refund(_ context.Context, intentId string, amount int64) (payments.Intent, error) {
+	p.refunded = append(p.refunded, intentId)
+	return payments.Intent{Id: intentId, Amount: amount, Status: payments.StatusRefunded}, nil
+}
+
+func TestPaymentsRefund(t *testing.T) {
+	succeeded := models.Payment{Id: 1, OrderId: 1, IntentId: "pi_1", Amount: 10, Status: string(payments.StatusSucceeded)}
+	failed := models.Payment{Id: 2, OrderId: 1, IntentId: "pi_2", Amount: 10, Status: string(payments.StatusFailed)}
+	second := models.Payment{Id: 3, OrderId: 1, IntentId: "pi_3", Amount: 5, Status: string(payments.StatusSucceeded)}
+
+	tests := []struct {
+		name     string
+		status   models.OrderStatus
+		payments []models.Payment
+		refunded []string
+		err      error
+	}{
+		{name: "paid", status: models.OrderStatusPaid, payments: []models.Payment{failed, succeeded}, refunded: []string{"pi_1"}},
+		{name: "delivered", status: models.OrderStatusDelivered, payments: []models.Payment{succeeded}, refunded: []string{"pi_1"}},
+		{name: "every succeeded payment", status: models.OrderStatusPaid, payments: []models.Payment{succeeded, second}, refunded: []string{"pi_1", "pi_3"}},
+		{name: "pending", status: models.OrderStatusPending, payments: []models.Payment{succeeded},
+			err: models.NewErrOrderTransition(models.OrderStatusPending, models.OrderStatusRefunded)},
+		{name: "shipped", status: models.OrderStatusShipped, payments: []models.Payment{succeeded},
+			err: models.NewErrOrderTransition(models.OrderStatusShipped, models.OrderStatusRefunded)},
+		{name: "cancelled", status: models.OrderStatusCancelled, payments: []models.Payment{succeeded},
+			err: models.NewErrOrderTransition(models.OrderStatusCancelled, models.OrderStatusRefunded)},
+		{name: "refunded", status: models.OrderStatusRefunded, payments: []models.Payment{succeeded},
+			err: models.NewErrOrderTransition(models.OrderStatusRefunded, models.OrderStatusRefunded)},
+		{name: "no succeeded payment", status: models.OrderStatusPaid, payments: []models.Payment{failed}, err: models.ErrPaymentNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders := &fakeOrdersRepo{orders: map[int]models.Order{1: {Id: 1, Status: tt.status}}}
+			repo := &fakePaymentsRepo{payments: append([]models.Payment(nil), tt.payments...)}
+			provider := &fakePaymentProvider{}
+			service := NewPaymentsService(repo, orders, provider, "EUR")
+
+			err := service.Refund(context.Background(), 1)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+
+			if len(provider.refunded) != len(tt.refunded) {
+				t.Fatalf("refunded intents = %v, want %v", provider.refunded, tt.refunded)
+			}
+			for i := range tt.refunded {
+				if provider.refunded[i] != tt.refunded[i] {
+					t.Fatalf("refunded intents = %v, want %v", provider.refunded, tt.refunded)
+				}
+			}
+
+			wantStatus := tt.status
+			if tt.err == nil {
+				wantStatus = models.OrderStatusRefunded
+			}
+			if status := orders.orders[1].Status; status != wantStatus {
+				t.Fatalf("order status = %s, want %s", status, wantStatus)
+			}
+		})
+	}
+}
+
+func TestOrdersUpdateStatusRefunded(t *testing.T) {
+	orders := &fakeOrdersRepo{orders: map[int]models.Order{1: {Id: 1, Status: models.OrderStatusPaid}}}
+	service := &OrdersService{repo: orders}
+
+	if err := service.UpdateStatus(context.Background(), 1, models.OrderStatusRefunded); !errors.Is(err, models.ErrRefundViaPayment) {
+		t.Fatalf("error = %v, want %v", err, models.ErrRefundViaPayment)
+	}
+	if status := orders.orders[1].Status; status != models.OrderStatusPaid {
+		t.Fatalf("order status = %s, want %s", status, models.OrderStatusPaid)
+	}
+}
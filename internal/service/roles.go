@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"shop_backend/pkg/auth"
+	"sync"
+	"time"
+)
+
+type RolesService struct {
+	repo            repository.Roles
+	versions        *TokenVersions
+	requireAdmin2FA bool
+	cacheTTL        time.Duration
+
+	mu          sync.RWMutex
+	permissions map[string][]models.Permission
+	cachedAt    time.Time
+}
+
+func NewRolesService(repo repository.Roles, versions *TokenVersions, requireAdmin2FA bool, cacheTTL time.Duration) *RolesService {
+	return &RolesService{
+		repo:            repo,
+		versions:        versions,
+		requireAdmin2FA: requireAdmin2FA,
+		cacheTTL:        cacheTTL,
+	}
+}
+
+// Authorize checks that any of roles from access token claims grants permission.
+// If configured, users with any permission must have two-factor authentication
+// enabled. Permissions of roles are cached in memory, so no database query is
+// made while cache is fresh
+func (s *RolesService) Authorize(ctx context.Context, claims auth.Claims, permission models.Permission) error {
+	rolesPermissions, err := s.rolesPermissions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var permissions []models.Permission
+	for _, role := range claims.Roles {
+		permissions = append(permissions, rolesPermissions[role]...)
+	}
+
+	if !models.HasPermission(permissions, permission) {
+		return models.ErrForbidden
+	}
+
+	if s.requireAdmin2FA && !claims.TwoFactor {
+		return models.ErrTwoFactorRequired
+	}
+
+	return nil
+}
+
+// rolesPermissions returns permissions by role name, reloading them once cache expires
+func (s *RolesService) rolesPermissions(ctx context.Context) (map[string][]models.Permission, error) {
+	s.mu.RLock()
+	permissions, cachedAt := s.permissions, s.cachedAt
+	s.mu.RUnlock()
+	if permissions != nil && time.Since(cachedAt) < s.cacheTTL {
+		return permissions, nil
+	}
+
+	roles, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions = make(map[string][]models.Permission, len(roles))
+	for _, role := range roles {
+		permissions[role.Name] = role.Permissions
+	}
+
+	s.mu.Lock()
+	s.permissions, s.cachedAt = permissions, time.Now()
+	s.mu.Unlock()
+
+	return permissions, nil
+}
+
+// invalidate drops cached permissions after roles are changed
+func (s *RolesService) invalidate() {
+	s.mu.Lock()
+	s.permissions = nil
+	s.mu.Unlock()
+}
+
+// Create creates role. Role cannot grant more than its creator has
+func (s *RolesService) Create(ctx context.Context, claims auth.Claims, role models.Role) (int, error) {
+	if err := validatePermissions(role.Permissions); err != nil {
+		return 0, err
+	}
+	if err := s.authorizeAll(ctx, claims, role.Permissions); err != nil {
+		return 0, err
+	}
+
+	roleId, err := s.repo.Create(ctx, role)
+	if err != nil {
+		return 0, err
+	}
+	s.invalidate()
+
+	return roleId, nil
+}
+
+// Update replaces role. Role granting all permissions cannot lose them, so
+// superusers cannot be demoted all at once by mistake. Access tokens carry role
+// names, so tokens of role holders are revoked when role is renamed. Editor
+// must have both current and new permissions of role
+func (s *RolesService) Update(ctx context.Context, claims auth.Claims, role models.Role) error {
+	if err := validatePermissions(role.Permissions); err != nil {
+		return err
+	}
+
+	current, err := s.repo.GetById(ctx, role.Id)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeAll(ctx, claims, append(current.Permissions, role.Permissions...)); err != nil {
+		return err
+	}
+	if models.HasPermission(current.Permissions, models.PermissionAll) && !models.HasPermission(role.Permissions, models.PermissionAll) {
+		return models.ErrRoleProtected
+	}
+
+	if err := s.repo.Update(ctx, role); err != nil {
+		return err
+	}
+	s.invalidate()
+
+	if current.Name != role.Name {
+		return s.revokeHolders(ctx, role.Id)
+	}
+
+	return nil
+}
+
+// Delete deletes role, only users having all its permissions can do it
+func (s *RolesService) Delete(ctx context.Context, claims auth.Claims, roleId int) error {
+	role, err := s.repo.GetById(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeAll(ctx, claims, role.Permissions); err != nil {
+		return err
+	}
+	if models.HasPermission(role.Permissions, models.PermissionAll) {
+		return models.ErrRoleProtected
+	}
+
+	usersIds, err := s.repo.GetUsersIds(ctx, roleId)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, roleId); err != nil {
+		return err
+	}
+	s.invalidate()
+
+	// Role with the same name may be created later, it must not be granted by old tokens
+	return s.versions.Revoke(ctx, usersIds...)
+}
+
+// revokeHolders revokes access tokens of users having role
+func (s *RolesService) revokeHolders(ctx context.Context, roleId int) error {
+	usersIds, err := s.repo.GetUsersIds(ctx, roleId)
+	if err != nil {
+		return err
+	}
+
+	return s.versions.Revoke(ctx, usersIds...)
+}
+
+func (s *RolesService) GetById(ctx context.Context, roleId int) (models.Role, error) {
+	return s.repo.GetById(ctx, roleId)
+}
+
+func (s *RolesService) GetAll(ctx context.Context) ([]models.Role, error) {
+	return s.repo.GetAll(ctx)
+}
+
+func (s *RolesService) GetUserRoles(ctx context.Context, userId int) ([]models.Role, error) {
+	return s.repo.GetByUser(ctx, userId)
+}
+
+// SetUserRoles replaces roles of user keeping at least one user with all
+// permissions. Caller must have every permission user gains or loses. Access
+// tokens of user are revoked, so new roles apply on refresh
+func (s *RolesService) SetUserRoles(ctx context.Context, claims auth.Claims, userId int, rolesId []int) error {
+	current, err := s.repo.GetPermissions(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	var granted []models.Permission
+	for _, roleId := range rolesId {
+		role, err := s.repo.GetById(ctx, roleId)
+		if err != nil {
+			return err
+		}
+		granted = append(granted, role.Permissions...)
+	}
+
+	if err := s.authorizeAll(ctx, claims, append(current, granted...)); err != nil {
+		return err
+	}
+
+	if models.HasPermission(current, models.PermissionAll) {
+		if !models.HasPermission(granted, models.PermissionAll) {
+			count, err := s.repo.CountWithPermission(ctx, models.PermissionAll)
+			if err != nil {
+				return err
+			}
+			if count <= 1 {
+				return models.ErrLastSuperuser
+			}
+		}
+	}
+
+	if err := s.repo.SetUserRoles(ctx, userId, rolesId); err != nil {
+		return err
+	}
+
+	return s.versions.Revoke(ctx, userId)
+}
+
+// authorizeAll checks that claims grant every one of permissions, so nobody
+// can hand out or take away permissions they do not have
+func (s *RolesService) authorizeAll(ctx context.Context, claims auth.Claims, permissions []models.Permission) error {
+	for _, permission := range permissions {
+		if err := s.Authorize(ctx, claims, permission); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validatePermissions(permissions []models.Permission) error {
+	for _, permission := range permissions {
+		if !permission.IsValid() {
+			return models.ErrWrongPermission
+		}
+	}
+
+	return nil
+}
@@ -7,12 +7,16 @@ import (
 	"shop_backend/internal/repository"
 	"shop_backend/pkg/auth"
 	"shop_backend/pkg/hash"
+	"shop_backend/pkg/mailer"
+	"shop_backend/pkg/oidc"
+	"shop_backend/pkg/payments"
 	"time"
 )
 
 type Images interface {
 	Upload(image *multipart.FileHeader) (int, error)
 	GetAll() ([]models.Image, error)
+	GetById(imageId int) (models.Image, error)
 	Exist(imageId int) (bool, error)
 	Delete(imageId int) error
 }
@@ -31,10 +35,12 @@ type Colors interface {
 type Categories interface {
 	Exist(categoryId int) (bool, error)
 	GetAll() ([]models.Category, error)
+	GetTree() ([]models.Category, error)
 	GetById(categoryId int) (models.Category, error)
-	Create(name string) (int, error)
-	Delete(categoryId int) error
-	Update(categoryId int, name string) error
+	Create(name, slug string, parentId *int, position int) (int, error)
+	Delete(categoryId int, moveTo *int) error
+	Update(categoryId int, name, slug string) error
+	Move(categoryId int, parentId *int, position int) error
 }
 
 type Items interface {
@@ -46,18 +52,39 @@ type Items interface {
 	GetNew() ([]models.Item, error)
 	GetById(itemId int) (models.Item, error)
 	GetBySku(sku string) (models.Item, error)
-	GetByCategory(categoryId int) ([]models.Item, error)
+	GetByCategory(categoryId int, descendants bool) ([]models.Item, error)
 	GetByTag(tag string) ([]models.Item, error)
 	Delete(itemId int) error
 	Exist(itemId int) (bool, error)
+	SetVariants(itemId int, variants []models.Variant) error
+	AdjustStock(itemId, colorId, delta int, reason string, userId *int) error
+	GetStockMovements(itemId int) ([]models.StockMovement, error)
+	Search(text string, limit, offset int) ([]models.SearchResult, error)
+	List(query models.ItemsQuery) (models.ItemsPage, error)
 }
 
 type Users interface {
-	SignUp(ctx context.Context, email, login, password string) (models.User, error)
-	SignIn(ctx context.Context, findBy, login, password string) (models.Tokens, error)
-	Logout(ctx context.Context, userId int) error
+	SignUp(ctx context.Context, email, login, password, cartToken string) (models.User, error)
+	SignIn(ctx context.Context, findBy, login, password, cartToken string, device models.Device) (models.Tokens, error)
+	Logout(ctx context.Context, userId, sessionId int) error
 	GetMe(ctx context.Context, userId int) (models.User, error)
-	RefreshTokens(ctx context.Context, refreshToken string) (models.Tokens, error)
+	RefreshTokens(ctx context.Context, refreshToken string, device models.Device) (models.Tokens, error)
+	CheckToken(ctx context.Context, claims auth.Claims) error
+	GetSessions(ctx context.Context, userId, currentId int) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userId, sessionId int) error
+	RevokeOtherSessions(ctx context.Context, userId, currentId int) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	ConfirmEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, userId int) error
+	EnrollTwoFactor(ctx context.Context, userId int) (models.TwoFactorEnrollment, error)
+	EnableTwoFactor(ctx context.Context, userId int, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, userId int, password, code string) error
+	SignInTwoFactor(ctx context.Context, challengeToken, code, cartToken string, device models.Device) (models.Tokens, error)
+	ChallengeLogin(ctx context.Context, challengeToken string) (string, error)
+	UnlockAccount(ctx context.Context, token string) error
+	OAuthURL(ctx context.Context, providerName, loginHint string) (string, string, error)
+	SignInOAuth(ctx context.Context, providerName, code, state, browserState, cartToken string, device models.Device) (models.Tokens, error)
 	UpdateEmail(ctx context.Context, userId int, email string) error
 	UpdatePassword(ctx context.Context, userId int, oldPassword, newPassword string) error
 	UpdateInfo(ctx context.Context, userId int, login, firstName, lastName, phoneCode, phoneNumber string) error
@@ -65,28 +92,132 @@ type Users interface {
 	DeleteMe(ctx context.Context, userId int) error
 }
 
+type Roles interface {
+	Authorize(ctx context.Context, claims auth.Claims, permission models.Permission) error
+	Create(ctx context.Context, claims auth.Claims, role models.Role) (int, error)
+	Update(ctx context.Context, claims auth.Claims, role models.Role) error
+	Delete(ctx context.Context, claims auth.Claims, roleId int) error
+	GetById(ctx context.Context, roleId int) (models.Role, error)
+	GetAll(ctx context.Context) ([]models.Role, error)
+	GetUserRoles(ctx context.Context, userId int) ([]models.Role, error)
+	SetUserRoles(ctx context.Context, claims auth.Claims, userId int, rolesId []int) error
+}
+
+type LoginAttempts interface {
+	GetAll(ctx context.Context, filter models.LoginAttemptsFilter) ([]models.LoginAttempt, error)
+	GetLockouts(ctx context.Context) ([]models.Lockout, error)
+	GetLockout(ctx context.Context, userId int) (models.LockoutState, error)
+	Unlock(ctx context.Context, userId int) error
+}
+
+type ApiKeys interface {
+	Create(ctx context.Context, claims auth.Claims, key models.ApiKey) (models.NewApiKey, error)
+	GetAll(ctx context.Context) ([]models.ApiKey, error)
+	Rotate(ctx context.Context, claims auth.Claims, keyId int) (models.NewApiKey, error)
+	Revoke(ctx context.Context, claims auth.Claims, keyId int) error
+	GetById(ctx context.Context, keyId int) (models.ApiKey, error)
+	Authenticate(ctx context.Context, key, ip string) (models.ApiKey, error)
+}
+
+type Audit interface {
+	Record(ctx context.Context, entry models.AuditEntry) error
+	GetAll(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+type Carts interface {
+	Get(ctx context.Context, owner models.CartOwner) (models.Cart, error)
+	AddItem(ctx context.Context, owner models.CartOwner, itemId, colorId int, variantId *int, quantity int) (string, error)
+	UpdateQuantity(ctx context.Context, owner models.CartOwner, lineId, quantity int) error
+	DeleteItem(ctx context.Context, owner models.CartOwner, lineId int) error
+	Clear(ctx context.Context, owner models.CartOwner) error
+	ApplyCoupon(ctx context.Context, owner models.CartOwner, code string) error
+	RemoveCoupon(ctx context.Context, owner models.CartOwner) error
+}
+
+type Coupons interface {
+	Create(ctx context.Context, coupon models.Coupon) (int, error)
+	Update(ctx context.Context, coupon models.Coupon) error
+	Delete(ctx context.Context, couponId int) error
+	GetById(ctx context.Context, couponId int) (models.Coupon, error)
+	GetAll(ctx context.Context) ([]models.Coupon, error)
+}
+
+type Orders interface {
+	Create(ctx context.Context, userId int) (models.Order, error)
+	GetById(ctx context.Context, userId, orderId int) (models.Order, error)
+	GetByUser(ctx context.Context, userId int) ([]models.Order, error)
+	Get(ctx context.Context, orderId int) (models.Order, error)
+	GetAll(ctx context.Context, status models.OrderStatus) ([]models.Order, error)
+	UpdateStatus(ctx context.Context, orderId int, status models.OrderStatus) error
+}
+
+type Payments interface {
+	Create(ctx context.Context, userId, orderId int) (models.Payment, error)
+	GetByOrder(ctx context.Context, orderId int) ([]models.Payment, error)
+	HandleWebhook(ctx context.Context, payload []byte, signature string) error
+	Simulate(ctx context.Context, intentId string, succeed bool) error
+	Refund(ctx context.Context, orderId int) error
+}
+
 type Services struct {
-	Users      Users
-	Items      Items
-	Categories Categories
-	Colors     Colors
-	Images     Images
+	Users         Users
+	Items         Items
+	Categories    Categories
+	Colors        Colors
+	Images        Images
+	Carts         Carts
+	Orders        Orders
+	Payments      Payments
+	Coupons       Coupons
+	Roles         Roles
+	LoginAttempts LoginAttempts
+	ApiKeys       ApiKeys
+	Audit         Audit
 }
 
 type ServicesDeps struct {
-	Repos           *repository.Repositories
-	Hasher          hash.PasswordHasher
-	TokenManager    auth.TokenManager
-	AccessTokenTTL  time.Duration
-	RefreshTokenTTL time.Duration
+	Repos            *repository.Repositories
+	Hasher           hash.PasswordHasher
+	TokenManager     auth.TokenManager
+	AccessTokenTTL   time.Duration
+	RefreshTokenTTL  time.Duration
+	PasswordResetTTL time.Duration
+	VerificationTTL  time.Duration
+	Mailer           mailer.Mailer
+	LinkBaseURL      string
+	TotpIssuer       string
+	RequireAdmin2FA  bool
+	MaxLoginFailures int
+	LockoutDuration  time.Duration
+	// AuthCacheTTL is how long token versions, sessions and permissions of roles are cached
+	AuthCacheTTL time.Duration
+	// OAuthProviders are OpenID Connect providers users can sign in with, by name
+	OAuthProviders  map[string]*oidc.Provider
+	PaymentProvider payments.Provider
+	Currency        string
+	ShippingPrice   float64
 }
 
 func NewServices(deps ServicesDeps) *Services {
+	versions := NewTokenVersions(deps.Repos.Users, deps.AuthCacheTTL)
+	sessions := NewActiveSessions(deps.Repos.Sessions, deps.AuthCacheTTL)
+	roles := NewRolesService(deps.Repos.Roles, versions, deps.RequireAdmin2FA, deps.AuthCacheTTL)
+
 	return &Services{
 		Items:      NewItemsService(deps.Repos.Items),
 		Categories: NewCategoriesService(deps.Repos.Categories),
 		Colors:     NewColorsService(deps.Repos.Colors),
 		Images:     NewImagesService(deps.Repos.Images),
-		Users:      NewUsersService(deps.Repos.Users, deps.Hasher, deps.TokenManager, deps.AccessTokenTTL, deps.RefreshTokenTTL),
+		Carts:      NewCartsService(deps.Repos.Carts, deps.Repos.Items, deps.Repos.Coupons, deps.TokenManager, deps.ShippingPrice),
+		Orders:     NewOrdersService(deps.Repos.Orders, deps.Repos.Carts, deps.Repos.Users, deps.Repos.Coupons, deps.ShippingPrice),
+		Payments:   NewPaymentsService(deps.Repos.Payments, deps.Repos.Orders, deps.PaymentProvider, deps.Currency),
+		Coupons:    NewCouponsService(deps.Repos.Coupons),
+		Roles:      roles,
+		Users: NewUsersService(deps.Repos.Users, deps.Repos.Sessions, deps.Repos.UsersTokens, deps.Repos.TwoFactor, deps.Repos.Roles, deps.Repos.LoginAttempts, deps.Repos.Identities, deps.Repos.Carts,
+			versions, sessions, deps.Hasher, deps.TokenManager, deps.Mailer, deps.AccessTokenTTL, deps.RefreshTokenTTL, deps.PasswordResetTTL,
+			deps.VerificationTTL, deps.LinkBaseURL, deps.TotpIssuer, deps.MaxLoginFailures, deps.LockoutDuration, deps.OAuthProviders),
+		LoginAttempts: NewLoginAttemptsService(deps.Repos.LoginAttempts),
+		ApiKeys:       NewApiKeysService(deps.Repos.ApiKeys, roles),
+		Audit:         NewAuditService(deps.Repos.Audit),
 	}
 }
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"shop_backend/internal/models"
+	"shop_backend/internal/repository"
+	"sync"
+	"time"
+)
+
+type tokenVersion struct {
+	version  int
+	cachedAt time.Time
+}
+
+// TokenVersions checks token version of access tokens against version of user.
+// Versions are cached in memory for ttl, so revocation made by another instance
+// of the application takes effect after ttl at most, revocation made through
+// Revoke takes effect immediately
+type TokenVersions struct {
+	repo repository.Users
+	ttl  time.Duration
+
+	mu       sync.RWMutex
+	versions map[int]tokenVersion
+	sweptAt  time.Time
+}
+
+func NewTokenVersions(repo repository.Users, ttl time.Duration) *TokenVersions {
+	return &TokenVersions{
+		repo:     repo,
+		ttl:      ttl,
+		versions: make(map[int]tokenVersion),
+	}
+}
+
+// Get returns current token version of user, cached one if it is fresh
+func (v *TokenVersions) Get(ctx context.Context, userId int) (int, error) {
+	v.mu.RLock()
+	cached, ok := v.versions[userId]
+	v.mu.RUnlock()
+	if ok && time.Since(cached.cachedAt) < v.ttl {
+		return cached.version, nil
+	}
+
+	version, err := v.repo.GetTokenVersion(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	v.set(userId, version)
+
+	return version, nil
+}
+
+// Check returns models.ErrTokenRevoked if token was issued before the last
+// revocation or user does not exist anymore
+func (v *TokenVersions) Check(ctx context.Context, userId, version int) error {
+	current, err := v.Get(ctx, userId)
+	if err == models.ErrUserNotFound {
+		return models.ErrTokenRevoked
+	} else if err != nil {
+		return err
+	}
+
+	if version != current {
+		return models.ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// Revoke invalidates access tokens issued to users so far
+func (v *TokenVersions) Revoke(ctx context.Context, usersIds ...int) error {
+	for _, userId := range usersIds {
+		version, err := v.repo.IncrementTokenVersion(ctx, userId)
+		if err != nil {
+			return err
+		}
+		v.set(userId, version)
+	}
+
+	return nil
+}
+
+func (v *TokenVersions) set(userId, version int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// Expired entries are dropped once per ttl, so map does not grow with every user ever seen
+	if time.Since(v.sweptAt) >= v.ttl {
+		for id, cached := range v.versions {
+			if time.Since(cached.cachedAt) >= v.ttl {
+				delete(v.versions, id)
+			}
+		}
+		v.sweptAt = time.Now()
+	}
+	v.versions[userId] = tokenVersion{version: version, cachedAt: time.Now()}
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"shop_backend/internal/models"
+	"shop_backend/pkg/auth"
+	"shop_backend/pkg/totp"
+	"strings"
+	"time"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	// twoFactorMaxAttempts limits codes tried with one challenge token
+	twoFactorMaxAttempts = 5
+)
+
+// EnrollTwoFactor generates new TOTP secret for user. Authentication is not
+// required until enrollment is confirmed by EnableTwoFactor
+func (s *UsersService) EnrollTwoFactor(ctx context.Context, userId int) (models.TwoFactorEnrollment, error) {
+	user, err := s.repo.GetById(ctx, userId)
+	if err != nil {
+		return models.TwoFactorEnrollment{}, err
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return models.TwoFactorEnrollment{}, err
+	}
+
+	if err := s.twoFactorRepo.SetSecret(ctx, userId, secret); err != nil {
+		return models.TwoFactorEnrollment{}, err
+	}
+
+	return models.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(s.totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// EnableTwoFactor confirms enrollment with code from authenticator app and
+// returns recovery codes, which are shown to user only once
+func (s *UsersService) EnableTwoFactor(ctx context.Context, userId int, code string) ([]string, error) {
+	twoFactor, err := s.twoFactorRepo.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor.Enabled {
+		return nil, models.ErrTwoFactorEnabled
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return nil, models.ErrInvalidOneTimeCode
+	}
+
+	codes := make([]string, models.RecoveryCodesCount)
+	hashes := make([]string, models.RecoveryCodesCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = auth.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err := s.twoFactorRepo.Enable(ctx, userId, step, hashes); err != nil {
+		return nil, err
+	}
+
+	// Access tokens claim whether two-factor authentication is enabled
+	if err := s.versions.Revoke(ctx, userId); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor removes enrollment. Enabled two-factor authentication
+// requires both password and one-time code to be turned off
+func (s *UsersService) DisableTwoFactor(ctx context.Context, userId int, password, code string) error {
+	user, err := s.repo.GetById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.hasher.Verify(password, user.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return models.ErrWrongPassword
+	}
+
+	twoFactor, err := s.twoFactorRepo.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if twoFactor.Enabled {
+		if err := s.verifyOneTimeCode(ctx, twoFactor, code); err != nil {
+			return err
+		}
+	}
+
+	if err := s.twoFactorRepo.Disable(ctx, userId); err != nil {
+		return err
+	}
+
+	return s.versions.Revoke(ctx, userId)
+}
+
+// SignInTwoFactor completes sign in started by SignIn with one-time code
+// from authenticator app or one of recovery codes. Wrong codes count as
+// failed sign ins and lock account like wrong passwords do
+func (s *UsersService) SignInTwoFactor(ctx context.Context, challengeToken, code, cartToken string, device models.Device) (models.Tokens, error) {
+	challengeHash := auth.HashToken(challengeToken)
+	userId, err := s.usersTokensRepo.Attempt(ctx, models.UserTokenTwoFactor, challengeHash, twoFactorMaxAttempts)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	user, err := s.repo.GetById(ctx, userId)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+	if err := s.checkLockout(ctx, user, user.Login, device); err != nil {
+		return models.Tokens{}, err
+	}
+
+	twoFactor, err := s.twoFactorRepo.Get(ctx, userId)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+	if err := s.verifyOneTimeCode(ctx, twoFactor, code); err != nil {
+		if errors.Is(err, models.ErrInvalidOneTimeCode) {
+			if err := s.loginFailed(ctx, user, user.Login, device); err != nil {
+				return models.Tokens{}, err
+			}
+		}
+		return models.Tokens{}, err
+	}
+
+	// Challenge is single use, concurrent request may have completed it
+	if _, err := s.usersTokensRepo.Consume(ctx, models.UserTokenTwoFactor, challengeHash); err != nil {
+		return models.Tokens{}, err
+	}
+
+	if err := s.loginSucceeded(ctx, user, user.Login, device); err != nil {
+		return models.Tokens{}, err
+	}
+
+	s.mergeCart(ctx, cartToken, userId)
+
+	return s.createSession(ctx, userId, device)
+}
+
+// ChallengeLogin returns login of user signing in with two-factor challenge
+func (s *UsersService) ChallengeLogin(ctx context.Context, challengeToken string) (string, error) {
+	userId, err := s.usersTokensRepo.GetUserId(ctx, models.UserTokenTwoFactor, auth.HashToken(challengeToken))
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.repo.GetById(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Login, nil
+}
+
+// twoFactorChallenge returns challenge token if user has two-factor
+// authentication enabled, otherwise empty string
+func (s *UsersService) twoFactorChallenge(ctx context.Context, userId int) (string, error) {
+	twoFactor, err := s.twoFactorRepo.Get(ctx, userId)
+	if errors.Is(err, models.ErrTwoFactorNotEnrolled) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if !twoFactor.Enabled {
+		return "", nil
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.usersTokensRepo.Create(ctx, models.UserToken{
+		UserId:    userId,
+		Kind:      models.UserTokenTwoFactor,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(twoFactorChallengeTTL),
+	}); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// verifyOneTimeCode accepts TOTP code once or unused recovery code
+func (s *UsersService) verifyOneTimeCode(ctx context.Context, twoFactor models.TwoFactor, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+		if !ok {
+			return models.ErrInvalidOneTimeCode
+		}
+
+		return s.twoFactorRepo.UseStep(ctx, twoFactor.UserId, step)
+	}
+
+	return s.twoFactorRepo.UseRecoveryCode(ctx, twoFactor.UserId, auth.HashToken(normalizeRecoveryCode(code)))
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCode generates 50 bits code formatted as xxxxx-xxxxx
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -2,47 +2,111 @@ package service
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"shop_backend/internal/models"
 	"shop_backend/internal/repository"
 	"shop_backend/pkg/auth"
 	"shop_backend/pkg/hash"
-	"strconv"
+	"shop_backend/pkg/logger"
+	"shop_backend/pkg/mailer"
+	"shop_backend/pkg/oidc"
+	"strings"
+	"sync"
 	"time"
 )
 
 type UsersService struct {
-	repo         repository.Users
-	hasher       hash.PasswordHasher
-	tokenManager auth.TokenManager
-
-	accessTokenTTL  time.Duration
-	refreshTokenTTL time.Duration
+	repo              repository.Users
+	sessionsRepo      repository.Sessions
+	usersTokensRepo   repository.UsersTokens
+	twoFactorRepo     repository.TwoFactor
+	rolesRepo         repository.Roles
+	loginAttemptsRepo repository.LoginAttempts
+	identitiesRepo    repository.Identities
+	cartsRepo         repository.Carts
+	versions          *TokenVersions
+	sessions          *ActiveSessions
+	hasher            hash.PasswordHasher
+	tokenManager      auth.TokenManager
+	mailer            mailer.Mailer
+
+	accessTokenTTL   time.Duration
+	refreshTokenTTL  time.Duration
+	passwordResetTTL time.Duration
+	verificationTTL  time.Duration
+	linkBaseURL      string
+	totpIssuer       string
+	// maxLoginFailures consecutive failed sign ins lock account for lockoutDuration
+	maxLoginFailures int
+	lockoutDuration  time.Duration
+	// oauthProviders are OpenID Connect providers by name
+	oauthProviders map[string]*oidc.Provider
+
+	// dummyHash is verified when login is unknown, see dummyVerify
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
-func NewUsersService(repo repository.Users, hasher hash.PasswordHasher, tokenManager auth.TokenManager, accessTokenTTL, refreshTokenTTL time.Duration) *UsersService {
+func NewUsersService(repo repository.Users, sessionsRepo repository.Sessions, usersTokensRepo repository.UsersTokens,
+	twoFactorRepo repository.TwoFactor, rolesRepo repository.Roles, loginAttemptsRepo repository.LoginAttempts, identitiesRepo repository.Identities, cartsRepo repository.Carts, versions *TokenVersions, sessions *ActiveSessions, hasher hash.PasswordHasher, tokenManager auth.TokenManager,
+	mailer mailer.Mailer, accessTokenTTL, refreshTokenTTL, passwordResetTTL, verificationTTL time.Duration,
+	linkBaseURL, totpIssuer string, maxLoginFailures int, lockoutDuration time.Duration, oauthProviders map[string]*oidc.Provider) *UsersService {
 	return &UsersService{
-		repo:            repo,
-		hasher:          hasher,
-		tokenManager:    tokenManager,
-		accessTokenTTL:  accessTokenTTL,
-		refreshTokenTTL: refreshTokenTTL,
+		repo:              repo,
+		sessionsRepo:      sessionsRepo,
+		usersTokensRepo:   usersTokensRepo,
+		twoFactorRepo:     twoFactorRepo,
+		rolesRepo:         rolesRepo,
+		loginAttemptsRepo: loginAttemptsRepo,
+		identitiesRepo:    identitiesRepo,
+		cartsRepo:         cartsRepo,
+		versions:          versions,
+		sessions:          sessions,
+		hasher:            hasher,
+		tokenManager:      tokenManager,
+		mailer:            mailer,
+		accessTokenTTL:    accessTokenTTL,
+		refreshTokenTTL:   refreshTokenTTL,
+		passwordResetTTL:  passwordResetTTL,
+		verificationTTL:   verificationTTL,
+		linkBaseURL:       strings.TrimRight(linkBaseURL, "/"),
+		totpIssuer:        totpIssuer,
+		maxLoginFailures:  maxLoginFailures,
+		lockoutDuration:   lockoutDuration,
+		oauthProviders:    oauthProviders,
 	}
 }
 
-func (s *UsersService) SignUp(ctx context.Context, email, login, password string) (models.User, error) {
+func (s *UsersService) SignUp(ctx context.Context, email, login, password, cartToken string) (models.User, error) {
 	passwordHash, err := s.hasher.Hash(password)
 	if err != nil {
 		return models.User{}, err
 	}
 
-	user := models.User{
+	newUser, err := s.createUser(ctx, models.User{
 		Email:    email,
 		Login:    login,
 		Password: passwordHash,
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// Failed email must not break sign up, verification can be resent
+	if err := s.sendVerification(ctx, newUser.Id, newUser.Login, newUser.Email); err != nil {
+		logger.Errorf("failed to send verification email to user %d: %s", newUser.Id, err.Error())
 	}
 
+	s.mergeCart(ctx, cartToken, newUser.Id)
+
+	// Hide password
+	newUser.Password = ""
+
+	return newUser, err
+}
+
+// createUser creates user with empty phone and addresses
+func (s *UsersService) createUser(ctx context.Context, user models.User) (models.User, error) {
 	newUser, err := s.repo.Create(ctx, user)
 	if err != nil {
 		return models.User{}, err
@@ -61,30 +125,110 @@ func (s *UsersService) SignUp(ctx context.Context, email, login, password string
 
 	}
 
-	// Hide password
-	newUser.Password = ""
-
-	return newUser, err
+	return newUser, nil
 }
 
-func (s *UsersService) SignIn(ctx context.Context, findBy, login, password string) (models.Tokens, error) {
-	passwordHash, err := s.hasher.Hash(password)
+func (s *UsersService) SignIn(ctx context.Context, findBy, login, password, cartToken string, device models.Device) (models.Tokens, error) {
+	user, err := s.repo.GetByLogin(ctx, findBy, login)
+	if errors.Is(err, models.ErrUserNotFound) {
+		s.dummyVerify(password)
+		s.recordLoginAttempt(ctx, nil, login, device, false)
+		return models.Tokens{}, err
+	} else if err != nil {
+		return models.Tokens{}, err
+	}
+
+	if err := s.checkLockout(ctx, user, login, device); err != nil {
+		return models.Tokens{}, err
+	}
+
+	ok, err := s.hasher.Verify(password, user.Password)
 	if err != nil {
 		return models.Tokens{}, err
 	}
+	if !ok {
+		if err := s.loginFailed(ctx, user, login, device); err != nil {
+			return models.Tokens{}, err
+		}
+		return models.Tokens{}, models.ErrUserNotFound
+	}
 
-	user, err := s.repo.GetByCredentials(ctx, findBy, login, passwordHash)
+	s.rehashPassword(ctx, user, password)
+
+	// Failed sign ins are reset only once second factor succeeds, so wrong
+	// one-time codes keep counting toward lockout
+	challenge, err := s.twoFactorChallenge(ctx, user.Id)
 	if err != nil {
 		return models.Tokens{}, err
 	}
+	if challenge != "" {
+		return models.Tokens{ChallengeToken: challenge}, nil
+	}
+
+	if err := s.loginSucceeded(ctx, user, login, device); err != nil {
+		return models.Tokens{}, err
+	}
 
-	return s.createSession(ctx, user.Id)
+	s.mergeCart(ctx, cartToken, user.Id)
+
+	return s.createSession(ctx, user.Id, device)
+}
+
+// dummyVerify checks password against hash of random one, so sign in with
+// unknown login takes as long as with wrong password and does not tell
+// which accounts exist
+func (s *UsersService) dummyVerify(password string) {
+	s.dummyHashOnce.Do(func() {
+		dummy, err := auth.NewToken()
+		if err == nil {
+			s.dummyHash, err = s.hasher.Hash(dummy)
+		}
+		if err != nil {
+			logger.Errorf("failed to create dummy password hash: %s", err.Error())
+		}
+	})
+
+	if s.dummyHash != "" {
+		_, _ = s.hasher.Verify(password, s.dummyHash)
+	}
+}
+
+// rehashPassword upgrades legacy or outdated password hash after successful
+// sign in. Failed upgrade must not break authentication, so error is only logged
+func (s *UsersService) rehashPassword(ctx context.Context, user models.User, password string) {
+	if !s.hasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	passwordHash, err := s.hasher.Hash(password)
+	if err == nil {
+		err = s.repo.UpdateField(ctx, "password", passwordHash, user.Id)
+	}
+	if err != nil {
+		logger.Errorf("failed to rehash password of user %d: %s", user.Id, err.Error())
+	}
+}
+
+// mergeCart moves guest cart into user cart. Failed merge must not break
+// authentication, so error is only logged
+func (s *UsersService) mergeCart(ctx context.Context, cartToken string, userId int) {
+	if cartToken == "" {
+		return
+	}
+
+	if err := s.cartsRepo.Merge(ctx, cartToken, userId); err != nil && !errors.Is(err, models.ErrCartNotFound) {
+		logger.Errorf("failed to merge guest cart into user %d cart: %s", userId, err.Error())
+	}
 }
 
-func (s *UsersService) Logout(ctx context.Context, userId int) error {
-	if err := s.repo.DeleteSession(ctx, userId); err != nil && err != sql.ErrNoRows {
+// Logout ends only the session the user is authenticated with, access tokens
+// of other sessions keep working
+func (s *UsersService) Logout(ctx context.Context, userId, sessionId int) error {
+	if err := s.sessionsRepo.Delete(ctx, userId, sessionId); err != nil && !errors.Is(err, models.ErrSessionNotFound) {
 		return err
 	}
+	s.sessions.Revoke(sessionId)
+
 	return nil
 }
 
@@ -92,39 +236,139 @@ func (s *UsersService) DeleteMe(ctx context.Context, userId int) error {
 	return s.repo.Delete(ctx, userId)
 }
 
-func (s *UsersService) createSession(ctx context.Context, userId int) (models.Tokens, error) {
-	var (
-		res models.Tokens
-		err error
-	)
+func (s *UsersService) createSession(ctx context.Context, userId int, device models.Device) (models.Tokens, error) {
+	refreshToken, err := s.tokenManager.NewRefreshToken()
+	if err != nil {
+		return models.Tokens{}, err
+	}
 
-	res.AccessToken, err = s.tokenManager.NewJWT(strconv.Itoa(userId), s.accessTokenTTL)
+	session := models.Session{
+		UserId:       userId,
+		RefreshToken: auth.HashToken(refreshToken),
+		ExpiresAt:    time.Now().Add(s.refreshTokenTTL),
+		Device:       device,
+	}
+
+	session.Id, err = s.sessionsRepo.Create(ctx, session)
 	if err != nil {
-		return res, err
+		return models.Tokens{}, err
 	}
 
-	res.RefreshToken, err = s.tokenManager.NewRefreshToken()
+	return s.issueTokens(ctx, session, refreshToken)
+}
+
+// issueTokens pairs refresh token of session with new access token. Session
+// stores only hash, so plain refresh token is passed separately
+func (s *UsersService) issueTokens(ctx context.Context, session models.Session, refreshToken string) (models.Tokens, error) {
+	claims, err := s.claims(ctx, session)
 	if err != nil {
-		return res, err
+		return models.Tokens{}, err
 	}
 
-	session := models.Session{
-		RefreshToken: res.RefreshToken,
+	accessToken, err := s.tokenManager.NewJWT(claims, s.accessTokenTTL)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	return models.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// RefreshTokens rotates refresh token of the session it belongs to. Replayed
+// refresh token revokes the whole session
+func (s *UsersService) RefreshTokens(ctx context.Context, refreshToken string, device models.Device) (models.Tokens, error) {
+	newRefreshToken, err := s.tokenManager.NewRefreshToken()
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	session, err := s.sessionsRepo.Rotate(ctx, auth.HashToken(refreshToken), models.Session{
+		RefreshToken: auth.HashToken(newRefreshToken),
 		ExpiresAt:    time.Now().Add(s.refreshTokenTTL),
+		Device:       device,
+	})
+	if err != nil {
+		return models.Tokens{}, err
+	}
+
+	return s.issueTokens(ctx, session, newRefreshToken)
+}
+
+// claims collects everything access token of session needs for authorization
+func (s *UsersService) claims(ctx context.Context, session models.Session) (auth.Claims, error) {
+	version, err := s.repo.GetTokenVersion(ctx, session.UserId)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	roles, err := s.rolesRepo.GetByUser(ctx, session.UserId)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	twoFactor, err := s.twoFactorRepo.Get(ctx, session.UserId)
+	if err != nil && !errors.Is(err, models.ErrTwoFactorNotEnrolled) {
+		return auth.Claims{}, err
+	}
+
+	claims := auth.Claims{
+		UserId:       session.UserId,
+		SessionId:    session.Id,
+		TokenVersion: version,
+		TwoFactor:    twoFactor.Enabled,
+	}
+	for _, role := range roles {
+		claims.Roles = append(claims.Roles, role.Name)
+	}
+
+	return claims, nil
+}
+
+// CheckToken rejects access token issued before tokens of user were revoked
+// or which session has ended
+func (s *UsersService) CheckToken(ctx context.Context, claims auth.Claims) error {
+	if err := s.versions.Check(ctx, claims.UserId, claims.TokenVersion); err != nil {
+		return err
 	}
 
-	err = s.repo.SetSession(ctx, userId, session)
+	return s.sessions.Check(ctx, claims.SessionId)
+}
+
+// GetSessions returns active sessions of user with the current one marked
+func (s *UsersService) GetSessions(ctx context.Context, userId, currentId int) ([]models.Session, error) {
+	sessions, err := s.sessionsRepo.GetByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == currentId
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends session along with its access token, other sessions of
+// user are not affected
+func (s *UsersService) RevokeSession(ctx context.Context, userId, sessionId int) error {
+	if err := s.sessionsRepo.Delete(ctx, userId, sessionId); err != nil {
+		return err
+	}
+	s.sessions.Revoke(sessionId)
 
-	return res, err
+	return nil
 }
 
-func (s *UsersService) RefreshTokens(ctx context.Context, refreshToken string) (models.Tokens, error) {
-	user, err := s.repo.GetByRefreshToken(ctx, refreshToken)
+func (s *UsersService) RevokeOtherSessions(ctx context.Context, userId, currentId int) error {
+	sessionsIds, err := s.sessionsRepo.DeleteOthers(ctx, userId, currentId)
 	if err != nil {
-		return models.Tokens{}, err
+		return err
 	}
+	s.sessions.Revoke(sessionsIds...)
 
-	return s.createSession(ctx, user.Id)
+	return nil
 }
 
 func (s *UsersService) GetMe(ctx context.Context, userId int) (models.User, error) {
@@ -159,28 +403,37 @@ func (s *UsersService) GetMe(ctx context.Context, userId int) (models.User, erro
 		user.Phone = phoneCode + phoneNumber
 	}
 
+	twoFactor, err := s.twoFactorRepo.Get(ctx, user.Id)
+	if err != nil && !errors.Is(err, models.ErrTwoFactorNotEnrolled) {
+		return models.User{}, err
+	}
+	user.TwoFactorEnabled = twoFactor.Enabled
+
+	roles, err := s.rolesRepo.GetByUser(ctx, user.Id)
+	if err != nil {
+		return models.User{}, err
+	}
+	for _, role := range roles {
+		user.Roles = append(user.Roles, role.Name)
+	}
+
 	// Hide password
 	user.Password = ""
 
 	return user, nil
 }
 
-func (s *UsersService) UpdateEmail(ctx context.Context, userId int, email string) error {
-	return s.repo.UpdateField(ctx, "email", email, userId)
-}
-
 func (s *UsersService) UpdatePassword(ctx context.Context, userId int, oldPassword, newPassword string) error {
 	user, err := s.repo.GetById(ctx, userId)
 	if err != nil {
 		return err
 	}
 
-	oldPasswordHash, err := s.hasher.Hash(oldPassword)
+	ok, err := s.hasher.Verify(oldPassword, user.Password)
 	if err != nil {
 		return err
 	}
-
-	if oldPasswordHash != user.Password {
+	if !ok {
 		return models.ErrOldPassword
 	}
 
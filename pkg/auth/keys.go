@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+)
+
+const minRSAKeyBits = 2048
+
+var ErrUnsupportedKey = errors.New("unsupported key, RSA of at least 2048 bits or Ed25519 is expected")
+
+// Key is asymmetric key identified by kid header of tokens. Keys without
+// private part only verify tokens, they are kept after rotation until tokens
+// signed with them expire
+type Key struct {
+	Id      string
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// ParsePrivateKey parses PKCS#8 or PKCS#1 PEM encoded private key
+func ParsePrivateKey(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %s: no PEM data found", id)
+	}
+
+	var private interface{}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if private, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return Key{}, fmt.Errorf("key %s: %w", id, err)
+		}
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return Key{}, fmt.Errorf("key %s: %w", id, ErrUnsupportedKey)
+	}
+
+	return newKey(id, signer, signer.Public())
+}
+
+// ParsePublicKey parses PKIX or PKCS#1 PEM encoded public key
+func ParsePublicKey(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %s: no PEM data found", id)
+	}
+
+	var public interface{}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		if public, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+			return Key{}, fmt.Errorf("key %s: %w", id, err)
+		}
+	}
+
+	return newKey(id, nil, public)
+}
+
+// GenerateKey generates Ed25519 key. Tokens signed with it cannot be
+// verified after restart, so it is meant for development only
+func GenerateKey(id string) (Key, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, err
+	}
+
+	return newKey(id, private, public)
+}
+
+func newKey(id string, private crypto.Signer, public crypto.PublicKey) (Key, error) {
+	if id == "" {
+		return Key{}, errors.New("key id is empty")
+	}
+
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSAKeyBits {
+			return Key{}, fmt.Errorf("key %s: %w", id, ErrUnsupportedKey)
+		}
+	case ed25519.PublicKey:
+	default:
+		return Key{}, fmt.Errorf("key %s: %w", id, ErrUnsupportedKey)
+	}
+
+	return Key{Id: id, Private: private, Public: public}, nil
+}
+
+// method returns signing method matching type of key
+func (k Key) method() jwt.SigningMethod {
+	if _, ok := k.Public.(*rsa.PublicKey); ok {
+		return jwt.SigningMethodRS256
+	}
+
+	return jwt.SigningMethodEdDSA
+}
+
+// JWK is public key in JSON Web Key format, RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 curve and public key
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k Key) JWK() JWK {
+	jwk := JWK{
+		Use: "sig",
+		Alg: k.method().Alg(),
+		Kid: k.Id,
+	}
+
+	switch public := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+
+	return jwk
+}
@@ -1,68 +1,153 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt"
-	"math/rand"
+	"sort"
+	"strconv"
 	"time"
 )
 
+// Claims of access token. They carry everything needed to authorize request,
+// so access token is checked without database lookups
+type Claims struct {
+	UserId    int      `json:"uid"`
+	SessionId int      `json:"sid"`
+	Roles     []string `json:"roles,omitempty"`
+	// TokenVersion is compared with version of user to reject tokens
+	// issued before revocation
+	TokenVersion int `json:"ver"`
+	// TwoFactor is set if user has two-factor authentication enabled
+	TwoFactor bool `json:"tfa,omitempty"`
+	jwt.StandardClaims
+}
+
+func (c Claims) Valid() error {
+	if c.UserId == 0 {
+		return errors.New("token has no user claim")
+	}
+
+	return c.StandardClaims.Valid()
+}
+
 type TokenManager interface {
-	NewJWT(userId string, ttl time.Duration) (string, error)
-	Parse(accessToken string) (string, error)
+	NewJWT(claims Claims, ttl time.Duration) (string, error)
+	// Parse returns claims of valid access token
+	Parse(accessToken string) (Claims, error)
+	// JWKS returns public keys access tokens can be verified with
+	JWKS() JWKS
 	NewRefreshToken() (string, error)
+	NewCartToken() (string, error)
 }
 
+// Manager signs access tokens with one key and verifies them with any of
+// known keys, chosen by kid header. Keys are rotated in three steps:
+//
+//  1. new key is added, so it is published by JWKS before any token is
+//     signed with it and other services can refresh their copy
+//  2. new key becomes signing key, old key may lose its private part
+//  3. old key is removed once access tokens signed with it have expired
 type Manager struct {
-	signingKey string
+	signingKey Key
+	keys       map[string]Key
 }
 
-func NewManager(signingKey string) (*Manager, error) {
-	if signingKey == "" {
-		return nil, errors.New("empty signing key")
+func NewManager(signingKeyId string, keys []Key) (*Manager, error) {
+	m := &Manager{keys: make(map[string]Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := m.keys[key.Id]; ok {
+			return nil, fmt.Errorf("duplicate key %s", key.Id)
+		}
+		m.keys[key.Id] = key
+	}
+
+	signingKey, ok := m.keys[signingKeyId]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found", signingKeyId)
+	}
+	if signingKey.Private == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", signingKeyId)
 	}
+	m.signingKey = signingKey
 
-	return &Manager{signingKey: signingKey}, nil
+	return m, nil
 }
 
-func (m *Manager) NewJWT(userId string, ttl time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+func (m *Manager) NewJWT(claims Claims, ttl time.Duration) (string, error) {
+	claims.StandardClaims = jwt.StandardClaims{
 		ExpiresAt: time.Now().Add(ttl).Unix(),
-		Subject:   userId,
-	})
+		Subject:   strconv.Itoa(claims.UserId),
+		Id:        strconv.Itoa(claims.SessionId),
+	}
+	token := jwt.NewWithClaims(m.signingKey.method(), claims)
+	token.Header["kid"] = m.signingKey.Id
 
-	return token.SignedString([]byte(m.signingKey))
+	return token.SignedString(m.signingKey.Private)
 }
-func (m *Manager) Parse(accessToken string) (string, error) {
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+
+func (m *Manager) Parse(accessToken string) (Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(accessToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := m.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key")
+		}
+
+		// Algorithm is fixed by key, alg header alone is never trusted
+		if token.Method.Alg() != key.method().Alg() {
 			return nil, fmt.Errorf("unexpected signing method")
 		}
 
-		return []byte(m.signingKey), nil
+		return key.Public, nil
 	})
 	if err != nil {
-		return "", err
+		return Claims{}, err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", fmt.Errorf("error get user claims from token")
+	return claims, nil
+}
+
+func (m *Manager) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(m.keys))}
+	for _, key := range m.keys {
+		jwks.Keys = append(jwks.Keys, key.JWK())
 	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
 
-	return claims["sub"].(string), nil
+	return jwks
 }
 
+// NewRefreshToken generates opaque refresh token. Only HashToken result
+// of it should be stored
 func (m *Manager) NewRefreshToken() (string, error) {
-	b := make([]byte, 32)
+	return NewToken()
+}
+
+// NewCartToken generates opaque token identifying guest cart
+func (m *Manager) NewCartToken() (string, error) {
+	return NewToken()
+}
 
-	s := rand.NewSource(time.Now().Unix())
-	r := rand.New(s)
+// HashToken returns hex encoded SHA-256 of token. Tokens are random and long
+// enough, so neither salt nor slow hash is needed to protect them at rest
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	if _, err := r.Read(b); err != nil {
+// NewToken generates random opaque token of 256 bits encoded as hex
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%x", b), nil
+	return hex.EncodeToString(b), nil
 }
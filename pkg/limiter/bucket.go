@@ -0,0 +1,46 @@
+package limiter
+
+import (
+	"context"
+	"time"
+)
+
+// Bucket is state of token bucket after taking token from it
+type Bucket struct {
+	Capacity  int
+	Remaining int
+	// RetryAfter is zero if token was taken, otherwise time until one is available
+	RetryAfter time.Duration
+	// ResetAfter is time until bucket is full again
+	ResetAfter time.Duration
+}
+
+func (b Bucket) Allowed() bool {
+	return b.RetryAfter == 0
+}
+
+// TokenBucket allows bursts of up to capacity requests and limit requests
+// per period on average
+type TokenBucket struct {
+	store    Store
+	capacity int
+	rate     float64
+}
+
+// NewTokenBucket creates bucket refilled with limit tokens per period. Zero
+// capacity means capacity equal to limit
+func NewTokenBucket(store Store, limit int, period time.Duration, capacity int) *TokenBucket {
+	if capacity <= 0 {
+		capacity = limit
+	}
+
+	return &TokenBucket{
+		store:    store,
+		capacity: capacity,
+		rate:     float64(limit) / period.Seconds(),
+	}
+}
+
+func (b *TokenBucket) Take(ctx context.Context, key string) (Bucket, error) {
+	return b.store.Take(ctx, key, b.capacity, b.rate)
+}
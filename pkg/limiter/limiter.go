@@ -0,0 +1,102 @@
+package limiter
+
+import (
+	"context"
+	"time"
+)
+
+// Counter is number of hits of key in current window
+type Counter struct {
+	Count   int
+	LastHit time.Time
+	// PrevHit is time of hit before the last one, zero for the first hit
+	PrevHit time.Time
+	ResetAt time.Time
+}
+
+// Store keeps counters of hits in fixed windows. Store shared by instances of
+// the application makes limits apply to all of them
+type Store interface {
+	// Incr counts hit of key and returns updated counter, new window is
+	// started if there is no current one
+	Incr(ctx context.Context, key string, window time.Duration) (Counter, error)
+	// Decr takes back the last hit of key counted by Incr
+	Decr(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+	// Take takes one token from bucket of key holding up to capacity tokens
+	// and refilled at rate tokens per second. New bucket starts full
+	Take(ctx context.Context, key string, capacity int, rate float64) (Bucket, error)
+}
+
+// Limiter allows limit hits of key per window. With delay set, each hit also
+// postpones the next one allowed, the delay doubles with every hit up to maxDelay
+type Limiter struct {
+	store    Store
+	limit    int
+	window   time.Duration
+	delay    time.Duration
+	maxDelay time.Duration
+}
+
+func New(store Store, limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		store:  store,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// WithDelay enables progressive delay between hits
+func (l *Limiter) WithDelay(delay, maxDelay time.Duration) *Limiter {
+	l.delay = delay
+	l.maxDelay = maxDelay
+
+	return l
+}
+
+// Reserve counts hit of key and returns zero if it is allowed, otherwise the
+// hit is taken back and how long key has to wait is returned. Hit is counted
+// before it is checked, so concurrent hits cannot all pass the check. Allowed
+// hit which should not count can be given back with Release. Zero limit
+// disables limit, not delay
+func (l *Limiter) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	counter, err := l.store.Incr(ctx, key, l.window)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	if l.limit > 0 && counter.Count > l.limit {
+		wait = counter.ResetAt.Sub(now)
+	} else if l.delay > 0 && counter.Count > 1 {
+		wait = counter.PrevHit.Add(l.delayAfter(counter.Count - 1)).Sub(now)
+	}
+
+	if wait <= 0 {
+		return 0, nil
+	}
+
+	return wait, l.store.Decr(ctx, key)
+}
+
+func (l *Limiter) delayAfter(count int) time.Duration {
+	delay := l.delay
+	for i := 1; i < count; i++ {
+		delay *= 2
+		if l.maxDelay > 0 && delay >= l.maxDelay {
+			return l.maxDelay
+		}
+	}
+
+	return delay
+}
+
+// Release gives back hit counted by Reserve
+func (l *Limiter) Release(ctx context.Context, key string) error {
+	return l.store.Decr(ctx, key)
+}
+
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, key)
+}
@@ -0,0 +1,104 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		capacity  int
+		takes     int
+		allowed   int
+		remaining int
+	}{
+		{name: "within capacity", limit: 5, takes: 3, allowed: 3, remaining: 2},
+		{name: "capacity defaults to limit", limit: 3, takes: 5, allowed: 3, remaining: 0},
+		{name: "burst above limit", limit: 2, capacity: 4, takes: 5, allowed: 4, remaining: 0},
+		{name: "burst below limit", limit: 10, capacity: 1, takes: 2, allowed: 1, remaining: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Refill is slow enough for no token to come back during test
+			bucket := NewTokenBucket(NewMemoryStore(), tt.limit, time.Hour, tt.capacity)
+
+			var allowed int
+			var last Bucket
+			for i := 0; i < tt.takes; i++ {
+				b, err := bucket.Take(context.Background(), "key")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if b.Allowed() {
+					allowed++
+				} else if b.RetryAfter <= 0 {
+					t.Fatalf("retry after = %s for denied take, want positive", b.RetryAfter)
+				}
+				last = b
+			}
+
+			if allowed != tt.allowed {
+				t.Fatalf("allowed %d takes, want %d", allowed, tt.allowed)
+			}
+			if last.Remaining != tt.remaining {
+				t.Fatalf("remaining = %d, want %d", last.Remaining, tt.remaining)
+			}
+			if last.ResetAfter <= 0 {
+				t.Fatalf("reset after = %s, want positive", last.ResetAfter)
+			}
+
+			// Buckets of other keys are independent
+			if b, err := bucket.Take(context.Background(), "other"); err != nil || !b.Allowed() {
+				t.Fatalf("take of other key = %+v, %v, want allowed", b, err)
+			}
+		})
+	}
+}
+
+func TestLimiterReserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		hits    int
+		release int
+		allowed int
+	}{
+		{name: "within limit", limit: 3, hits: 3, allowed: 3},
+		{name: "above limit", limit: 2, hits: 4, allowed: 2},
+		{name: "released hits do not count", limit: 2, hits: 4, release: 2, allowed: 4},
+		{name: "no limit", limit: 0, hits: 5, allowed: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := New(NewMemoryStore(), tt.limit, time.Hour)
+
+			var allowed, released int
+			for i := 0; i < tt.hits; i++ {
+				wait, err := limiter.Reserve(context.Background(), "key")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if wait > 0 {
+					continue
+				}
+				allowed++
+
+				if released < tt.release {
+					if err := limiter.Release(context.Background(), "key"); err != nil {
+						t.Fatal(err)
+					}
+					released++
+				}
+			}
+
+			if allowed != tt.allowed {
+				t.Fatalf("allowed %d hits, want %d", allowed, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucketState struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+// MemoryStore keeps counters and buckets in memory of single instance
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]Counter
+	buckets  map[string]bucketState
+	sweptAt  time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters: make(map[string]Counter),
+		buckets:  make(map[string]bucketState),
+	}
+}
+
+func (s *MemoryStore) Incr(ctx context.Context, key string, window time.Duration) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	counter, ok := s.counters[key]
+	if !ok || !now.Before(counter.ResetAt) {
+		counter = Counter{ResetAt: now.Add(window)}
+	}
+	counter.Count++
+	counter.PrevHit = counter.LastHit
+	counter.LastHit = now
+	s.counters[key] = counter
+
+	return counter, nil
+}
+
+func (s *MemoryStore) Decr(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[key]
+	if !ok || !time.Now().Before(counter.ResetAt) {
+		return nil
+	}
+
+	counter.Count--
+	if counter.Count <= 0 {
+		delete(s.counters, key)
+		return nil
+	}
+	counter.LastHit = counter.PrevHit
+	s.counters[key] = counter
+
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, key)
+
+	return nil
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, capacity int, rate float64) (Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	state, ok := s.buckets[key]
+	if !ok || !now.Before(state.fullAt) {
+		state = bucketState{tokens: float64(capacity), updatedAt: now}
+	}
+
+	tokens := math.Min(float64(capacity), state.tokens+now.Sub(state.updatedAt).Seconds()*rate)
+
+	var retryAfter time.Duration
+	if tokens >= 1 {
+		tokens--
+	} else {
+		retryAfter = seconds((1 - tokens) / rate)
+	}
+
+	resetAfter := seconds((float64(capacity) - tokens) / rate)
+	s.buckets[key] = bucketState{tokens: tokens, updatedAt: now, fullAt: now.Add(resetAfter)}
+
+	return Bucket{
+		Capacity:   capacity,
+		Remaining:  int(tokens),
+		RetryAfter: retryAfter,
+		ResetAfter: resetAfter,
+	}, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// sweep drops expired counters and full buckets at most once a minute
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.sweptAt) < time.Minute {
+		return
+	}
+
+	for key, counter := range s.counters {
+		if !now.Before(counter.ResetAt) {
+			delete(s.counters, key)
+		}
+	}
+	for key, state := range s.buckets {
+		if !now.Before(state.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+	s.sweptAt = now
+}
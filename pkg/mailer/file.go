@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMailer writes messages to file or stdout instead of delivering them.
+// It is meant for local development and tests
+type FileMailer struct {
+	mu   sync.Mutex
+	out  io.Writer
+	from string
+}
+
+// NewFileMailer appends messages to file at path, empty path means stdout
+func NewFileMailer(path, from string) (*FileMailer, error) {
+	if path == "" {
+		return &FileMailer{out: os.Stdout, from: from}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{out: file, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.out, "----- %s\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), m.from, msg.To, msg.Subject, strings.TrimSpace(msg.Body))
+
+	return err
+}
@@ -0,0 +1,264 @@
+package oidc
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mockKeyId    = "mock"
+	mockCodeTTL  = time.Minute
+	mockTokenTTL = 5 * time.Minute
+)
+
+// MockIssuer is local OpenID Connect provider for development and tests. Its
+// sign in page approves at once as user with email from login_hint, or default
+// email, which is always verified. Subject is derived from email, so the same
+// email is always the same user. Issuer address may be left empty, then it is
+// taken from request host, which suits httptest servers
+type MockIssuer struct {
+	issuer       string
+	clientId     string
+	clientSecret string
+	email        string
+	key          ed25519.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	email       string
+	redirectURL string
+	challenge   string
+	nonce       string
+	expiresAt   time.Time
+}
+
+func NewMockIssuer(issuer, clientId, clientSecret, email string) (*MockIssuer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if email == "" {
+		email = "user@example.com"
+	}
+
+	return &MockIssuer{
+		issuer:       strings.TrimRight(issuer, "/"),
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		email:        email,
+		key:          key,
+		codes:        make(map[string]mockCode),
+	}, nil
+}
+
+func (m *MockIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	issuer := m.issuerFor(r)
+	issuerPath := ""
+	if u, err := url.Parse(issuer); err == nil {
+		issuerPath = u.Path
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, issuerPath) {
+	case discoveryPath:
+		writeJSON(w, http.StatusOK, metadata{
+			Issuer:                issuer,
+			AuthorizationEndpoint: issuer + "/authorize",
+			TokenEndpoint:         issuer + "/token",
+			JWKSURI:               issuer + "/jwks",
+		})
+	case "/authorize":
+		m.authorize(w, r)
+	case "/token":
+		m.token(w, r, issuer)
+	case "/jwks":
+		writeJSON(w, http.StatusOK, jwks{Keys: []jwk{{
+			Kty: "OKP",
+			Kid: mockKeyId,
+			Use: "sig",
+			Alg: jwt.SigningMethodEdDSA.Alg(),
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(m.key.Public().(ed25519.PublicKey)),
+		}}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *MockIssuer) issuerFor(r *http.Request) string {
+	if m.issuer != "" {
+		return m.issuer
+	}
+
+	return "http://" + r.Host
+}
+
+// authorize issues code at once and redirects back to client
+func (m *MockIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURL := query.Get("redirect_uri")
+	switch {
+	case query.Get("client_id") != m.clientId:
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	case redirectURL == "":
+		http.Error(w, "redirect_uri is required", http.StatusBadRequest)
+		return
+	case query.Get("response_type") != "code":
+		http.Error(w, "only code response type is supported", http.StatusBadRequest)
+		return
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		http.Error(w, "S256 code challenge is required", http.StatusBadRequest)
+		return
+	}
+
+	email := query.Get("login_hint")
+	if email == "" {
+		email = m.email
+	}
+
+	code, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m.mu.Lock()
+	for c, issued := range m.codes {
+		if time.Now().After(issued.expiresAt) {
+			delete(m.codes, c)
+		}
+	}
+	m.codes[code] = mockCode{
+		email:       email,
+		redirectURL: redirectURL,
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		expiresAt:   time.Now().Add(mockCodeTTL),
+	}
+	m.mu.Unlock()
+
+	target, err := url.Parse(redirectURL)
+	if err != nil {
+		http.Error(w, "wrong redirect_uri", http.StatusBadRequest)
+		return
+	}
+	values := target.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	target.RawQuery = values.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// token exchanges code for signed id token, code can be used once
+func (m *MockIssuer) token(w http.ResponseWriter, r *http.Request, issuer string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, "invalid_request")
+		return
+	}
+	if !m.authenticateClient(r) {
+		writeJSON(w, http.StatusUnauthorized, tokenResponse{Error: "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeTokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	m.mu.Lock()
+	code, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	switch {
+	case !ok || time.Now().After(code.expiresAt),
+		code.redirectURL != r.PostForm.Get("redirect_uri"),
+		Challenge(r.PostForm.Get("code_verifier")) != code.challenge:
+		writeTokenError(w, "invalid_grant")
+		return
+	}
+
+	subject := sha256.Sum256([]byte(code.email))
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"iss":            issuer,
+		"sub":            hex.EncodeToString(subject[:10]),
+		"aud":            m.clientId,
+		"exp":            now.Add(mockTokenTTL).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          code.nonce,
+		"email":          code.email,
+		"email_verified": true,
+		"name":           strings.SplitN(code.email, "@", 2)[0],
+	})
+	token.Header["kid"] = mockKeyId
+
+	var accessToken string
+	idToken, err := token.SignedString(m.key)
+	if err == nil {
+		accessToken, err = randomString()
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, tokenResponse{Error: "server_error", ErrorDescription: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(mockTokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// authenticateClient accepts secret in basic authorization or in form
+func (m *MockIssuer) authenticateClient(r *http.Request) bool {
+	clientId, secret, ok := r.BasicAuth()
+	if ok {
+		clientId, _ = url.QueryUnescape(clientId)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientId, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	return clientId == m.clientId && subtle.ConstantTimeCompare([]byte(secret), []byte(m.clientSecret)) == 1
+}
+
+func writeTokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, tokenResponse{Error: code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() (string, error) {
+	data := make([]byte, 24)
+	if _, err := rand.Read(data); err != nil {
+		return "", errors.New("failed to generate code")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
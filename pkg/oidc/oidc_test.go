@@ -0,0 +1,122 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const testRedirectURL = "http://shop.test/oauth/mock/callback"
+
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+
+	issuer, err := NewMockIssuer("", "shop", "secret", "default@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(issuer)
+	t.Cleanup(srv.Close)
+
+	provider, err := NewProvider(Config{
+		Issuer:       srv.URL,
+		ClientId:     "shop",
+		ClientSecret: "secret",
+		RedirectURL:  testRedirectURL,
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return provider
+}
+
+// authorize goes through sign in page like browser does and returns code
+// provider redirected back with
+func authorize(t *testing.T, provider *Provider, state, nonce, verifier, loginHint string) string {
+	t.Helper()
+
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, Challenge(verifier), loginHint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Query().Get("state"); got != state {
+		t.Fatalf("state = %q, want %q", got, state)
+	}
+
+	return location.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	provider := newTestProvider(t)
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := authorize(t, provider, "state", "nonce", verifier, "user@example.com")
+	identity, err := provider.Exchange(context.Background(), code, verifier, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Email != "user@example.com" || !identity.EmailVerified || identity.Subject == "" {
+		t.Fatalf("identity = %+v, want verified user@example.com", identity)
+	}
+
+	// Code is single use
+	if _, err := provider.Exchange(context.Background(), code, verifier, "nonce"); !errors.Is(err, ErrExchange) {
+		t.Fatalf("reused code error = %v, want %v", err, ErrExchange)
+	}
+}
+
+func TestExchangePKCE(t *testing.T) {
+	provider := newTestProvider(t)
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherVerifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Intercepted code is useless without verifier
+	code := authorize(t, provider, "state", "nonce", verifier, "")
+	if _, err := provider.Exchange(context.Background(), code, otherVerifier, "nonce"); !errors.Is(err, ErrExchange) {
+		t.Fatalf("wrong verifier error = %v, want %v", err, ErrExchange)
+	}
+}
+
+func TestExchangeNonce(t *testing.T) {
+	provider := newTestProvider(t)
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Id token issued for another sign in is rejected
+	code := authorize(t, provider, "state", "nonce", verifier, "")
+	if _, err := provider.Exchange(context.Background(), code, verifier, "other nonce"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("wrong nonce error = %v, want %v", err, ErrInvalidToken)
+	}
+}
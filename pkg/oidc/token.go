@@ -0,0 +1,138 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"time"
+)
+
+// clockSkew is tolerated difference between clocks of provider and ours
+const clockSkew = time.Minute
+
+// idTokenClaims are claims of id token. Standard claims of jwt package are not
+// used, they do not allow audience to be a list
+type idTokenClaims struct {
+	Issuer        string    `json:"iss"`
+	Subject       string    `json:"sub"`
+	Audience      audience  `json:"aud"`
+	ExpiresAt     int64     `json:"exp"`
+	IssuedAt      int64     `json:"iat"`
+	Nonce         string    `json:"nonce"`
+	Email         string    `json:"email"`
+	EmailVerified claimBool `json:"email_verified"`
+	Name          string    `json:"name"`
+}
+
+func (c idTokenClaims) Valid() error {
+	now := time.Now()
+	if c.Subject == "" {
+		return errors.New("subject is missing")
+	}
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return errors.New("token is expired")
+	}
+	if c.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)) {
+		return errors.New("token is issued in the future")
+	}
+
+	return nil
+}
+
+// audience is single audience or list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+
+	return nil
+}
+
+func (a audience) contains(clientId string) bool {
+	for _, aud := range a {
+		if aud == clientId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// claimBool is boolean which some providers send as string
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	case "false", `"false"`, "null":
+		*b = false
+	default:
+		return fmt.Errorf("wrong boolean %s", data)
+	}
+
+	return nil
+}
+
+// verify checks signature of id token with provider keys, then issuer,
+// audience and nonce of the authentication request
+func (p *Provider) verify(ctx context.Context, m *metadata, rawToken, nonce string) (Identity, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(rawToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.keys.get(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// Algorithm of token must fit the key, otherwise key could be misused
+		var fits bool
+		switch key.(type) {
+		case *rsa.PublicKey:
+			_, fits = token.Method.(*jwt.SigningMethodRSA)
+		case *ecdsa.PublicKey:
+			_, fits = token.Method.(*jwt.SigningMethodECDSA)
+		case ed25519.PublicKey:
+			_, fits = token.Method.(*jwt.SigningMethodEd25519)
+		}
+		if !fits {
+			return nil, fmt.Errorf("algorithm %s does not fit key %q", token.Method.Alg(), kid)
+		}
+
+		return key, nil
+	})
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+	}
+
+	switch {
+	case claims.Issuer != m.Issuer:
+		return Identity{}, fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	case !claims.Audience.contains(p.cfg.ClientId):
+		return Identity{}, fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	case claims.Nonce != nonce:
+		return Identity{}, fmt.Errorf("%w: wrong nonce", ErrInvalidToken)
+	}
+
+	return Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
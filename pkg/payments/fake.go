@@ -0,0 +1,158 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+const fakeProviderName = "fake"
+
+// FakeProvider is in-memory sandbox provider. Payment is completed by calling
+// Confirm, which produces webhook event signed with provider secret
+type FakeProvider struct {
+	mu         sync.Mutex
+	intents    map[string]*Intent
+	secret     []byte
+	confirmURL string
+}
+
+func NewFakeProvider(secret, confirmURL string) (*FakeProvider, error) {
+	if secret == "" {
+		return nil, errors.New("empty webhook secret")
+	}
+
+	return &FakeProvider{
+		intents:    make(map[string]*Intent),
+		secret:     []byte(secret),
+		confirmURL: confirmURL,
+	}, nil
+}
+
+func (p *FakeProvider) Name() string {
+	return fakeProviderName
+}
+
+func (p *FakeProvider) CreateIntent(ctx context.Context, amount int64, currency, reference string) (Intent, error) {
+	id, err := randomId("fake_pi_")
+	if err != nil {
+		return Intent{}, err
+	}
+
+	intent := &Intent{
+		Id:         id,
+		Amount:     amount,
+		Currency:   currency,
+		Status:     StatusRequiresConfirmation,
+		Reference:  reference,
+		ConfirmURL: p.confirmURL + "/" + id + "/confirm",
+	}
+
+	p.mu.Lock()
+	p.intents[id] = intent
+	p.mu.Unlock()
+
+	return *intent, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, intentId string) (Intent, error) {
+	return p.transition(intentId, StatusAuthorized, StatusSucceeded)
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, intentId string, amount int64) (Intent, error) {
+	p.mu.Lock()
+	intent, ok := p.intents[intentId]
+	p.mu.Unlock()
+	if !ok {
+		return Intent{}, ErrIntentNotFound
+	}
+	if amount != intent.Amount {
+		return Intent{}, errors.New("partial refunds are not supported")
+	}
+
+	return p.transition(intentId, StatusSucceeded, StatusRefunded)
+}
+
+// Confirm simulates customer completing or declining payment
+func (p *FakeProvider) Confirm(ctx context.Context, intentId string, succeed bool) ([]byte, string, error) {
+	status, eventType := StatusAuthorized, EventAuthorized
+	if !succeed {
+		status, eventType = StatusFailed, EventFailed
+	}
+
+	intent, err := p.transition(intentId, StatusRequiresConfirmation, status)
+	if err != nil {
+		return nil, "", err
+	}
+
+	eventId, err := randomId("fake_evt_")
+	if err != nil {
+		return nil, "", err
+	}
+
+	payload, err := json.Marshal(Event{
+		Id:       eventId,
+		Type:     eventType,
+		IntentId: intent.Id,
+		Amount:   intent.Amount,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return payload, p.sign(payload), nil
+}
+
+func (p *FakeProvider) HandleWebhook(payload []byte, signature string) (Event, error) {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, p.mac(payload)) {
+		return Event{}, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+func (p *FakeProvider) transition(intentId string, from, to Status) (Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentId]
+	if !ok {
+		return Intent{}, ErrIntentNotFound
+	}
+	if intent.Status != from {
+		return Intent{}, ErrWrongStatus
+	}
+	intent.Status = to
+
+	return *intent, nil
+}
+
+func (p *FakeProvider) sign(payload []byte) string {
+	return hex.EncodeToString(p.mac(payload))
+}
+
+func (p *FakeProvider) mac(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func randomId(prefix string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return prefix + hex.EncodeToString(b), nil
+}
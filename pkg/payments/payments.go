@@ -0,0 +1,63 @@
+package payments
+
+import (
+	"context"
+	"errors"
+)
+
+type Status string
+
+const (
+	StatusRequiresConfirmation Status = "requires_confirmation"
+	StatusAuthorized           Status = "authorized"
+	StatusSucceeded            Status = "succeeded"
+	StatusFailed               Status = "failed"
+	StatusRefunded             Status = "refunded"
+)
+
+type EventType string
+
+const (
+	EventAuthorized EventType = "payment.authorized"
+	EventFailed     EventType = "payment.failed"
+	EventRefunded   EventType = "payment.refunded"
+)
+
+var (
+	ErrIntentNotFound   = errors.New("payment intent not found")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrWrongStatus      = errors.New("wrong payment intent status")
+)
+
+// Intent is provider side payment of amount in minor currency units
+type Intent struct {
+	Id         string `json:"id"`
+	Amount     int64  `json:"amount"`
+	Currency   string `json:"currency"`
+	Status     Status `json:"status"`
+	Reference  string `json:"reference"`
+	ConfirmURL string `json:"confirmUrl,omitempty"`
+}
+
+// Event is notification sent by provider to webhook
+type Event struct {
+	Id       string    `json:"id"`
+	Type     EventType `json:"type"`
+	IntentId string    `json:"intentId"`
+	Amount   int64     `json:"amount"`
+}
+
+type Provider interface {
+	Name() string
+	CreateIntent(ctx context.Context, amount int64, currency, reference string) (Intent, error)
+	Capture(ctx context.Context, intentId string) (Intent, error)
+	Refund(ctx context.Context, intentId string, amount int64) (Intent, error)
+	// HandleWebhook verifies webhook signature and decodes its event
+	HandleWebhook(payload []byte, signature string) (Event, error)
+}
+
+// Simulator is implemented by sandbox providers which can complete payment
+// on behalf of customer and produce signed webhook payload
+type Simulator interface {
+	Confirm(ctx context.Context, intentId string, succeed bool) (payload []byte, signature string, err error)
+}
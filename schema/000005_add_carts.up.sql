@@ -0,0 +1,17 @@
+CREATE TABLE carts
+(
+    id         serial primary key                       not null unique,
+    user_id    integer references users (id) on delete cascade unique,
+    created_at timestamp default now(),
+    updated_at timestamp default now()
+);
+
+CREATE TABLE carts_items
+(
+    id       serial primary key                           not null,
+    cart_id  int references carts (id) on delete cascade  not null,
+    item_id  int references items (id) on delete cascade  not null,
+    color_id int references colors (id) on delete cascade not null,
+    quantity int                                          not null check (quantity > 0),
+    unique (cart_id, item_id, color_id)
+);
@@ -0,0 +1,7 @@
+DELETE FROM carts WHERE user_id IS NULL;
+
+ALTER TABLE carts
+    DROP CONSTRAINT carts_owner_check;
+
+ALTER TABLE carts
+    DROP COLUMN token;
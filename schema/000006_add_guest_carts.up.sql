@@ -0,0 +1,5 @@
+ALTER TABLE carts
+    ADD COLUMN token varchar(255) unique;
+
+ALTER TABLE carts
+    ADD CONSTRAINT carts_owner_check check (user_id IS NOT NULL OR token IS NOT NULL);
@@ -0,0 +1,3 @@
+DROP TABLE orders_history;
+DROP TABLE orders_items;
+DROP TABLE orders;
@@ -0,0 +1,43 @@
+CREATE TABLE orders
+(
+    id               serial primary key                                not null unique,
+    user_id          integer references users (id) on delete set null,
+    status           varchar(20)                                       not null default 'pending',
+    total            decimal(10, 2)                                    not null,
+    invoice_country  varchar(255)                                      not null,
+    invoice_city     varchar(255)                                      not null,
+    invoice_street   varchar(255)                                      not null,
+    invoice_zip      integer                                           not null,
+    shipping_country varchar(255)                                      not null,
+    shipping_city    varchar(255)                                      not null,
+    shipping_street  varchar(255)                                      not null,
+    shipping_zip     integer                                           not null,
+    created_at       timestamp default now(),
+    updated_at       timestamp default now()
+);
+
+CREATE INDEX orders_user_id_idx ON orders (user_id);
+
+CREATE TABLE orders_items
+(
+    id          serial primary key                            not null,
+    order_id    int references orders (id) on delete cascade  not null,
+    item_id     int references items (id) on delete set null,
+    name        varchar(255)                                  not null,
+    sku         varchar(255)                                  not null,
+    price       decimal(10, 2)                                not null,
+    color_id    int references colors (id) on delete set null,
+    color_name  varchar(255)                                  not null,
+    color_hex   varchar(255)                                  not null,
+    color_price decimal(10, 2)                                not null,
+    quantity    int                                           not null check (quantity > 0),
+    total       decimal(10, 2)                                not null
+);
+
+CREATE TABLE orders_history
+(
+    id         serial primary key                           not null,
+    order_id   int references orders (id) on delete cascade not null,
+    status     varchar(20)                                  not null,
+    created_at timestamp default now()
+);
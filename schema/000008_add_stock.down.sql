@@ -0,0 +1,7 @@
+DROP TABLE stock_movements;
+
+ALTER TABLE items_colors
+    DROP COLUMN stock;
+
+ALTER TABLE items_colors
+    DROP CONSTRAINT items_colors_item_color_key;
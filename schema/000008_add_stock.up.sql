@@ -0,0 +1,23 @@
+DELETE
+FROM items_colors A USING items_colors B
+WHERE A.item_id = B.item_id
+  AND A.color_id = B.color_id
+  AND A.id > B.id;
+
+ALTER TABLE items_colors
+    ADD CONSTRAINT items_colors_item_color_key unique (item_id, color_id);
+
+ALTER TABLE items_colors
+    ADD COLUMN stock integer not null default 0 check (stock >= 0);
+
+CREATE TABLE stock_movements
+(
+    id         serial primary key                             not null,
+    item_id    int references items (id) on delete cascade    not null,
+    color_id   int references colors (id) on delete cascade   not null,
+    delta      int                                            not null,
+    reason     varchar(255)                                   not null,
+    order_id   int references orders (id) on delete set null,
+    user_id    int references users (id) on delete set null,
+    created_at timestamp default now()
+);
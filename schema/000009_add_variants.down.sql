@@ -0,0 +1,3 @@
+DROP TABLE variants_images;
+DROP TABLE variants_options;
+DROP TABLE items_variants;
@@ -0,0 +1,25 @@
+CREATE TABLE items_variants
+(
+    id         serial primary key                          not null unique,
+    item_id    int references items (id) on delete cascade not null,
+    sku        varchar(255)                                not null unique,
+    price      decimal(10, 2),
+    stock      int                                         not null default 0 check (stock >= 0),
+    created_at timestamp default now()
+);
+
+CREATE TABLE variants_options
+(
+    id         serial primary key                                   not null,
+    variant_id int references items_variants (id) on delete cascade not null,
+    name       varchar(50)                                          not null,
+    value      varchar(255)                                         not null,
+    unique (variant_id, name)
+);
+
+CREATE TABLE variants_images
+(
+    id         serial primary key                                   not null,
+    variant_id int references items_variants (id) on delete cascade not null,
+    image_id   int references images (id) on delete cascade         not null
+);
@@ -0,0 +1,14 @@
+CREATE TABLE payments
+(
+    id         serial primary key                           not null unique,
+    order_id   int references orders (id) on delete cascade not null,
+    provider   varchar(50)                                  not null,
+    intent_id  varchar(255)                                 not null unique,
+    amount     decimal(10, 2)                               not null,
+    currency   varchar(3)                                   not null,
+    status     varchar(30)                                  not null,
+    created_at timestamp default now(),
+    updated_at timestamp default now()
+);
+
+CREATE INDEX payments_order_id_idx ON payments (order_id);
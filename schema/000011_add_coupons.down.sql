@@ -0,0 +1,18 @@
+ALTER TABLE orders_items
+    DROP COLUMN discount;
+
+ALTER TABLE orders
+    DROP COLUMN coupon_code,
+    DROP COLUMN discount,
+    DROP COLUMN shipping;
+
+ALTER TABLE carts
+    DROP COLUMN coupon_id;
+
+DROP TABLE coupons_redemptions;
+
+DROP TABLE coupons_tags;
+
+DROP TABLE coupons_categories;
+
+DROP TABLE coupons;
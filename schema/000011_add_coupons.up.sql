@@ -0,0 +1,51 @@
+CREATE TABLE coupons
+(
+    id             serial primary key not null unique,
+    code           varchar(50)        not null unique,
+    kind           varchar(20)        not null check (kind IN ('percent', 'fixed', 'free_shipping')),
+    value          decimal(10, 2)     not null default 0 check (value >= 0),
+    min_total      decimal(10, 2)     not null default 0,
+    starts_at      timestamp,
+    expires_at     timestamp,
+    usage_limit    int check (usage_limit > 0),
+    per_user_limit int check (per_user_limit > 0),
+    used           int                not null default 0,
+    created_at     timestamp default now()
+);
+
+CREATE TABLE coupons_categories
+(
+    coupon_id   int references coupons (id) on delete cascade    not null,
+    category_id int references categories (id) on delete cascade not null,
+    primary key (coupon_id, category_id)
+);
+
+CREATE TABLE coupons_tags
+(
+    coupon_id int references coupons (id) on delete cascade not null,
+    tag       varchar(255)                                  not null,
+    primary key (coupon_id, tag)
+);
+
+CREATE TABLE coupons_redemptions
+(
+    id         serial primary key                            not null,
+    coupon_id  int references coupons (id) on delete cascade not null,
+    user_id    int references users (id) on delete set null,
+    order_id   int references orders (id) on delete cascade  not null unique,
+    discount   decimal(10, 2)                                not null,
+    created_at timestamp default now()
+);
+
+CREATE INDEX coupons_redemptions_coupon_user_idx ON coupons_redemptions (coupon_id, user_id);
+
+ALTER TABLE carts
+    ADD COLUMN coupon_id int references coupons (id) on delete set null;
+
+ALTER TABLE orders
+    ADD COLUMN coupon_code varchar(50),
+    ADD COLUMN discount    decimal(10, 2) not null default 0,
+    ADD COLUMN shipping    decimal(10, 2) not null default 0;
+
+ALTER TABLE orders_items
+    ADD COLUMN discount decimal(10, 2) not null default 0;
@@ -0,0 +1,13 @@
+DROP TRIGGER categories_search_update ON categories;
+DROP FUNCTION categories_search_update();
+
+DROP TRIGGER tags_search_update ON tags;
+DROP FUNCTION tags_search_update();
+
+DROP TRIGGER items_search_update ON items;
+DROP FUNCTION items_search_update();
+
+DROP FUNCTION items_search_document(int, text, text, int);
+
+ALTER TABLE items
+    DROP COLUMN search;
@@ -0,0 +1,63 @@
+ALTER TABLE items
+    ADD COLUMN search tsvector;
+
+-- Item document: name is the most important part, then tags, category and description
+CREATE FUNCTION items_search_document(item_id int, item_name text, item_description text, item_category int)
+    RETURNS tsvector AS
+$$
+SELECT setweight(to_tsvector('simple', coalesce(item_name, '')), 'A') ||
+       setweight(to_tsvector('simple', coalesce((SELECT string_agg(T.name, ' ') FROM tags AS T WHERE T.item_id = $1), '')), 'B') ||
+       setweight(to_tsvector('simple', coalesce((SELECT C.name FROM categories AS C WHERE C.id = $4), '')), 'C') ||
+       setweight(to_tsvector('simple', coalesce(item_description, '')), 'D');
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION items_search_update() RETURNS trigger AS
+$$
+BEGIN
+    NEW.search := items_search_document(NEW.id, NEW.name, NEW.description, NEW.category_id);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER items_search_update
+    BEFORE INSERT OR UPDATE OF name, description, category_id
+    ON items
+    FOR EACH ROW
+EXECUTE PROCEDURE items_search_update();
+
+CREATE FUNCTION tags_search_update() RETURNS trigger AS
+$$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE items SET search = items_search_document(id, name, description, category_id) WHERE id = OLD.item_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE items SET search = items_search_document(id, name, description, category_id) WHERE id = NEW.item_id;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tags_search_update
+    AFTER INSERT OR UPDATE OR DELETE
+    ON tags
+    FOR EACH ROW
+EXECUTE PROCEDURE tags_search_update();
+
+CREATE FUNCTION categories_search_update() RETURNS trigger AS
+$$
+BEGIN
+    UPDATE items SET search = items_search_document(id, name, description, category_id) WHERE category_id = NEW.id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER categories_search_update
+    AFTER UPDATE OF name
+    ON categories
+    FOR EACH ROW
+EXECUTE PROCEDURE categories_search_update();
+
+UPDATE items SET search = items_search_document(id, name, description, category_id);
+
+CREATE INDEX items_search_idx ON items USING gin (search);
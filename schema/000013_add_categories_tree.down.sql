@@ -0,0 +1,13 @@
+DROP INDEX items_category_id_idx;
+
+DROP INDEX categories_parent_id_idx;
+
+DROP INDEX categories_parent_slug_idx;
+
+ALTER TABLE categories
+    DROP COLUMN parent_id,
+    DROP COLUMN slug,
+    DROP COLUMN position;
+
+ALTER TABLE categories
+    ADD CONSTRAINT categories_name_key unique (name);
@@ -0,0 +1,30 @@
+ALTER TABLE categories
+    DROP CONSTRAINT categories_name_key;
+
+ALTER TABLE categories
+    ADD COLUMN parent_id int references categories (id),
+    ADD COLUMN slug      varchar(255),
+    ADD COLUMN position  int not null default 0;
+
+UPDATE categories
+SET slug = trim(both '-' from lower(regexp_replace(name, '[^a-zA-Z0-9]+', '-', 'g')));
+
+UPDATE categories
+SET slug = 'category'
+WHERE slug = '';
+
+UPDATE categories AS A
+SET slug = A.slug || '-' || A.id
+FROM categories AS B
+WHERE A.slug = B.slug
+  AND A.id > B.id;
+
+ALTER TABLE categories
+    ALTER COLUMN slug SET NOT NULL;
+
+-- Slugs are unique among siblings, root categories share parent 0
+CREATE UNIQUE INDEX categories_parent_slug_idx ON categories (coalesce(parent_id, 0), slug);
+
+CREATE INDEX categories_parent_id_idx ON categories (parent_id);
+
+CREATE INDEX items_category_id_idx ON items (category_id);
@@ -0,0 +1,13 @@
+DROP TABLE sessions_used_tokens;
+
+DROP INDEX sessions_user_id_idx;
+
+ALTER TABLE sessions
+    DROP CONSTRAINT sessions_refresh_token_key;
+
+ALTER TABLE sessions
+    DROP COLUMN id,
+    DROP COLUMN user_agent,
+    DROP COLUMN ip,
+    DROP COLUMN created_at,
+    DROP COLUMN last_used_at;
@@ -0,0 +1,29 @@
+-- Expired sessions were never removed
+DELETE FROM sessions WHERE expires_at <= now();
+
+-- Tokens generated within the same second could collide
+DELETE FROM sessions
+WHERE refresh_token IN (SELECT refresh_token FROM sessions GROUP BY refresh_token HAVING count(*) > 1);
+
+ALTER TABLE sessions
+    ADD COLUMN id           serial primary key not null,
+    ADD COLUMN user_agent   varchar(255)       not null default '',
+    ADD COLUMN ip           varchar(45)        not null default '',
+    ADD COLUMN created_at   timestamp          not null default now(),
+    ADD COLUMN last_used_at timestamp          not null default now();
+
+ALTER TABLE sessions
+    ADD CONSTRAINT sessions_refresh_token_key unique (refresh_token);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+-- Refresh tokens already exchanged for new ones. Presenting one of them
+-- again means the token has leaked, so the whole session is revoked
+CREATE TABLE sessions_used_tokens
+(
+    session_id    int references sessions (id) on delete cascade not null,
+    refresh_token varchar(255)                                    not null unique,
+    used_at       timestamp default now()
+);
+
+CREATE INDEX sessions_used_tokens_session_id_idx ON sessions_used_tokens (session_id);
@@ -0,0 +1,8 @@
+-- Hashes cannot be reverted to tokens, all sessions are ended
+DELETE FROM sessions;
+
+ALTER TABLE sessions_used_tokens
+    ALTER COLUMN refresh_token TYPE varchar(255);
+
+ALTER TABLE sessions
+    ALTER COLUMN refresh_token TYPE varchar(255);
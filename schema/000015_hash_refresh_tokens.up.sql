@@ -0,0 +1,12 @@
+-- Refresh tokens are stored as hex encoded SHA-256, issued tokens keep working
+UPDATE sessions
+SET refresh_token = encode(sha256(convert_to(refresh_token, 'UTF8')), 'hex');
+
+UPDATE sessions_used_tokens
+SET refresh_token = encode(sha256(convert_to(refresh_token, 'UTF8')), 'hex');
+
+ALTER TABLE sessions
+    ALTER COLUMN refresh_token TYPE char(64);
+
+ALTER TABLE sessions_used_tokens
+    ALTER COLUMN refresh_token TYPE char(64);
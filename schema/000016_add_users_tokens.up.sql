@@ -0,0 +1,13 @@
+-- Single-use tokens sent to users by email, only SHA-256 hash is stored
+CREATE TABLE users_tokens
+(
+    id         serial primary key                          not null unique,
+    user_id    int references users (id) on delete cascade not null,
+    kind       varchar(30)                                 not null,
+    token_hash char(64)                                    not null unique,
+    expires_at timestamp                                   not null,
+    used_at    timestamp,
+    created_at timestamp default now()
+);
+
+CREATE INDEX users_tokens_user_id_kind_idx ON users_tokens (user_id, kind);
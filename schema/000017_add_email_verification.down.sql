@@ -0,0 +1,5 @@
+DELETE FROM users_tokens WHERE kind = 'email_verification';
+
+ALTER TABLE users
+    DROP COLUMN email_verified,
+    DROP COLUMN pending_email;
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN email_verified boolean not null default false,
+    ADD COLUMN pending_email  varchar(255);
+
+-- Existing users are trusted, verification applies to new addresses only
+UPDATE users SET email_verified = true;
@@ -0,0 +1,8 @@
+DELETE FROM users_tokens WHERE kind = 'two_factor_challenge';
+
+ALTER TABLE users_tokens
+    DROP COLUMN attempts;
+
+DROP TABLE users_recovery_codes;
+
+DROP TABLE users_totp;
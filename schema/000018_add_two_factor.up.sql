@@ -0,0 +1,24 @@
+CREATE TABLE users_totp
+(
+    user_id    int references users (id) on delete cascade not null unique,
+    secret     varchar(64)                                 not null,
+    enabled    boolean   default false                     not null,
+    -- Last accepted time step, codes of this or earlier steps are rejected
+    last_step  bigint,
+    created_at timestamp default now()
+);
+
+CREATE TABLE users_recovery_codes
+(
+    id        serial primary key                          not null unique,
+    user_id   int references users (id) on delete cascade not null,
+    code_hash char(64)                                    not null,
+    used_at   timestamp
+);
+
+CREATE INDEX users_recovery_codes_user_id_idx ON users_recovery_codes (user_id);
+
+-- Failed attempts of tokens which are checked against user input, such as
+-- sign in challenge with one-time code
+ALTER TABLE users_tokens
+    ADD COLUMN attempts int default 0 not null;
@@ -0,0 +1,16 @@
+ALTER TABLE users
+    ADD COLUMN admin boolean default false;
+
+-- Only superusers are restored as admins, other roles are lost
+UPDATE users
+SET admin = true
+WHERE id IN (SELECT UR.user_id
+             FROM users_roles AS UR
+                      JOIN roles_permissions AS RP ON RP.role_id = UR.role_id
+             WHERE RP.permission = '*');
+
+DROP TABLE users_roles;
+
+DROP TABLE roles_permissions;
+
+DROP TABLE roles;
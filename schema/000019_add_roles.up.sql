@@ -0,0 +1,39 @@
+CREATE TABLE roles
+(
+    id          serial primary key  not null unique,
+    name        varchar(50)         not null unique,
+    description varchar(255)        not null default '',
+    created_at  timestamp default now()
+);
+
+CREATE TABLE roles_permissions
+(
+    role_id    int references roles (id) on delete cascade not null,
+    permission varchar(50)                                 not null,
+    primary key (role_id, permission)
+);
+
+CREATE TABLE users_roles
+(
+    user_id int references users (id) on delete cascade not null,
+    role_id int references roles (id) on delete cascade not null,
+    primary key (user_id, role_id)
+);
+
+CREATE INDEX users_roles_role_id_idx ON users_roles (role_id);
+
+INSERT INTO roles (name, description)
+VALUES ('superuser', 'Full access, granted to former admins'),
+       ('editor', 'Manages catalogue and images');
+
+INSERT INTO roles_permissions (role_id, permission)
+SELECT id, '*' FROM roles WHERE name = 'superuser';
+
+INSERT INTO roles_permissions (role_id, permission)
+SELECT id, unnest(ARRAY ['catalog:write', 'images:write']) FROM roles WHERE name = 'editor';
+
+INSERT INTO users_roles (user_id, role_id)
+SELECT U.id, R.id FROM users AS U, roles AS R WHERE U.admin AND R.name = 'superuser';
+
+ALTER TABLE users
+    DROP COLUMN admin;
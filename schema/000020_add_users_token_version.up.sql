@@ -0,0 +1,2 @@
+-- Access tokens carry version of user, incrementing it rejects all tokens issued before
+ALTER TABLE users ADD COLUMN token_version integer not null default 1;
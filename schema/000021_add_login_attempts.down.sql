@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN failed_logins,
+    DROP COLUMN locked_until;
+
+DROP TABLE login_attempts;
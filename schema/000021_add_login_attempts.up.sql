@@ -0,0 +1,20 @@
+-- Sign in attempts for review by admins, login is kept for unknown accounts
+CREATE TABLE login_attempts
+(
+    id         serial primary key                         not null unique,
+    user_id    int references users (id) on delete set null,
+    login      varchar(255)                               not null,
+    ip         varchar(45)                                not null default '',
+    user_agent varchar(255)                               not null default '',
+    success    boolean                                    not null,
+    created_at timestamp                                  not null default now()
+);
+
+CREATE INDEX login_attempts_user_id_idx ON login_attempts (user_id);
+CREATE INDEX login_attempts_ip_idx ON login_attempts (ip);
+CREATE INDEX login_attempts_created_at_idx ON login_attempts (created_at);
+
+-- Consecutive failed sign ins, account is locked once they reach the limit
+ALTER TABLE users
+    ADD COLUMN failed_logins int not null default 0,
+    ADD COLUMN locked_until  timestamp;
@@ -0,0 +1,2 @@
+DROP TABLE api_keys_scopes;
+DROP TABLE api_keys;
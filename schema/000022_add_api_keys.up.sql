@@ -0,0 +1,21 @@
+-- Keys of server-to-server integrations, only SHA-256 hash of key is stored
+CREATE TABLE api_keys
+(
+    id           serial primary key                           not null unique,
+    name         varchar(100)                                 not null,
+    prefix       varchar(16)                                  not null,
+    key_hash     char(64)                                     not null unique,
+    created_by   int references users (id) on delete set null,
+    created_at   timestamp                                    not null default now(),
+    expires_at   timestamp,
+    last_used_at timestamp,
+    last_used_ip varchar(45)                                  not null default '',
+    revoked_at   timestamp
+);
+
+CREATE TABLE api_keys_scopes
+(
+    api_key_id int references api_keys (id) on delete cascade not null,
+    permission varchar(50)                                    not null,
+    primary key (api_key_id, permission)
+);
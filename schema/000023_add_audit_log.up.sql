@@ -0,0 +1,40 @@
+-- Administrative changes, actors are not referenced by foreign key so
+-- deleting user or key never touches the log
+CREATE TABLE audit_log
+(
+    id          bigserial primary key not null unique,
+    actor_id    int,
+    api_key_id  int,
+    action      varchar(50)           not null,
+    entity_type varchar(50)           not null,
+    entity_id   int,
+    before      jsonb,
+    after       jsonb,
+    diff        jsonb                 not null default '{}',
+    ip          varchar(45)           not null default '',
+    created_at  timestamp             not null default now()
+);
+
+CREATE INDEX audit_log_actor_id_idx ON audit_log (actor_id);
+CREATE INDEX audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+-- Log is append-only, rows cannot be changed or removed
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE
+    ON audit_log
+    FOR EACH ROW
+EXECUTE PROCEDURE audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE
+    ON audit_log
+    FOR EACH STATEMENT
+EXECUTE PROCEDURE audit_log_append_only();
@@ -0,0 +1,23 @@
+-- Accounts of external identity providers linked to users
+CREATE TABLE users_identities
+(
+    id         serial primary key                          not null unique,
+    user_id    int references users (id) on delete cascade not null,
+    provider   varchar(50)                                 not null,
+    subject    varchar(255)                                not null,
+    email      varchar(255)                                not null default '',
+    created_at timestamp                                   not null default now(),
+    unique (provider, subject)
+);
+
+CREATE INDEX users_identities_user_id_idx ON users_identities (user_id);
+
+-- Pending sign ins with identity providers, only SHA-256 hash of state is stored
+CREATE TABLE oauth_states
+(
+    state_hash    char(64) primary key not null,
+    provider      varchar(50)          not null,
+    code_verifier varchar(128)         not null,
+    nonce         varchar(128)         not null,
+    expires_at    timestamp            not null
+);
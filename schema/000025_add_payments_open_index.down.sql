@@ -0,0 +1 @@
+DROP INDEX payments_open_order_id_idx;
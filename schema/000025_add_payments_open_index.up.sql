@@ -0,0 +1,3 @@
+-- Order can have one payment in progress or succeeded at a time, so it cannot be charged twice
+CREATE UNIQUE INDEX payments_open_order_id_idx ON payments (order_id)
+    WHERE status IN ('requires_confirmation', 'authorized', 'succeeded');
@@ -0,0 +1,2 @@
+ALTER TABLE users_tokens
+    DROP COLUMN email;
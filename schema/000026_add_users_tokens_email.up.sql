@@ -0,0 +1,3 @@
+-- Address verification token was sent to, it confirms only this address
+ALTER TABLE users_tokens
+    ADD COLUMN email varchar(255) not null default '';
@@ -0,0 +1,13 @@
+ALTER TABLE stock_movements
+    DROP COLUMN variant_id;
+
+ALTER TABLE orders_items
+    DROP COLUMN variant_id;
+
+DELETE FROM carts_items
+WHERE variant_id IS NOT NULL;
+DROP INDEX carts_items_line_idx;
+ALTER TABLE carts_items
+    DROP COLUMN variant_id;
+ALTER TABLE carts_items
+    ADD CONSTRAINT carts_items_cart_id_item_id_color_id_key UNIQUE (cart_id, item_id, color_id);
@@ -0,0 +1,12 @@
+-- Lines of items with variants keep chosen variant, its price and stock apply
+ALTER TABLE carts_items
+    ADD COLUMN variant_id int references items_variants (id) on delete cascade;
+ALTER TABLE carts_items
+    DROP CONSTRAINT carts_items_cart_id_item_id_color_id_key;
+CREATE UNIQUE INDEX carts_items_line_idx ON carts_items (cart_id, item_id, color_id, COALESCE(variant_id, 0));
+
+ALTER TABLE orders_items
+    ADD COLUMN variant_id int references items_variants (id) on delete set null;
+
+ALTER TABLE stock_movements
+    ADD COLUMN variant_id int references items_variants (id) on delete cascade;